@@ -0,0 +1,509 @@
+// Package client talks to a wingspan server over a websocket,
+// exposing typed calls, a typed event stream and a mirror of
+// the game the player is seated in
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"git.internal.com/wingspan/pkg"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+var (
+	ErrClosed       = errors.New("Client closed")
+	ErrDisconnected = errors.New("Connection lost before a reply")
+)
+
+// Replied by the server when a call fails. Validation is
+// set when the params did not match the method's signature
+type Error struct {
+	Message    string
+	Validation *pkg.ValidationError
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func decodeError(raw json.RawMessage) *Error {
+	var message string
+	if err := json.Unmarshal(raw, &message); err == nil {
+		return &Error{Message: message}
+	}
+
+	var invalid pkg.ValidationError
+	if err := json.Unmarshal(raw, &invalid); err != nil {
+		return &Error{Message: string(raw)}
+	}
+	return &Error{Message: invalid.Error(), Validation: &invalid}
+}
+
+type Options struct {
+	// protocol offered on hello, PROTOCOL_VERSION when zero
+	Version      int
+	Capabilities []string
+
+	// how the client authenticates, tried in this order
+	Token       string
+	Credentials *pkg.Credentials
+	Guest       bool
+
+	// redials after the connection drops, resuming the game in progress
+	Reconnect  bool
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// 0 waits for replies as long as the call's context does
+	CallTimeout time.Duration
+	Header      http.Header
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Version:      pkg.PROTOCOL_VERSION,
+		Capabilities: []string{pkg.CapabilityResume, pkg.CapabilitySeq},
+		Guest:        true,
+		Reconnect:    true,
+		Backoff:      250 * time.Millisecond,
+		MaxBackoff:   10 * time.Second,
+		CallTimeout:  10 * time.Second,
+	}
+}
+
+type Client struct {
+	url     string
+	options Options
+	dialer  *websocket.Dialer
+
+	// guards conn, pending and the fields kept across reconnects
+	mutex    sync.Mutex
+	conn     *websocket.Conn
+	pending  map[string]chan error
+	account  pkg.AuthenticatedPayload
+	protocol pkg.WelcomePayload
+	seq      uint64
+	closed   bool
+
+	ids    atomic.Uint64
+	state  *GameState
+	events *eventQueue
+}
+
+func Dial(ctx context.Context, url string, options Options) (*Client, error) {
+	if options.Version == 0 {
+		options.Version = pkg.PROTOCOL_VERSION
+	}
+
+	c := &Client{
+		url:     url,
+		options: options,
+		dialer: &websocket.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: 45 * time.Second,
+			Subprotocols:     []string{"json"},
+		},
+		pending: make(map[string]chan error),
+		state:   NewGameState(),
+		events:  newEventQueue(),
+	}
+
+	if err := c.connect(ctx); err != nil {
+		c.events.close()
+		return nil, err
+	}
+	if err := c.handshake(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Events received from the server in order, closed along with the client
+func (c *Client) Events() <-chan Event {
+	return c.events.out
+}
+
+// Copy of the game as the client has seen it
+func (c *Client) State() GameState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.state.Copy()
+}
+
+func (c *Client) Account() pkg.AuthenticatedPayload {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.account
+}
+
+// Protocol the server agreed on
+func (c *Client) Protocol() pkg.WelcomePayload {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.protocol
+}
+
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	if c.conn == nil {
+		c.events.close()
+		return nil
+	}
+
+	c.conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(time.Second),
+	)
+	return c.conn.Close()
+}
+
+// Sends a message and waits for the server to ack it. Failures
+// replied by the server are returned as *Error
+func (c *Client) Call(ctx context.Context, method string, params any) error {
+	id := strconv.FormatUint(c.ids.Add(1), 10)
+	reply := make(chan error, 1)
+
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return ErrClosed
+	}
+	if c.conn == nil {
+		c.mutex.Unlock()
+		return ErrDisconnected
+	}
+
+	c.pending[id] = reply
+	err := c.conn.WriteJSON(pkg.Message{ID: id, Method: method, Params: params})
+	if err != nil {
+		delete(c.pending, id)
+	}
+	c.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if c.options.CallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.options.CallTimeout)
+		defer cancel()
+	}
+
+	select {
+	case err := <-reply:
+		return err
+	case <-ctx.Done():
+		c.mutex.Lock()
+		delete(c.pending, id)
+		c.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (c *Client) connect(ctx context.Context) error {
+	conn, _, err := c.dialer.DialContext(ctx, c.url, c.options.Header)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		conn.Close()
+		return ErrClosed
+	}
+	c.conn = conn
+
+	go c.read(conn)
+	return nil
+}
+
+// Negotiates the protocol, authenticates and takes the seat back
+// when there is a game in progress
+func (c *Client) handshake(ctx context.Context) error {
+	err := c.Hello(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	token := c.account.Token
+	player, resume, seq := c.state.PlayerID, c.state.ResumeToken, c.seq
+	over := c.state.Over
+	c.mutex.Unlock()
+
+	// an expired token falls back to the configured authentication
+	var rejected *Error
+	if token != "" {
+		err = c.Call(ctx, "Auth.Token", token)
+	}
+	if token == "" || errors.As(err, &rejected) {
+		err = c.authenticate(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	if player == uuid.Nil || resume == "" || over {
+		return nil
+	}
+
+	// the game ended while away, there is nothing left to resume
+	err = c.Resume(ctx, pkg.ResumePayload{Player: player, Token: resume, Seq: seq})
+	if errors.As(err, &rejected) {
+		c.mutex.Lock()
+		c.state = NewGameState()
+		c.mutex.Unlock()
+		return nil
+	}
+	return err
+}
+
+func (c *Client) authenticate(ctx context.Context) error {
+	switch {
+	case c.options.Token != "":
+		return c.Call(ctx, "Auth.Token", c.options.Token)
+	case c.options.Credentials != nil:
+		return c.Login(ctx, *c.options.Credentials)
+	case c.options.Guest:
+		return c.Guest(ctx)
+	}
+	return nil
+}
+
+func (c *Client) read(conn *websocket.Conn) {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			c.dropped(conn)
+			return
+		}
+
+		var response struct {
+			ID      string
+			Seq     uint64
+			Type    string
+			Payload json.RawMessage
+		}
+		if err := json.Unmarshal(data, &response); err != nil {
+			continue
+		}
+
+		// replies carry the ID of the call too, only the ack
+		// or error ends it, the reply is an event like any other
+		isAnswer := response.Type == pkg.Ack || response.Type == pkg.Error
+		if response.ID != "" && isAnswer && c.resolve(response.ID, response.Type, response.Payload) {
+			continue
+		}
+
+		event, _ := Decode(response.Type, response.Seq, response.Payload)
+		if c.track(event) {
+			c.events.push(event)
+		}
+	}
+}
+
+// Hands an ack or error to the call waiting for it
+func (c *Client) resolve(id, kind string, payload json.RawMessage) bool {
+	c.mutex.Lock()
+	reply, ok := c.pending[id]
+	delete(c.pending, id)
+	c.mutex.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	if kind == pkg.Error {
+		reply <- decodeError(payload)
+	} else {
+		reply <- nil
+	}
+	return true
+}
+
+// Updates what the client keeps from events, reporting
+// false for events replayed after they were already seen
+func (c *Client) track(event Event) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Every game numbers its events from the start again
+	if event.Type == pkg.MatchFound {
+		c.seq = 0
+	}
+	if event.Seq > 0 {
+		if event.Seq <= c.seq {
+			return false
+		}
+		c.seq = event.Seq
+	}
+
+	switch payload := event.Payload.(type) {
+	case pkg.AuthenticatedPayload:
+		c.account = payload
+	case pkg.WelcomePayload:
+		c.protocol = payload
+	}
+
+	c.state.Apply(event)
+	return true
+}
+
+func (c *Client) dropped(conn *websocket.Conn) {
+	conn.Close()
+
+	c.mutex.Lock()
+	if c.conn != conn {
+		c.mutex.Unlock()
+		return
+	}
+	c.conn = nil
+
+	for id, reply := range c.pending {
+		reply <- ErrDisconnected
+		delete(c.pending, id)
+	}
+
+	closed := c.closed || !c.options.Reconnect
+	c.mutex.Unlock()
+
+	if closed {
+		c.events.close()
+		return
+	}
+
+	c.events.push(Event{Type: Disconnected})
+	go c.reconnect()
+}
+
+func (c *Client) reconnect() {
+	backoff := c.options.Backoff
+	for {
+		time.Sleep(backoff)
+
+		c.mutex.Lock()
+		closed := c.closed
+		c.mutex.Unlock()
+		if closed {
+			c.events.close()
+			return
+		}
+
+		err := c.connect(context.Background())
+		if err == nil {
+			if err = c.handshake(context.Background()); err == nil {
+				c.events.push(Event{Type: Reconnected})
+				return
+			}
+
+			// the connection is dropped and the read loop reconnects
+			c.mutex.Lock()
+			if c.conn != nil {
+				c.conn.Close()
+			}
+			c.mutex.Unlock()
+			return
+		}
+		if err == ErrClosed {
+			c.events.close()
+			return
+		}
+
+		backoff *= 2
+		if c.options.MaxBackoff > 0 && backoff > c.options.MaxBackoff {
+			backoff = c.options.MaxBackoff
+		}
+	}
+}
+
+// Buffers events without bound so a slow reader never
+// blocks the connection it is being fed from
+type eventQueue struct {
+	mutex  sync.Mutex
+	events []Event
+	ready  chan struct{}
+	done   bool
+	out    chan Event
+}
+
+func newEventQueue() *eventQueue {
+	q := &eventQueue{
+		ready: make(chan struct{}, 1),
+		out:   make(chan Event),
+	}
+	go q.pump()
+	return q
+}
+
+func (q *eventQueue) push(event Event) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.done {
+		return
+	}
+	q.events = append(q.events, event)
+	q.signal()
+}
+
+func (q *eventQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.done = true
+	q.signal()
+}
+
+func (q *eventQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *eventQueue) pump() {
+	defer close(q.out)
+
+	for range q.ready {
+		for {
+			q.mutex.Lock()
+			if len(q.events) == 0 {
+				done := q.done
+				q.mutex.Unlock()
+				if done {
+					return
+				}
+				break
+			}
+			event := q.events[0]
+			q.events = q.events[1:]
+			q.mutex.Unlock()
+
+			q.out <- event
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"git.internal.com/wingspan/client"
+	"git.internal.com/wingspan/pkg"
+)
+
+// Keeps accepted connections so tests can drop them
+type listener struct {
+	net.Listener
+	mutex sync.Mutex
+	conns []net.Conn
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.mutex.Lock()
+		l.conns = append(l.conns, conn)
+		l.mutex.Unlock()
+	}
+	return conn, err
+}
+
+func (l *listener) drop(i int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.conns[i].Close()
+}
+
+func serve(t *testing.T) (string, *listener) {
+	t.Helper()
+	return serveWithRules(t, pkg.DefaultRules())
+}
+
+func serveWithRules(t *testing.T, rules pkg.GameRules) (string, *listener) {
+	t.Helper()
+
+	accounts, err := pkg.NewAccountStore(filepath.Join(t.TempDir(), "accounts.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := pkg.NewServer()
+	server.Use(pkg.RequireAuth("Auth", "System"))
+	server.Register("Auth", pkg.NewAuth(accounts, time.Hour))
+	server.Register("Queue", pkg.NewQueue(2))
+	server.Register("Matchmaker", pkg.NewMatchmaker(5*time.Second))
+	server.Register("Game", pkg.NewGameManagerWithRules(rules))
+
+	http := httptest.NewUnstartedServer(server.Handler())
+	tracked := &listener{Listener: http.Listener}
+	http.Listener = tracked
+	http.Start()
+	t.Cleanup(http.Close)
+
+	return strings.Replace(http.URL, "http", "ws", 1), tracked
+}
+
+func dial(t *testing.T, url string, options client.Options) *client.Client {
+	t.Helper()
+
+	c, err := client.Dial(context.Background(), url, options)
+	if err != nil {
+		t.Fatalf("Could not dial: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// Skips events until one of the given type arrives
+func await(t *testing.T, c *client.Client, kind string) client.Event {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-c.Events():
+			if !ok {
+				t.Fatalf("Events closed waiting for %v", kind)
+			}
+			if event.Type == kind {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %v", kind)
+		}
+	}
+}
+
+// Plays both clients through matchmaking and setup
+func start(t *testing.T, players ...*client.Client) {
+	t.Helper()
+	ctx := context.Background()
+
+	for _, c := range players {
+		if err := c.QueueAdd(ctx); err != nil {
+			t.Fatalf("Could not queue: %v", err)
+		}
+	}
+	for _, c := range players {
+		await(t, c, pkg.MatchFound)
+		if err := c.AcceptMatch(ctx); err != nil {
+			t.Fatalf("Could not accept: %v", err)
+		}
+	}
+	for _, c := range players {
+		event := await(t, c, pkg.ChooseCards)
+		birds := make([]pkg.BirdID, 0)
+		for _, bird := range event.Payload.(client.ChooseCards).Birds {
+			birds = append(birds, bird.ID)
+		}
+		if err := c.ChooseBirds(ctx, birds[:1]); err != nil {
+			t.Fatalf("Could not choose birds: %v", err)
+		}
+		if err := c.DiscardFood(ctx, map[pkg.FoodType]int{}); err != nil {
+			t.Fatalf("Could not discard food: %v", err)
+		}
+	}
+	for _, c := range players {
+		await(t, c, pkg.GameStarted)
+	}
+}
+
+func TestClient(t *testing.T) {
+	t.Run("negotiates and authenticates", func(t *testing.T) {
+		url, _ := serve(t)
+		c := dial(t, url, client.DefaultOptions())
+
+		if version := c.Protocol().Version; version != pkg.PROTOCOL_VERSION {
+			t.Errorf("Expected protocol %v, got %v", pkg.PROTOCOL_VERSION, version)
+		}
+		if account := c.Account(); !account.Guest || account.Token == "" {
+			t.Errorf("Expected a guest account with a token, got %+v", account)
+		}
+	})
+
+	t.Run("returns server errors", func(t *testing.T) {
+		url, _ := serve(t)
+		c := dial(t, url, client.DefaultOptions())
+
+		err := c.EndTurn(context.Background())
+		var failure *client.Error
+		if !errors.As(err, &failure) || failure.Message != pkg.ErrGameNotFound.Error() {
+			t.Errorf("Expected %v, got %v", pkg.ErrGameNotFound, err)
+		}
+
+		err = c.Call(context.Background(), "Game.PlayCard", "not a bird")
+		if !errors.As(err, &failure) || failure.Validation == nil {
+			t.Errorf("Expected a validation error, got %v", err)
+		}
+	})
+
+	t.Run("fails without authentication", func(t *testing.T) {
+		url, _ := serve(t)
+		options := client.DefaultOptions()
+		options.Guest = false
+		c := dial(t, url, options)
+
+		if err := c.QueueAdd(context.Background()); err == nil {
+			t.Error("Expected queueing to require authentication")
+		}
+	})
+
+	t.Run("mirrors the game", func(t *testing.T) {
+		url, _ := serve(t)
+		p1 := dial(t, url, client.DefaultOptions())
+		p2 := dial(t, url, client.DefaultOptions())
+		start(t, p1, p2)
+
+		await(t, p1, pkg.RoundStarted)
+		await(t, p2, pkg.RoundStarted)
+
+		s1, s2 := p1.State(), p2.State()
+		if s1.PlayerID == s2.PlayerID || s1.ResumeToken == "" {
+			t.Fatalf("Expected distinct seats with resume tokens, got %v and %v", s1.PlayerID, s2.PlayerID)
+		}
+		if len(s1.Hand) != 1 || len(s2.Hand) != 1 {
+			t.Errorf("Expected the kept bird in hand, got %v and %v", len(s1.Hand), len(s2.Hand))
+		}
+		if len(s1.TurnOrder) != 2 || s1.Round != s2.Round {
+			t.Errorf("Expected both players to see the same round, got %+v and %+v", s1, s2)
+		}
+	})
+
+	t.Run("resumes after reconnecting", func(t *testing.T) {
+		url, conns := serve(t)
+		options := client.DefaultOptions()
+		options.Backoff = 10 * time.Millisecond
+		p1 := dial(t, url, options)
+		p2 := dial(t, url, options)
+		start(t, p1, p2)
+		await(t, p1, pkg.RoundStarted)
+
+		before := p1.State()
+		conns.drop(0)
+
+		await(t, p1, client.Disconnected)
+		await(t, p1, pkg.Resumed)
+		await(t, p1, client.Reconnected)
+
+		if after := p1.State(); after.PlayerID != before.PlayerID {
+			t.Errorf("Expected seat %v, got %v", before.PlayerID, after.PlayerID)
+		}
+
+		// the seat belongs to the new connection
+		if err := p1.PlayerInfo(context.Background(), before.PlayerID); err != nil {
+			t.Fatalf("Could not get player info: %v", err)
+		}
+		await(t, p1, pkg.PlayerInfo)
+	})
+
+	t.Run("follows a second game", func(t *testing.T) {
+		rules := pkg.DefaultRules()
+		rules.MaxRounds = 1
+		rules.MaxTurns = 1
+
+		url, _ := serveWithRules(t, rules)
+		a := dial(t, url, client.DefaultOptions())
+		b := dial(t, url, client.DefaultOptions())
+
+		start(t, a, b)
+		// Only the current player can end the turn, the others fail
+		for i := 0; i < 2; i++ {
+			a.EndTurn(context.Background())
+			b.EndTurn(context.Background())
+		}
+		await(t, a, pkg.GameOver)
+		await(t, b, pkg.GameOver)
+
+		// Events of the new game are numbered from the start again
+		start(t, a, b)
+	})
+
+	t.Run("closes events", func(t *testing.T) {
+		url, _ := serve(t)
+		c := dial(t, url, client.DefaultOptions())
+		c.Close()
+
+		for range c.Events() {
+		}
+		if err := c.QueueAdd(context.Background()); err != client.ErrClosed {
+			t.Errorf("Expected %v, got %v", client.ErrClosed, err)
+		}
+	})
+}
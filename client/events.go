@@ -0,0 +1,216 @@
+package client
+
+import (
+	"encoding/json"
+
+	"git.internal.com/wingspan/pkg"
+	"github.com/google/uuid"
+)
+
+// Events the client emits on its own, they never come from the server
+const (
+	Disconnected = "disconnected"
+	Reconnected  = "reconnected"
+)
+
+// Response received from the server. Payload holds the type listed
+// for Type in Decode, or the raw JSON for types it does not know
+type Event struct {
+	Type    string
+	Seq     uint64
+	Payload any
+	Raw     json.RawMessage
+}
+
+// Bird card as clients see it. Powers are behaviour on the
+// server, so they are kept as they were sent
+type Bird struct {
+	ID            pkg.BirdID
+	Name          string
+	Points        int
+	EggLimit      int
+	EggCount      int
+	CachedFood    int
+	TuckedCards   int
+	Wingspan      int
+	HuntingPower  int
+	NestType      pkg.NestType
+	Habitat       pkg.Habitat
+	FoodCondition pkg.FoodCondition
+	FoodCost      map[pkg.FoodType]int
+	Power         map[pkg.Trigger]json.RawMessage
+}
+
+type PlayerRef struct {
+	ID uuid.UUID
+}
+
+// Sent both while setting up, with Birds, Food and Time,
+// and when drawing from a power, with Qty and Cards
+type ChooseCards struct {
+	Birds []*Bird
+	Food  map[pkg.FoodType]int
+	Time  float64
+	Qty   int
+	Cards []pkg.BirdID
+}
+
+type ChooseBirds struct {
+	Qty   int
+	Birds []pkg.BirdID
+}
+
+type StartTurn struct {
+	Turn     int
+	Duration float64
+	TimeLeft float64
+	BirdTray []*Bird
+}
+
+type WaitTurn struct {
+	Turn     int
+	Duration float64
+	TimeLeft float64
+	BirdTray []*Bird
+	Current  uuid.UUID
+}
+
+type RoundStarted struct {
+	Round     int
+	Turns     int
+	BirdTray  []*Bird
+	TurnOrder []PlayerRef
+}
+
+// The player drawing gets the birds, everybody else the count
+type BirdsDrawn struct {
+	Birds []*Bird
+	Count int
+}
+
+type FoodGained struct {
+	Player uuid.UUID
+	Food   map[pkg.FoodType]int
+}
+
+type BirdPlayed struct {
+	Player uuid.UUID
+	Bird   *Bird
+}
+
+type PlayerInfo struct {
+	Turn       int
+	Round      int
+	MaxTurns   int
+	Duration   float64
+	TimeLeft   float64
+	Current    uuid.UUID
+	BirdTray   []*Bird
+	TurnOrder  []PlayerRef
+	BirdFeeder map[pkg.FoodType]int
+	Birds      []*Bird
+	Board      map[pkg.Habitat][]*Bird
+	Food       map[pkg.FoodType]int
+}
+
+// Decodes a response payload into the type its event carries:
+//
+//	match_found, maintenance    float64 seconds
+//	discard_food                int
+//	game_over                   string
+//	game_started                pkg.GameStartedPayload
+//	resumed                     uuid.UUID
+//	choose_cards                ChooseCards
+//	choose_birds                ChooseBirds
+//	choose_food                 pkg.GainFood
+//	pay_bird_cost               pkg.AvailableResources
+//	start_turn                  StartTurn
+//	wait_turn                   WaitTurn
+//	round_started               RoundStarted
+//	birds_drawn                 BirdsDrawn
+//	food_gained                 FoodGained
+//	food_updated                map[pkg.FoodType]int
+//	bird_updated                map[pkg.BirdID]int
+//	bird_played                 BirdPlayed
+//	player_info                 PlayerInfo
+//	authenticated               pkg.AuthenticatedPayload
+//	welcome                     pkg.WelcomePayload
+//	unsupported_version         pkg.UnsupportedVersionPayload
+//	description                 []pkg.ServiceDescription
+//	error                       *Error
+func Decode(kind string, seq uint64, raw json.RawMessage) (Event, error) {
+	event := Event{Type: kind, Seq: seq, Raw: raw}
+	if len(raw) == 0 || string(raw) == "null" {
+		return event, nil
+	}
+
+	var err error
+	decode := func(payload any) any {
+		err = json.Unmarshal(raw, payload)
+		return payload
+	}
+
+	switch kind {
+	case pkg.MatchFound, pkg.Maintenance:
+		event.Payload = *decode(new(float64)).(*float64)
+	case pkg.DiscardFood:
+		event.Payload = *decode(new(int)).(*int)
+	case pkg.GameOver:
+		event.Payload = *decode(new(string)).(*string)
+	case pkg.GameStarted:
+		// legacy protocol sends the ID alone
+		var id uuid.UUID
+		if json.Unmarshal(raw, &id) == nil {
+			event.Payload = pkg.GameStartedPayload{ID: id}
+		} else {
+			event.Payload = *decode(new(pkg.GameStartedPayload)).(*pkg.GameStartedPayload)
+		}
+	case pkg.Resumed:
+		event.Payload = *decode(new(uuid.UUID)).(*uuid.UUID)
+	case pkg.ChooseCards:
+		event.Payload = *decode(new(ChooseCards)).(*ChooseCards)
+	case pkg.ChooseBirds:
+		event.Payload = *decode(new(ChooseBirds)).(*ChooseBirds)
+	case pkg.ChooseFood:
+		event.Payload = *decode(new(pkg.GainFood)).(*pkg.GainFood)
+	case pkg.PayBirdCost:
+		event.Payload = *decode(new(pkg.AvailableResources)).(*pkg.AvailableResources)
+	case pkg.StartTurn:
+		event.Payload = *decode(new(StartTurn)).(*StartTurn)
+	case pkg.WaitTurn:
+		event.Payload = *decode(new(WaitTurn)).(*WaitTurn)
+	case pkg.RoundStarted:
+		event.Payload = *decode(new(RoundStarted)).(*RoundStarted)
+	case pkg.BirdsDrawn:
+		var drawn BirdsDrawn
+		if json.Unmarshal(raw, &drawn.Count) != nil {
+			decode(&drawn.Birds)
+			drawn.Count = len(drawn.Birds)
+		}
+		event.Payload = drawn
+	case pkg.FoodGained:
+		event.Payload = *decode(new(FoodGained)).(*FoodGained)
+	case pkg.FoodUpdated:
+		event.Payload = *decode(new(map[pkg.FoodType]int)).(*map[pkg.FoodType]int)
+	case pkg.BirdUpdated:
+		event.Payload = *decode(new(map[pkg.BirdID]int)).(*map[pkg.BirdID]int)
+	case pkg.BirdPlayed:
+		event.Payload = *decode(new(BirdPlayed)).(*BirdPlayed)
+	case pkg.PlayerInfo:
+		event.Payload = *decode(new(PlayerInfo)).(*PlayerInfo)
+	case pkg.Authenticated:
+		event.Payload = *decode(new(pkg.AuthenticatedPayload)).(*pkg.AuthenticatedPayload)
+	case pkg.Welcome:
+		event.Payload = *decode(new(pkg.WelcomePayload)).(*pkg.WelcomePayload)
+	case pkg.Unsupported:
+		event.Payload = *decode(new(pkg.UnsupportedVersionPayload)).(*pkg.UnsupportedVersionPayload)
+	case pkg.Description:
+		event.Payload = *decode(new([]pkg.ServiceDescription)).(*[]pkg.ServiceDescription)
+	case pkg.Error:
+		event.Payload = decodeError(raw)
+	default:
+		event.Payload = raw
+	}
+
+	return event, err
+}
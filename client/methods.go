@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+
+	"git.internal.com/wingspan/pkg"
+	"github.com/google/uuid"
+)
+
+// Offers the protocol in the options, the server
+// answers with a welcome event before the ack
+func (c *Client) Hello(ctx context.Context) error {
+	return c.Call(ctx, "System.Hello", pkg.HelloPayload{
+		Version:      c.options.Version,
+		MinVersion:   pkg.MIN_PROTOCOL_VERSION,
+		Capabilities: c.options.Capabilities,
+		Client:       "wingspan-go",
+	})
+}
+
+func (c *Client) Describe(ctx context.Context) error {
+	return c.Call(ctx, "System.Describe", nil)
+}
+
+func (c *Client) Guest(ctx context.Context) error {
+	return c.Call(ctx, "Auth.Guest", nil)
+}
+
+func (c *Client) Register(ctx context.Context, credentials pkg.Credentials) error {
+	return c.Call(ctx, "Auth.Register", credentials)
+}
+
+func (c *Client) Login(ctx context.Context, credentials pkg.Credentials) error {
+	return c.Call(ctx, "Auth.Login", credentials)
+}
+
+func (c *Client) QueueAdd(ctx context.Context) error {
+	return c.Call(ctx, "Queue.Add", nil)
+}
+
+func (c *Client) QueueRemove(ctx context.Context) error {
+	return c.Call(ctx, "Queue.Remove", nil)
+}
+
+func (c *Client) AcceptMatch(ctx context.Context) error {
+	return c.Call(ctx, "Matchmaker.Accept", nil)
+}
+
+func (c *Client) DeclineMatch(ctx context.Context) error {
+	return c.Call(ctx, "Matchmaker.Decline", nil)
+}
+
+// Birds left out are dropped from the mirrored hand once acked
+func (c *Client) ChooseBirds(ctx context.Context, birds []pkg.BirdID) error {
+	if err := c.Call(ctx, "Game.ChooseBirds", birds); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.state.keep(birds)
+	return nil
+}
+
+func (c *Client) DiscardFood(ctx context.Context, food map[pkg.FoodType]int) error {
+	if err := c.Call(ctx, "Game.DiscardFood", food); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.state.discard(food)
+	return nil
+}
+
+func (c *Client) DrawCards(ctx context.Context) error {
+	return c.Call(ctx, "Game.DrawCards", nil)
+}
+
+func (c *Client) DrawFromDeck(ctx context.Context) error {
+	return c.Call(ctx, "Game.DrawFromDeck", nil)
+}
+
+func (c *Client) DrawFromTray(ctx context.Context, birds []pkg.BirdID) error {
+	return c.Call(ctx, "Game.DrawFromTray", birds)
+}
+
+func (c *Client) GainFood(ctx context.Context) error {
+	return c.Call(ctx, "Game.GainFood", nil)
+}
+
+func (c *Client) ChooseFood(ctx context.Context, food map[pkg.FoodType]int) error {
+	return c.Call(ctx, "Game.ChooseFood", food)
+}
+
+func (c *Client) LayEggs(ctx context.Context) error {
+	return c.Call(ctx, "Game.LayEggs", nil)
+}
+
+func (c *Client) LayEggsOnBirds(ctx context.Context, eggs map[pkg.BirdID]int) error {
+	return c.Call(ctx, "Game.LayEggsOnBirds", eggs)
+}
+
+func (c *Client) PlayCard(ctx context.Context, bird pkg.BirdID) error {
+	return c.Call(ctx, "Game.PlayCard", bird)
+}
+
+func (c *Client) PayBirdCost(ctx context.Context, payment pkg.PayBirdCostPayload) error {
+	return c.Call(ctx, "Game.PayBirdCost", payment)
+}
+
+func (c *Client) ActivatePower(ctx context.Context, bird pkg.BirdID) error {
+	return c.Call(ctx, "Game.ActivatePower", bird)
+}
+
+func (c *Client) EndTurn(ctx context.Context) error {
+	return c.Call(ctx, "Game.EndTurn", nil)
+}
+
+// Asks for the full state of the seat, answered with a player info event
+func (c *Client) PlayerInfo(ctx context.Context, player uuid.UUID) error {
+	return c.Call(ctx, "Game.PlayerInfo", player)
+}
+
+func (c *Client) Resume(ctx context.Context, resume pkg.ResumePayload) error {
+	return c.Call(ctx, "Game.Resume", resume)
+}
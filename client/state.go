@@ -0,0 +1,207 @@
+package client
+
+import (
+	"git.internal.com/wingspan/pkg"
+	"github.com/google/uuid"
+)
+
+// The game as seen by one player, kept in sync from events.
+// Egg counts are only refreshed by player info, bird updated
+// carries eggs laid or eggs left depending on the action
+type GameState struct {
+	PlayerID    uuid.UUID
+	ResumeToken string
+	Seed        int64
+	Round       int
+	Turn        int
+	Turns       int
+	Current     uuid.UUID
+	TurnOrder   []uuid.UUID
+	BirdTray    []*Bird
+	BirdFeeder  map[pkg.FoodType]int
+	Hand        []*Bird
+	Food        map[pkg.FoodType]int
+	Played      map[uuid.UUID][]*Bird
+	Over        bool
+	Result      string
+}
+
+func NewGameState() *GameState {
+	return &GameState{
+		BirdFeeder: make(map[pkg.FoodType]int),
+		Food:       make(map[pkg.FoodType]int),
+		Played:     make(map[uuid.UUID][]*Bird),
+	}
+}
+
+func (s *GameState) MyTurn() bool {
+	return s.PlayerID != uuid.Nil && s.Current == s.PlayerID
+}
+
+func (s *GameState) Apply(event Event) {
+	switch payload := event.Payload.(type) {
+	case pkg.GameStartedPayload:
+		s.PlayerID = payload.ID
+		s.ResumeToken = payload.Token
+		s.Seed = payload.Seed
+		s.Over = false
+		s.Result = ""
+
+	case ChooseCards:
+		// dealt while setting up, powers only offer cards by ID
+		if payload.Birds != nil {
+			s.Hand = payload.Birds
+			s.Food = copyFood(payload.Food)
+		}
+
+	case RoundStarted:
+		s.Round = payload.Round
+		s.Turns = payload.Turns
+		s.BirdTray = payload.BirdTray
+		s.TurnOrder = s.TurnOrder[:0]
+		for _, player := range payload.TurnOrder {
+			s.TurnOrder = append(s.TurnOrder, player.ID)
+		}
+
+	case StartTurn:
+		s.Turn = payload.Turn
+		s.BirdTray = payload.BirdTray
+		s.Current = s.PlayerID
+
+	case WaitTurn:
+		s.Turn = payload.Turn
+		s.BirdTray = payload.BirdTray
+		s.Current = payload.Current
+
+	case BirdsDrawn:
+		for _, bird := range payload.Birds {
+			s.BirdTray = removeBird(s.BirdTray, bird.ID)
+			if s.MyTurn() {
+				s.Hand = append(s.Hand, bird)
+			}
+		}
+
+	case FoodGained:
+		for food, qty := range payload.Food {
+			if s.BirdFeeder[food] -= qty; s.BirdFeeder[food] <= 0 {
+				delete(s.BirdFeeder, food)
+			}
+			if payload.Player == s.PlayerID {
+				s.Food[food] += qty
+			}
+		}
+
+	case map[pkg.FoodType]int:
+		// food updated always belongs to whoever's turn it is
+		if event.Type == pkg.FoodUpdated && s.MyTurn() {
+			s.Food = copyFood(payload)
+		}
+
+	case BirdPlayed:
+		if payload.Bird == nil {
+			break
+		}
+		s.Played[payload.Player] = append(s.Played[payload.Player], payload.Bird)
+		if payload.Player == s.PlayerID {
+			s.Hand = removeBird(s.Hand, payload.Bird.ID)
+		}
+
+	case PlayerInfo:
+		s.Round = payload.Round
+		s.Turn = payload.Turn
+		s.Turns = payload.MaxTurns
+		s.Current = payload.Current
+		s.BirdTray = payload.BirdTray
+		s.BirdFeeder = copyFood(payload.BirdFeeder)
+		s.Hand = payload.Birds
+		s.Food = copyFood(payload.Food)
+		s.TurnOrder = s.TurnOrder[:0]
+		for _, player := range payload.TurnOrder {
+			s.TurnOrder = append(s.TurnOrder, player.ID)
+		}
+
+		played := make([]*Bird, 0)
+		for _, row := range payload.Board {
+			for _, bird := range row {
+				if bird != nil {
+					played = append(played, bird)
+				}
+			}
+		}
+		s.Played[s.PlayerID] = played
+
+	case string:
+		if event.Type == pkg.GameOver {
+			s.Over = true
+			s.Result = payload
+		}
+
+	default:
+		if event.Type == pkg.GameCanceled {
+			s.Over = true
+		}
+	}
+}
+
+// No event tells which birds were kept while setting up
+func (s *GameState) keep(birds []pkg.BirdID) {
+	hand := make([]*Bird, 0, len(birds))
+	for _, bird := range s.Hand {
+		for _, id := range birds {
+			if bird.ID == id {
+				hand = append(hand, bird)
+				break
+			}
+		}
+	}
+	s.Hand = hand
+}
+
+func (s *GameState) discard(food map[pkg.FoodType]int) {
+	for kind, qty := range food {
+		if s.Food[kind] -= qty; s.Food[kind] <= 0 {
+			delete(s.Food, kind)
+		}
+	}
+}
+
+// Deep enough that the copy can be read while events keep arriving
+func (s *GameState) Copy() GameState {
+	copied := *s
+	copied.TurnOrder = append([]uuid.UUID(nil), s.TurnOrder...)
+	copied.BirdTray = copyBirds(s.BirdTray)
+	copied.Hand = copyBirds(s.Hand)
+	copied.BirdFeeder = copyFood(s.BirdFeeder)
+	copied.Food = copyFood(s.Food)
+	copied.Played = make(map[uuid.UUID][]*Bird, len(s.Played))
+	for player, birds := range s.Played {
+		copied.Played[player] = copyBirds(birds)
+	}
+	return copied
+}
+
+func copyBirds(birds []*Bird) []*Bird {
+	copied := make([]*Bird, 0, len(birds))
+	for _, bird := range birds {
+		b := *bird
+		copied = append(copied, &b)
+	}
+	return copied
+}
+
+func copyFood(food map[pkg.FoodType]int) map[pkg.FoodType]int {
+	copied := make(map[pkg.FoodType]int, len(food))
+	for kind, qty := range food {
+		copied[kind] = qty
+	}
+	return copied
+}
+
+func removeBird(birds []*Bird, id pkg.BirdID) []*Bird {
+	for i, bird := range birds {
+		if bird.ID == id {
+			return append(birds[:i:i], birds[i+1:]...)
+		}
+	}
+	return birds
+}
@@ -0,0 +1,127 @@
+package client_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"git.internal.com/wingspan/client"
+	"git.internal.com/wingspan/pkg"
+	"github.com/google/uuid"
+)
+
+func decode(t *testing.T, kind string, payload any) client.Event {
+	t.Helper()
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := client.Decode(kind, 0, raw)
+	if err != nil {
+		t.Fatalf("Could not decode %v: %v", kind, err)
+	}
+	return event
+}
+
+func TestGameState(t *testing.T) {
+	me, other := uuid.New(), uuid.New()
+
+	started := func(t *testing.T) *client.GameState {
+		state := client.NewGameState()
+		state.Apply(decode(t, pkg.GameStarted, pkg.GameStartedPayload{ID: me, Token: "token", Seed: 7}))
+		state.Apply(decode(t, pkg.ChooseCards, pkg.ChooseResources{
+			Birds: []*pkg.Bird{{ID: 1}, {ID: 2}},
+			Food:  map[pkg.FoodType]int{pkg.Fish: 1},
+		}))
+		return state
+	}
+
+	t.Run("decodes legacy game started", func(t *testing.T) {
+		state := client.NewGameState()
+		state.Apply(decode(t, pkg.GameStarted, me))
+
+		if state.PlayerID != me || state.ResumeToken != "" {
+			t.Errorf("Expected seat %v without a token, got %v %q", me, state.PlayerID, state.ResumeToken)
+		}
+	})
+
+	t.Run("keeps the seed", func(t *testing.T) {
+		if state := started(t); state.Seed != 7 || state.ResumeToken != "token" {
+			t.Errorf("Expected seed 7 and token, got %v %q", state.Seed, state.ResumeToken)
+		}
+	})
+
+	t.Run("decodes birds with powers", func(t *testing.T) {
+		event := decode(t, pkg.BirdPlayed, map[string]any{
+			"player": other,
+			"bird":   &pkg.Bird{ID: 7, Power: map[pkg.Trigger]pkg.Power{pkg.WhenPlayed: &pkg.DrawFromDeckPower{Qty: 1}}},
+		})
+
+		played := event.Payload.(client.BirdPlayed)
+		if played.Player != other || played.Bird.ID != 7 || len(played.Bird.Power) != 1 {
+			t.Errorf("Unexpected payload %+v", played)
+		}
+	})
+
+	t.Run("tracks turns", func(t *testing.T) {
+		state := started(t)
+		state.Apply(decode(t, pkg.WaitTurn, pkg.WaitTurnPayload{Turn: 1, Current: other}))
+		if state.MyTurn() {
+			t.Error("Expected the other player's turn")
+		}
+
+		state.Apply(decode(t, pkg.StartTurn, pkg.StartTurnPayload{Turn: 2}))
+		if !state.MyTurn() || state.Turn != 2 {
+			t.Errorf("Expected my turn 2, got %v on %v", state.Current, state.Turn)
+		}
+	})
+
+	t.Run("moves drawn and played birds", func(t *testing.T) {
+		state := started(t)
+		state.Apply(decode(t, pkg.StartTurn, pkg.StartTurnPayload{}))
+		state.Apply(decode(t, pkg.BirdsDrawn, []*pkg.Bird{{ID: 3}}))
+		state.Apply(decode(t, pkg.BirdPlayed, map[string]any{"player": me, "bird": &pkg.Bird{ID: 1}}))
+
+		hand := make([]pkg.BirdID, 0)
+		for _, bird := range state.Hand {
+			hand = append(hand, bird.ID)
+		}
+		if len(hand) != 2 || hand[0] != 2 || hand[1] != 3 {
+			t.Errorf("Expected birds 2 and 3 in hand, got %v", hand)
+		}
+		if len(state.Played[me]) != 1 {
+			t.Errorf("Expected a played bird, got %v", state.Played[me])
+		}
+	})
+
+	t.Run("ignores other players food", func(t *testing.T) {
+		state := started(t)
+		state.Apply(decode(t, pkg.WaitTurn, pkg.WaitTurnPayload{Current: other}))
+		state.Apply(decode(t, pkg.FoodUpdated, map[pkg.FoodType]int{pkg.Seed: 5}))
+		state.Apply(decode(t, pkg.FoodGained, map[string]any{"player": other, "food": map[pkg.FoodType]int{pkg.Seed: 1}}))
+
+		if state.Food[pkg.Seed] != 0 || state.Food[pkg.Fish] != 1 {
+			t.Errorf("Expected my food untouched, got %v", state.Food)
+		}
+	})
+
+	t.Run("copies", func(t *testing.T) {
+		state := started(t)
+		copied := state.Copy()
+		copied.Hand[0].EggCount = 3
+		copied.Food[pkg.Fish] = 9
+
+		if state.Hand[0].EggCount != 0 || state.Food[pkg.Fish] != 1 {
+			t.Error("Expected the copy not to share state")
+		}
+	})
+
+	t.Run("ends", func(t *testing.T) {
+		state := started(t)
+		state.Apply(decode(t, pkg.GameOver, "You win"))
+
+		if !state.Over || state.Result != "You win" {
+			t.Errorf("Expected the game over, got %v %q", state.Over, state.Result)
+		}
+	})
+}
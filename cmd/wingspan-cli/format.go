@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"git.internal.com/wingspan/client"
+	"git.internal.com/wingspan/pkg"
+)
+
+var (
+	foods    = []string{"fruit", "seed", "invertebrate", "fish", "rodent"}
+	habitats = []string{"forest", "grassland", "wetland"}
+)
+
+func foodName(food pkg.FoodType) string {
+	if int(food) < len(foods) {
+		return foods[food]
+	}
+	return strconv.Itoa(int(food))
+}
+
+func formatFood(food map[pkg.FoodType]int) string {
+	kinds := make([]pkg.FoodType, 0, len(food))
+	for kind := range food {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+
+	items := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		items = append(items, fmt.Sprintf("%v=%v", foodName(kind), food[kind]))
+	}
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, " ")
+}
+
+func formatFoodTypes(food []pkg.FoodType) string {
+	names := make([]string, 0, len(food))
+	for _, kind := range food {
+		names = append(names, foodName(kind))
+	}
+	return strings.Join(names, ", ")
+}
+
+func formatBird(bird *client.Bird) string {
+	habitat := strconv.Itoa(int(bird.Habitat))
+	if int(bird.Habitat) < len(habitats) {
+		habitat = habitats[bird.Habitat]
+	}
+
+	separator := " "
+	if bird.FoodCondition == pkg.Or {
+		separator = " or "
+	}
+	cost := make([]string, 0, len(bird.FoodCost))
+	for food, qty := range bird.FoodCost {
+		cost = append(cost, fmt.Sprintf("%v %v", qty, foodName(food)))
+	}
+	sort.Strings(cost)
+	if len(cost) == 0 {
+		cost = append(cost, "nothing")
+	}
+
+	return fmt.Sprintf("#%v %v [%v, %vpts, eggs %v/%v, costs %v]",
+		bird.ID, bird.Name, habitat, bird.Points, bird.EggCount, bird.EggLimit, strings.Join(cost, separator))
+}
+
+func printBirds(title string, birds []*client.Bird) {
+	fmt.Printf("%v:\n", title)
+	for _, bird := range birds {
+		fmt.Println("  " + formatBird(bird))
+	}
+}
+
+func printBoard(info client.PlayerInfo) {
+	fmt.Printf("Round %v, turn %v of %v, %.0fs left\n", info.Round, info.Turn, info.MaxTurns, info.TimeLeft)
+	for habitat, name := range habitats {
+		birds := make([]*client.Bird, 0)
+		for _, bird := range info.Board[pkg.Habitat(habitat)] {
+			if bird != nil {
+				birds = append(birds, bird)
+			}
+		}
+		printBirds(strings.ToUpper(name[:1])+name[1:], birds)
+	}
+	printBirds("Hand", info.Birds)
+	fmt.Println("Food:", formatFood(info.Food))
+	fmt.Println("Birdfeeder:", formatFood(info.BirdFeeder))
+	printBirds("Bird tray", info.BirdTray)
+}
+
+func parseBirds(args []string) ([]pkg.BirdID, error) {
+	birds := make([]pkg.BirdID, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bird %v", arg)
+		}
+		birds = append(birds, pkg.BirdID(id))
+	}
+	return birds, nil
+}
+
+func parseFoodType(name string) (pkg.FoodType, error) {
+	for i, food := range foods {
+		if strings.EqualFold(name, food) {
+			return pkg.FoodType(i), nil
+		}
+	}
+	if i, err := strconv.Atoi(name); err == nil && i >= 0 && i < len(foods) {
+		return pkg.FoodType(i), nil
+	}
+	return 0, fmt.Errorf("unknown food %v, expected one of %v", name, strings.Join(foods, ", "))
+}
+
+// Food given as name=qty, a name alone counts once
+func parseFood(args []string) (map[pkg.FoodType]int, error) {
+	food := make(map[pkg.FoodType]int)
+	for _, arg := range args {
+		name, value, found := strings.Cut(arg, "=")
+		qty := 1
+		if found {
+			var err error
+			if qty, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("invalid quantity in %v", arg)
+			}
+		}
+
+		kind, err := parseFoodType(name)
+		if err != nil {
+			return nil, err
+		}
+		food[kind] += qty
+	}
+	return food, nil
+}
+
+func parseEggs(args []string) (map[pkg.BirdID]int, error) {
+	eggs := make(map[pkg.BirdID]int)
+	for _, arg := range args {
+		bird, value, found := strings.Cut(arg, "=")
+		id, err := strconv.Atoi(strings.TrimPrefix(bird, "#"))
+		qty, err2 := strconv.Atoi(value)
+		if !found || err != nil || err2 != nil {
+			return nil, fmt.Errorf("expected bird=eggs, got %v", arg)
+		}
+		eggs[pkg.BirdID(id)] += qty
+	}
+	return eggs, nil
+}
+
+// The bird to pay for comes first, then food names and bird=eggs
+func parsePayment(args []string) (pkg.PayBirdCostPayload, error) {
+	var payment pkg.PayBirdCostPayload
+	if len(args) == 0 {
+		return payment, fmt.Errorf("expected the bird to pay for")
+	}
+
+	birds, err := parseBirds(args[:1])
+	if err != nil {
+		return payment, err
+	}
+	payment.BirdID = birds[0]
+
+	for _, arg := range args[1:] {
+		if strings.Contains(arg, "=") {
+			eggs, err := parseEggs([]string{arg})
+			if err != nil {
+				return payment, err
+			}
+			if payment.Eggs == nil {
+				payment.Eggs = make(map[pkg.BirdID]int)
+			}
+			for id, qty := range eggs {
+				payment.Eggs[id] += qty
+			}
+			continue
+		}
+
+		food, err := parseFoodType(arg)
+		if err != nil {
+			return payment, err
+		}
+		payment.Food = append(payment.Food, food)
+	}
+	return payment, nil
+}
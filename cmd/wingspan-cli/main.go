@@ -0,0 +1,266 @@
+// Plays a game from the terminal, connecting as a guest
+// unless an account is given
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"git.internal.com/wingspan/client"
+	"git.internal.com/wingspan/pkg"
+	"github.com/google/uuid"
+)
+
+const usage = `Commands:
+  keep <bird>...          keep starting birds
+  discard [food=qty]...   discard starting food
+  info                    show your board
+  hand                    show your hand and food
+  draw                    draw from the tray, then: tray <bird>...
+  deck                    draw from the deck
+  food                    gain food, then: choose <food=qty>...
+  eggs                    lay eggs, then: lay <bird=qty>...
+  play <bird>             play a bird, then if asked: pay <bird> [food]... [bird=eggs]...
+  power <bird>            activate a bird's power
+  end                     end your turn
+  queue, leave            join or leave the queue
+  quit`
+
+func main() {
+	addr := flag.String("addr", "ws://localhost:8080", "server to connect to")
+	username := flag.String("username", "", "account to log in with, plays as a guest when empty")
+	password := flag.String("password", "", "password of the account")
+	register := flag.Bool("register", false, "create the account first")
+	flag.Parse()
+
+	ctx := context.Background()
+	credentials := pkg.Credentials{Username: *username, Password: *password}
+
+	options := client.DefaultOptions()
+	if *username != "" {
+		options.Guest = false
+		if !*register {
+			options.Credentials = &credentials
+		}
+	}
+
+	c, err := client.Dial(ctx, *addr, options)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer c.Close()
+
+	if *register {
+		if err := c.Register(ctx, credentials); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if err := c.QueueAdd(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println("Type help for commands")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for event := range c.Events() {
+			react(ctx, c, event)
+		}
+	}()
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "quit" {
+			break
+		}
+		if err := run(ctx, c, args[0], args[1:]); err != nil {
+			fmt.Println("Error:", err)
+		}
+	}
+
+	c.Close()
+	<-done
+}
+
+func run(ctx context.Context, c *client.Client, command string, args []string) error {
+	switch command {
+	case "help":
+		fmt.Println(usage)
+		return nil
+	case "queue":
+		return c.QueueAdd(ctx)
+	case "leave":
+		return c.QueueRemove(ctx)
+	case "keep":
+		birds, err := parseBirds(args)
+		if err != nil {
+			return err
+		}
+		return c.ChooseBirds(ctx, birds)
+	case "discard":
+		food, err := parseFood(args)
+		if err != nil {
+			return err
+		}
+		return c.DiscardFood(ctx, food)
+	case "info":
+		return c.PlayerInfo(ctx, c.State().PlayerID)
+	case "hand":
+		state := c.State()
+		printBirds("Hand", state.Hand)
+		fmt.Println("Food:", formatFood(state.Food))
+		return nil
+	case "draw":
+		return c.DrawCards(ctx)
+	case "tray":
+		birds, err := parseBirds(args)
+		if err != nil {
+			return err
+		}
+		return c.DrawFromTray(ctx, birds)
+	case "deck":
+		return c.DrawFromDeck(ctx)
+	case "food":
+		return c.GainFood(ctx)
+	case "choose":
+		food, err := parseFood(args)
+		if err != nil {
+			return err
+		}
+		return c.ChooseFood(ctx, food)
+	case "eggs":
+		return c.LayEggs(ctx)
+	case "lay":
+		eggs, err := parseEggs(args)
+		if err != nil {
+			return err
+		}
+		return c.LayEggsOnBirds(ctx, eggs)
+	case "play", "power":
+		birds, err := parseBirds(args)
+		if err != nil || len(birds) != 1 {
+			return fmt.Errorf("expected one bird, got %v", args)
+		}
+		if command == "power" {
+			return c.ActivatePower(ctx, birds[0])
+		}
+		return c.PlayCard(ctx, birds[0])
+	case "pay":
+		payment, err := parsePayment(args)
+		if err != nil {
+			return err
+		}
+		return c.PayBirdCost(ctx, payment)
+	case "end":
+		return c.EndTurn(ctx)
+	}
+	return fmt.Errorf("unknown command %v, type help for commands", command)
+}
+
+// Prints what happened and what the player is expected to do next
+func react(ctx context.Context, c *client.Client, event client.Event) {
+	state := c.State()
+
+	switch payload := event.Payload.(type) {
+	case float64:
+		if event.Type == pkg.MatchFound {
+			fmt.Println("Match found, accepting")
+			if err := c.AcceptMatch(ctx); err != nil {
+				fmt.Println("Error:", err)
+			}
+		} else {
+			fmt.Printf("Server going down for maintenance in %.0fs\n", payload)
+		}
+	case client.ChooseCards:
+		if payload.Birds != nil {
+			printBirds("Starting birds", payload.Birds)
+			fmt.Println("Starting food:", formatFood(payload.Food))
+			fmt.Printf("You have %.0fs to keep birds, then discard a food per bird kept\n", payload.Time)
+		} else {
+			fmt.Printf("Choose %v of %v with tray\n", payload.Qty, payload.Cards)
+		}
+	case int:
+		fmt.Printf("Kept %v birds, discard %v food\n", payload, payload)
+	case pkg.GameStartedPayload:
+		fmt.Printf("Game started, you are %v (seed %v)\n", payload.ID, payload.Seed)
+	case client.RoundStarted:
+		fmt.Printf("Round %v, %v turns each\n", payload.Round, payload.Turns)
+	case client.StartTurn:
+		printBirds("Your turn, bird tray", payload.BirdTray)
+	case client.WaitTurn:
+		fmt.Println("Waiting for", payload.Current)
+	case pkg.GainFood:
+		fmt.Printf("Choose %v food from %v\n", payload.Amount, formatFood(payload.Available))
+	case client.ChooseBirds:
+		fmt.Printf("Lay %v eggs on %v\n", payload.Qty, payload.Birds)
+	case pkg.AvailableResources:
+		fmt.Printf("Pay for bird %v:", payload.BirdID)
+		if len(payload.Food) > 0 {
+			fmt.Print(" one of ", formatFoodTypes(payload.Food))
+		}
+		if payload.EggCost > 0 {
+			fmt.Printf(" %v eggs from %v", payload.EggCost, payload.Birds)
+		}
+		fmt.Println()
+	case client.BirdsDrawn:
+		if payload.Birds != nil {
+			printBirds("Drawn", payload.Birds)
+		} else {
+			fmt.Printf("%v birds drawn\n", payload.Count)
+		}
+	case client.FoodGained:
+		fmt.Printf("%v gained %v\n", player(state, payload.Player), formatFood(payload.Food))
+	case client.BirdPlayed:
+		if payload.Bird != nil {
+			fmt.Printf("%v played %v\n", player(state, payload.Player), formatBird(payload.Bird))
+		}
+	case map[pkg.BirdID]int:
+		fmt.Println("Eggs:", payload)
+	case map[pkg.FoodType]int:
+		if state.MyTurn() {
+			fmt.Println("Food:", formatFood(payload))
+		}
+	case client.PlayerInfo:
+		printBoard(payload)
+	case string:
+		fmt.Println(payload)
+	case *client.Error:
+		fmt.Println("Error:", payload)
+	default:
+		switch event.Type {
+		case pkg.WaitForMatch:
+			fmt.Println("Waiting for a match")
+		case pkg.WaitOtherPlayers:
+			fmt.Println("Waiting for the other players")
+		case pkg.MatchDeclined:
+			fmt.Println("Match declined")
+		case pkg.GameCanceled:
+			fmt.Println("Game canceled, queue to play again")
+		case pkg.RoundEnded:
+			fmt.Println("Round ended")
+		case client.Disconnected:
+			fmt.Println("Connection lost, reconnecting")
+		case client.Reconnected:
+			fmt.Println("Reconnected")
+		}
+	}
+}
+
+func player(state client.GameState, id uuid.UUID) string {
+	if id == state.PlayerID {
+		return "You"
+	}
+	return id.String()
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"git.internal.com/wingspan/client"
+	"git.internal.com/wingspan/pkg"
+)
+
+// Simulated player making random legal choices. Actions the
+// server rejects are counted and the turn is ended instead
+type bot struct {
+	client *client.Client
+	stats  *stats
+	rand   *rand.Rand
+
+	// set while an action waits for the server to prompt for it
+	pending string
+}
+
+func newBot(c *client.Client, stats *stats, seed int64) *bot {
+	return &bot{
+		client: c,
+		stats:  stats,
+		rand:   rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (b *bot) call(call func() error) error {
+	start := time.Now()
+	err := call()
+	b.stats.call(time.Since(start), err)
+	return err
+}
+
+// Plays games one after the other, giving up on a game when
+// no event arrives for idle
+func (b *bot) play(ctx context.Context, games int, idle time.Duration) {
+	for ; games > 0; games-- {
+		if err := b.call(func() error { return b.client.QueueAdd(ctx) }); err != nil {
+			return
+		}
+		if !b.game(ctx, idle) {
+			return
+		}
+	}
+}
+
+func (b *bot) game(ctx context.Context, idle time.Duration) bool {
+	timer := time.NewTimer(idle)
+	defer timer.Stop()
+
+	for {
+		select {
+		case event, ok := <-b.client.Events():
+			if !ok {
+				return false
+			}
+			if b.react(ctx, event) {
+				return true
+			}
+			timer.Reset(idle)
+		case <-timer.C:
+			b.stats.count(&b.stats.stalled)
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// Reports whether the game is over
+func (b *bot) react(ctx context.Context, event client.Event) bool {
+	state := b.client.State()
+
+	switch payload := event.Payload.(type) {
+	case float64:
+		if event.Type == pkg.MatchFound {
+			b.call(func() error { return b.client.AcceptMatch(ctx) })
+		}
+
+	case client.ChooseCards:
+		if payload.Birds != nil {
+			b.setup(ctx, payload)
+		} else {
+			b.drawFromTray(ctx, payload)
+		}
+
+	case client.StartTurn:
+		b.turn(ctx, state)
+
+	case pkg.GainFood:
+		b.chooseFood(ctx, payload)
+
+	case client.ChooseBirds:
+		b.layEggs(ctx, payload)
+
+	case pkg.AvailableResources:
+		b.pay(ctx, payload)
+
+	case client.BirdPlayed:
+		// played without having to choose how to pay
+		if b.pending == pkg.PayBirdCost && payload.Player == state.PlayerID {
+			b.endTurn(ctx)
+		}
+
+	case string:
+		if event.Type != pkg.GameOver {
+			break
+		}
+		b.stats.count(&b.stats.finished)
+		return true
+
+	default:
+		switch event.Type {
+		case pkg.GameCanceled, pkg.MatchDeclined:
+			b.stats.count(&b.stats.canceled)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b *bot) setup(ctx context.Context, cards client.ChooseCards) {
+	food := make([]pkg.FoodType, 0)
+	for kind, qty := range cards.Food {
+		for i := 0; i < qty; i++ {
+			food = append(food, kind)
+		}
+	}
+	if len(cards.Birds) == 0 || len(food) == 0 {
+		return
+	}
+
+	// a food is discarded for each bird kept
+	keep := 1 + b.rand.Intn(min(len(cards.Birds), len(food)))
+	birds := make([]pkg.BirdID, 0, keep)
+	for _, i := range b.rand.Perm(len(cards.Birds))[:keep] {
+		birds = append(birds, cards.Birds[i].ID)
+	}
+	discard := make(map[pkg.FoodType]int)
+	for _, i := range b.rand.Perm(len(food))[:keep] {
+		discard[food[i]]++
+	}
+
+	b.call(func() error { return b.client.ChooseBirds(ctx, birds) })
+	b.call(func() error { return b.client.DiscardFood(ctx, discard) })
+}
+
+func (b *bot) turn(ctx context.Context, state client.GameState) {
+	actions := []string{pkg.ChooseFood, pkg.ChooseCards}
+	if len(state.Played[state.PlayerID]) > 0 {
+		actions = append(actions, pkg.ChooseBirds)
+	}
+	if len(state.Hand) > 0 {
+		actions = append(actions, pkg.PayBirdCost)
+	}
+
+	b.pending = actions[b.rand.Intn(len(actions))]
+
+	var err error
+	switch b.pending {
+	case pkg.ChooseFood:
+		err = b.call(func() error { return b.client.GainFood(ctx) })
+	case pkg.ChooseCards:
+		err = b.call(func() error { return b.client.DrawCards(ctx) })
+	case pkg.ChooseBirds:
+		err = b.call(func() error { return b.client.LayEggs(ctx) })
+	case pkg.PayBirdCost:
+		bird := state.Hand[b.rand.Intn(len(state.Hand))]
+		err = b.call(func() error { return b.client.PlayCard(ctx, bird.ID) })
+	}
+
+	if err != nil {
+		b.endTurn(ctx)
+	}
+}
+
+func (b *bot) chooseFood(ctx context.Context, prompt pkg.GainFood) {
+	available := make([]pkg.FoodType, 0)
+	for kind, qty := range prompt.Available {
+		for i := 0; i < qty; i++ {
+			available = append(available, kind)
+		}
+	}
+
+	chosen := make(map[pkg.FoodType]int)
+	for _, i := range b.rand.Perm(len(available))[:min(prompt.Amount, len(available))] {
+		chosen[available[i]]++
+	}
+
+	b.call(func() error { return b.client.ChooseFood(ctx, chosen) })
+	b.endTurn(ctx)
+}
+
+func (b *bot) drawFromTray(ctx context.Context, prompt client.ChooseCards) {
+	chosen := make([]pkg.BirdID, 0, prompt.Qty)
+	for _, i := range b.rand.Perm(len(prompt.Cards))[:min(prompt.Qty, len(prompt.Cards))] {
+		chosen = append(chosen, prompt.Cards[i])
+	}
+
+	b.call(func() error { return b.client.DrawFromTray(ctx, chosen) })
+	b.endTurn(ctx)
+}
+
+func (b *bot) layEggs(ctx context.Context, prompt client.ChooseBirds) {
+	eggs := make(map[pkg.BirdID]int)
+	if len(prompt.Birds) > 0 {
+		for i := 0; i < prompt.Qty; i++ {
+			eggs[prompt.Birds[b.rand.Intn(len(prompt.Birds))]]++
+		}
+	}
+
+	b.call(func() error { return b.client.LayEggsOnBirds(ctx, eggs) })
+	b.endTurn(ctx)
+}
+
+func (b *bot) pay(ctx context.Context, cost pkg.AvailableResources) {
+	payment := pkg.PayBirdCostPayload{BirdID: cost.BirdID}
+	if len(cost.Food) > 0 {
+		payment.Food = []pkg.FoodType{cost.Food[b.rand.Intn(len(cost.Food))]}
+	}
+
+	if cost.EggCost > 0 {
+		payment.Eggs = make(map[pkg.BirdID]int)
+		left := cost.EggCost
+		for bird, eggs := range cost.Birds {
+			take := min(left, eggs)
+			if take > 0 {
+				payment.Eggs[bird] = take
+				left -= take
+			}
+		}
+	}
+
+	b.call(func() error { return b.client.PayBirdCost(ctx, payment) })
+	b.endTurn(ctx)
+}
+
+func (b *bot) endTurn(ctx context.Context) {
+	b.pending = ""
+	b.call(func() error { return b.client.EndTurn(ctx) })
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,116 @@
+// Drives simulated players through whole games against a server
+// and reports throughput, latency, errors and resource growth
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"git.internal.com/wingspan/client"
+	"git.internal.com/wingspan/pkg"
+)
+
+func main() {
+	addr := flag.String("addr", "", "server to load, an in process server when empty")
+	clients := flag.Int("clients", 100, "simulated players, a multiple of players")
+	players := flag.Int("players", 2, "players per match, must match the server's")
+	games := flag.Int("games", 1, "games each player plays")
+	ramp := flag.Duration("ramp", 5*time.Second, "time over which players connect")
+	idle := flag.Duration("idle", 30*time.Second, "silence after which a game counts as stalled")
+	interval := flag.Duration("interval", 5*time.Second, "how often progress is printed")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "seed of the players' choices")
+	flag.Parse()
+
+	if *clients <= 0 || *players <= 0 || *clients%*players != 0 {
+		fmt.Fprintln(os.Stderr, "clients must be a positive multiple of players")
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	runtime := newSampler(100 * time.Millisecond)
+
+	url := *addr
+	if url == "" {
+		var err error
+		if url, err = serve(*players); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("Serving in process on", url)
+	}
+
+	stats := newStats(*players)
+	options := client.DefaultOptions()
+	options.Reconnect = false
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(*interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				stats.progress(os.Stdout)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	delay := *ramp / time.Duration(*clients)
+
+	for i := 0; i < *clients && ctx.Err() == nil; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			c, err := client.Dial(ctx, url, options)
+			if err != nil {
+				stats.count(&stats.failed)
+				return
+			}
+			defer c.Close()
+
+			stats.count(&stats.clients)
+			newBot(c, stats, *seed+int64(i)).play(ctx, *games, *idle)
+		}(i)
+
+		time.Sleep(delay)
+	}
+
+	wg.Wait()
+	close(done)
+	runtime.stop()
+	stats.report(os.Stdout, runtime)
+}
+
+// Starts a server on a random local port. Players join as
+// guests and rate limits are left off so they do not skew results
+func serve(players int) (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+
+	server := pkg.NewServer()
+	server.SetLogger(pkg.NewLogger(os.Stderr, pkg.LogLevels{Default: pkg.LogWarn}))
+	server.Use(pkg.RequireAuth("Auth", "System"))
+	server.Register("Auth", pkg.NewAuth(nil, pkg.TOKEN_TTL))
+	server.Register("Queue", pkg.NewQueue(players))
+	server.Register("Matchmaker", pkg.NewMatchmaker(15*time.Second))
+	server.Register("Game", pkg.NewGameManager())
+
+	go http.Serve(listener, server.Handler())
+	return "ws://" + listener.Addr().String(), nil
+}
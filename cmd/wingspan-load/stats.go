@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"git.internal.com/wingspan/client"
+	"git.internal.com/wingspan/pkg"
+)
+
+// Names errors replied by the server after the value they came from
+var errorNames = func() map[string]string {
+	names := make(map[string]string)
+	for name, err := range map[string]error{
+		"ErrAlreadyInQueue":     pkg.ErrAlreadyInQueue,
+		"ErrBirdCardNotFound":   pkg.ErrBirdCardNotFound,
+		"ErrEggLimitReached":    pkg.ErrEggLimitReached,
+		"ErrFoodNotFound":       pkg.ErrFoodNotFound,
+		"ErrGameNotFound":       pkg.ErrGameNotFound,
+		"ErrGameOver":           pkg.ErrGameOver,
+		"ErrGameStopped":        pkg.ErrGameStopped,
+		"ErrHabitatNotFound":    pkg.ErrHabitatNotFound,
+		"ErrInternal":           pkg.ErrInternal,
+		"ErrMatchNotFound":      pkg.ErrMatchNotFound,
+		"ErrMethodNotFound":     pkg.ErrMethodNotFound,
+		"ErrNoPlayerReady":      pkg.ErrNoPlayerReady,
+		"ErrNotEnoughCards":     pkg.ErrNotEnoughCards,
+		"ErrNotEnoughEggs":      pkg.ErrNotEnoughEggs,
+		"ErrNotEnoughFood":      pkg.ErrNotEnoughFood,
+		"ErrNotSeatOwner":       pkg.ErrNotSeatOwner,
+		"ErrPlayerNotFound":     pkg.ErrPlayerNotFound,
+		"ErrQueueClosed":        pkg.ErrQueueClosed,
+		"ErrRateLimited":        pkg.ErrRateLimited,
+		"ErrRowIsFull":          pkg.ErrRowIsFull,
+		"ErrServerDraining":     pkg.ErrServerDraining,
+		"ErrServiceNotFound":    pkg.ErrServiceNotFound,
+		"ErrSessionNotFound":    pkg.ErrSessionNotFound,
+		"ErrTooManyViolations":  pkg.ErrTooManyViolations,
+		"ErrUnauthenticated":    pkg.ErrUnauthenticated,
+		"ErrUnexpectedValue":    pkg.ErrUnexpectedValue,
+		"ErrUnsupportedVersion": pkg.ErrUnsupportedVersion,
+	} {
+		names[err.Error()] = name
+	}
+	return names
+}()
+
+func errorName(err error) string {
+	var failure *client.Error
+	if !errors.As(err, &failure) {
+		return err.Error()
+	}
+	if failure.Validation != nil {
+		return "ValidationError"
+	}
+	if name, ok := errorNames[failure.Message]; ok {
+		return name
+	}
+	return failure.Message
+}
+
+type stats struct {
+	mutex     sync.Mutex
+	started   time.Time
+	latencies []time.Duration
+	errors    map[string]int
+	players   int
+	clients   int
+	failed    int
+	finished  int
+	canceled  int
+	stalled   int
+}
+
+func newStats(players int) *stats {
+	return &stats{
+		started: time.Now(),
+		errors:  make(map[string]int),
+		players: players,
+	}
+}
+
+// Every seat of a finished game is told it is over
+func (s *stats) games() int {
+	return s.finished / s.players
+}
+
+func (s *stats) call(latency time.Duration, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.latencies = append(s.latencies, latency)
+	if err != nil {
+		s.errors[errorName(err)]++
+	}
+}
+
+func (s *stats) count(counter *int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	*counter++
+}
+
+func (s *stats) progress(w io.Writer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	elapsed := time.Since(s.started).Seconds()
+	fmt.Fprintf(w, "%6.1fs  clients %v  calls %v (%.0f/s)  games %v\n",
+		elapsed, s.clients, len(s.latencies), float64(len(s.latencies))/elapsed, s.games())
+}
+
+func (s *stats) report(w io.Writer, runtime *sampler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	elapsed := time.Since(s.started)
+	seconds := elapsed.Seconds()
+
+	fmt.Fprintf(w, "\nRan %v clients for %v, %v failed to connect\n", s.clients, elapsed.Round(time.Millisecond), s.failed)
+	fmt.Fprintf(w, "Games      %v finished (%.2f/s), %v canceled, %v stalled\n",
+		s.games(), float64(s.games())/seconds, s.canceled, s.stalled)
+	fmt.Fprintf(w, "Calls      %v (%.0f/s)\n", len(s.latencies), float64(len(s.latencies))/seconds)
+
+	if len(s.latencies) > 0 {
+		sorted := append([]time.Duration(nil), s.latencies...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+		percentile := func(p float64) time.Duration {
+			return sorted[int(p*float64(len(sorted)-1))]
+		}
+		fmt.Fprintf(w, "Latency    p50 %v  p90 %v  p99 %v  max %v\n",
+			percentile(0.5), percentile(0.9), percentile(0.99), sorted[len(sorted)-1])
+	}
+
+	if len(s.errors) > 0 {
+		names := make([]string, 0, len(s.errors))
+		for name := range s.errors {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return s.errors[names[i]] > s.errors[names[j]] })
+
+		fmt.Fprintln(w, "Errors")
+		for _, name := range names {
+			fmt.Fprintf(w, "  %-24v %v\n", name, s.errors[name])
+		}
+	}
+
+	runtime.report(w)
+}
+
+// Samples goroutines and heap of this process, which
+// hosts the server too when it runs in process
+type sampler struct {
+	mutex      sync.Mutex
+	goroutines [3]int
+	heap       [3]uint64
+	done       chan struct{}
+}
+
+func newSampler(interval time.Duration) *sampler {
+	s := &sampler{done: make(chan struct{})}
+	goroutines, heap := s.read()
+	s.goroutines = [3]int{goroutines, goroutines, goroutines}
+	s.heap = [3]uint64{heap, heap, heap}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.sample()
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+func (s *sampler) read() (int, uint64) {
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+	return runtime.NumGoroutine(), memory.HeapAlloc
+}
+
+func (s *sampler) sample() {
+	goroutines, heap := s.read()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.goroutines[2], s.heap[2] = goroutines, heap
+	if goroutines > s.goroutines[1] {
+		s.goroutines[1] = goroutines
+	}
+	if heap > s.heap[1] {
+		s.heap[1] = heap
+	}
+}
+
+func (s *sampler) stop() {
+	close(s.done)
+	s.sample()
+}
+
+func (s *sampler) report(w io.Writer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	fmt.Fprintf(w, "Goroutines start %v  peak %v  end %v\n", s.goroutines[0], s.goroutines[1], s.goroutines[2])
+	fmt.Fprintf(w, "Heap       start %.1fMB  peak %.1fMB  end %.1fMB\n",
+		megabytes(s.heap[0]), megabytes(s.heap[1]), megabytes(s.heap[2]))
+}
+
+func megabytes(bytes uint64) float64 {
+	return float64(bytes) / (1 << 20)
+}
@@ -5,4 +5,8 @@ go 1.19
 require (
 	github.com/google/uuid v1.3.0
 	github.com/gorilla/websocket v1.5.0
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	golang.org/x/crypto v0.9.0
 )
+
+require github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
@@ -1,17 +1,68 @@
 package main
 
 import (
-	"time"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"git.internal.com/wingspan/pkg"
 )
 
 func main() {
+	config, err := pkg.LoadConfig(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	accounts, err := pkg.NewAccountStore(config.Accounts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	server := pkg.NewServer()
-	server.Register("Queue", pkg.NewQueue(2))
-	server.Register("Matchmaker", pkg.NewMatchmaker(15*time.Second))
-	server.Register("Game", pkg.NewGameManager())
+	server.SetLogger(pkg.NewLogger(os.Stderr, config.Logging))
+	server.Use(pkg.RequireAuth("Auth", "System"))
+	server.Register("Auth", pkg.NewAuth(accounts, config.TokenTTL))
+	server.Register("Queue", pkg.NewQueue(config.Players))
+	server.Register("Matchmaker", pkg.NewMatchmaker(config.MatchTimeout))
+	games := pkg.NewGameManagerWithRules(config.Rules)
+	games.SetSnapshotDir(config.SnapshotDir)
+	server.Register("Game", games)
+	server.AllowOrigins(config.AllowedOrigins...)
+	server.SetSocketOptions(config.Socket)
+	server.SetMaxSessions(config.MaxSessions)
+	server.SetRateLimits(config.RateLimits)
+	server.SetAdminToken(config.AdminToken)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+
+		print("Shutting down\n")
+		ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	fmt.Printf("Listening on %v\n", config.Addr)
+	if config.TLS() {
+		err = server.ListenTLS(config.Addr, config.TLSCert, config.TLSKey)
+	} else {
+		err = server.Listen(config.Addr)
+	}
 
-	print("Listening on 0.0.0.0:8080\n")
-	server.Listen("0.0.0.0:8080")
+	if err != http.ErrServerClosed {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	<-done
 }
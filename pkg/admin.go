@@ -0,0 +1,230 @@
+package pkg
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Lets operators inspect and intervene in live games:
+//
+//	GET    /admin/games                               active games with their players and turn
+//	GET    /admin/games/{id}                          full state of a game
+//	POST   /admin/games/{id}/end-turn                 ends the current turn
+//	POST   /admin/games/{id}/cancel                   cancels the game
+//	POST   /admin/games/{id}/players/{player}/kick    takes the seat away from a player
+//	GET    /admin/queue                               sessions waiting for a match
+//	DELETE /admin/queue                               removes every player from the queue
+//	GET    /admin/matches                             matches waiting to be accepted
+//	DELETE /admin/matches/{id}                        declines a match
+//
+// The admin token goes in the Authorization header as a bearer token
+type Admin struct {
+	server *Server
+	token  string
+}
+
+func NewAdmin(server *Server, token string) *Admin {
+	return &Admin{
+		server: server,
+		token:  token,
+	}
+}
+
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := a.server.logger.Subsystem("admin")
+
+	if !a.authorized(r) {
+		log.Warn("Unauthorized admin request", "remote", r.RemoteAddr, "method", r.Method, "path", r.URL.Path)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeJSON(w, http.StatusUnauthorized, errorResponse("", ErrUnauthenticated))
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		log.Warn("Admin intervention", "remote", r.RemoteAddr, "method", r.Method, "path", r.URL.Path)
+	}
+
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin"), "/"), "/")
+
+	switch {
+	case len(path) == 1 && path[0] == "games" && r.Method == http.MethodGet:
+		a.games(w)
+	case len(path) == 2 && path[0] == "games" && r.Method == http.MethodGet:
+		a.game(w, path[1])
+	case len(path) == 3 && path[0] == "games" && r.Method == http.MethodPost:
+		a.intervene(w, path[1], path[2])
+	case len(path) == 5 && path[0] == "games" && path[2] == "players" && path[4] == "kick" && r.Method == http.MethodPost:
+		a.kick(w, path[1], path[3])
+	case len(path) == 1 && path[0] == "queue" && r.Method == http.MethodGet:
+		a.queue(w)
+	case len(path) == 1 && path[0] == "queue" && r.Method == http.MethodDelete:
+		a.clearQueue(w)
+	case len(path) == 1 && path[0] == "matches" && r.Method == http.MethodGet:
+		a.matches(w)
+	case len(path) == 2 && path[0] == "matches" && r.Method == http.MethodDelete:
+		a.cancelMatch(w, path[1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *Admin) authorized(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	token := strings.TrimPrefix(header, "Bearer ")
+	return token != header && subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+func (a *Admin) games(w http.ResponseWriter) {
+	manager, ok := findService[*GameManager](a.server)
+	if !ok {
+		writeAdminError(w, ErrServiceNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, manager.Games())
+}
+
+func (a *Admin) game(w http.ResponseWriter, id string) {
+	manager, ok := findService[*GameManager](a.server)
+	if !ok {
+		writeAdminError(w, ErrServiceNotFound)
+		return
+	}
+
+	gameId, err := uuid.Parse(id)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse("", err))
+		return
+	}
+
+	game, err := manager.FindGame(gameId)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, game.Snapshot())
+}
+
+func (a *Admin) intervene(w http.ResponseWriter, id string, action string) {
+	manager, ok := findService[*GameManager](a.server)
+	if !ok {
+		writeAdminError(w, ErrServiceNotFound)
+		return
+	}
+
+	gameId, err := uuid.Parse(id)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse("", err))
+		return
+	}
+
+	switch action {
+	case "end-turn":
+		err = manager.ForceEndTurn(gameId)
+	case "cancel":
+		err = manager.CancelGame(gameId)
+	default:
+		err = ErrMethodNotFound
+	}
+
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Admin) kick(w http.ResponseWriter, id string, player string) {
+	manager, ok := findService[*GameManager](a.server)
+	if !ok {
+		writeAdminError(w, ErrServiceNotFound)
+		return
+	}
+
+	gameId, err := uuid.Parse(id)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse("", err))
+		return
+	}
+	playerId, err := uuid.Parse(player)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse("", err))
+		return
+	}
+
+	if err := manager.Kick(gameId, playerId); err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Admin) queue(w http.ResponseWriter) {
+	queue, ok := findService[*Queue](a.server)
+	if !ok {
+		writeAdminError(w, ErrServiceNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, queue.Sessions())
+}
+
+func (a *Admin) clearQueue(w http.ResponseWriter) {
+	queue, ok := findService[*Queue](a.server)
+	if !ok {
+		writeAdminError(w, ErrServiceNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"Removed": queue.Clear()})
+}
+
+func (a *Admin) matches(w http.ResponseWriter) {
+	matchmaker, ok := findService[*Matchmaker](a.server)
+	if !ok {
+		writeAdminError(w, ErrServiceNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, matchmaker.Matches())
+}
+
+func (a *Admin) cancelMatch(w http.ResponseWriter, id string) {
+	matchmaker, ok := findService[*Matchmaker](a.server)
+	if !ok {
+		writeAdminError(w, ErrServiceNotFound)
+		return
+	}
+
+	matchId, err := uuid.Parse(id)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse("", err))
+		return
+	}
+
+	if err := matchmaker.Cancel(matchId); err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// First registered service of type T
+func findService[T any](server *Server) (T, bool) {
+	for _, name := range server.order {
+		if service, ok := server.services[name].recv.(T); ok {
+			return service, true
+		}
+	}
+
+	var none T
+	return none, false
+}
+
+func writeAdminError(w http.ResponseWriter, err error) {
+	status := http.StatusConflict
+	switch err {
+	case ErrServiceNotFound, ErrMethodNotFound, ErrGameNotFound, ErrPlayerNotFound, ErrMatchNotFound:
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, errorResponse("", err))
+}
@@ -0,0 +1,324 @@
+package pkg_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"git.internal.com/wingspan/pkg"
+	"github.com/google/uuid"
+)
+
+func TestAdmin(t *testing.T) {
+	setup := func(t testing.TB) (*pkg.GameManager, *pkg.Queue, *pkg.Matchmaker, *httptest.Server) {
+		t.Helper()
+
+		manager := pkg.NewGameManager()
+		queue := pkg.NewQueue(2)
+		matchmaker := pkg.NewMatchmaker(time.Minute)
+		matchmaker.Subscribe(pkg.NewEventBus())
+
+		server := pkg.NewServer()
+		server.SetLogger(pkg.DiscardLogger())
+		server.Register("Queue", queue)
+		server.Register("Matchmaker", matchmaker)
+		server.Register("Game", manager)
+		server.SetAdminToken("secret")
+
+		http := httptest.NewServer(server.Handler())
+		t.Cleanup(http.Close)
+		return manager, queue, matchmaker, http
+	}
+
+	request := func(t testing.TB, server *httptest.Server, method, path string, dest any) int {
+		t.Helper()
+
+		req, _ := http.NewRequest(method, server.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+
+		response, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+
+		if dest != nil {
+			if err := json.NewDecoder(response.Body).Decode(dest); err != nil {
+				t.Fatalf("Failed decoding response: %v", err)
+			}
+		}
+		return response.StatusCode
+	}
+
+	// starts a game past the setup, returning its only summary
+	startGame := func(t testing.TB, manager *pkg.GameManager, server *httptest.Server, players ...*pkg.TestSocket) pkg.GameSummary {
+		t.Helper()
+
+		sockets := make([]pkg.Socket, 0)
+		for _, player := range players {
+			sockets = append(sockets, player)
+		}
+		manager.Create(nil, sockets)
+
+		for _, player := range players {
+			response := assertResponse(t, player, pkg.ChooseCards)
+
+			var payload pkg.ChooseResources
+			pkg.ParsePayload(response.Payload, &payload)
+			for food := range payload.Food {
+				if _, err := manager.DiscardFood(player, map[pkg.FoodType]int{food: 0}); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				break
+			}
+		}
+
+		var games []pkg.GameSummary
+		if status := request(t, server, http.MethodGet, "/admin/games", &games); status != http.StatusOK {
+			t.Fatalf("Expected status %v, got %v", http.StatusOK, status)
+		}
+		if len(games) != 1 {
+			t.Fatalf("Expected 1 game, got %v", len(games))
+		}
+		return games[0]
+	}
+
+	t.Run("requires token", func(t *testing.T) {
+		_, _, _, server := setup(t)
+
+		for _, header := range []string{"", "secret", "Bearer wrong"} {
+			req, _ := http.NewRequest(http.MethodGet, server.URL+"/admin/games", nil)
+			req.Header.Set("Authorization", header)
+
+			response, err := server.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+
+			if response.StatusCode != http.StatusUnauthorized {
+				t.Errorf("Expected status %v for %q, got %v", http.StatusUnauthorized, header, response.StatusCode)
+			}
+		}
+	})
+
+	t.Run("disabled without token", func(t *testing.T) {
+		server := pkg.NewServer()
+		http := httptest.NewServer(server.Handler())
+		defer http.Close()
+
+		response, err := http.Client().Get(http.URL + "/admin/games")
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+
+		if response.StatusCode == 200 || response.StatusCode == 401 {
+			t.Errorf("Expected admin API to be disabled, got status %v", response.StatusCode)
+		}
+	})
+
+	t.Run("lists games", func(t *testing.T) {
+		manager, _, _, server := setup(t)
+
+		p1 := pkg.NewTestSocket()
+		p2 := pkg.NewTestSocket()
+		game := startGame(t, manager, server, p1, p2)
+
+		if len(game.Players) != 2 {
+			t.Fatalf("Expected 2 players, got %v", len(game.Players))
+		}
+		if game.Current != game.Players[0].ID {
+			t.Errorf("Expected current player %v, got %v", game.Players[0].ID, game.Current)
+		}
+		for _, player := range game.Players {
+			if !player.Connected || player.Session == "" {
+				t.Errorf("Expected connected player with session, got %+v", player)
+			}
+		}
+	})
+
+	t.Run("dumps game", func(t *testing.T) {
+		manager, _, _, server := setup(t)
+		game := startGame(t, manager, server, pkg.NewTestSocket(), pkg.NewTestSocket())
+
+		var snapshot pkg.GameSnapshot
+		if status := request(t, server, http.MethodGet, "/admin/games/"+game.ID.String(), &snapshot); status != http.StatusOK {
+			t.Fatalf("Expected status %v, got %v", http.StatusOK, status)
+		}
+
+		if snapshot.ID != game.ID || len(snapshot.Players) != 2 || snapshot.DeckSize == 0 {
+			t.Errorf("Expected full state of game %v, got %+v", game.ID, snapshot)
+		}
+		if len(snapshot.Players[0].Birds) == 0 {
+			t.Error("Expected player hands in the snapshot")
+		}
+
+		if status := request(t, server, http.MethodGet, "/admin/games/"+uuid.NewString(), nil); status != http.StatusNotFound {
+			t.Errorf("Expected status %v, got %v", http.StatusNotFound, status)
+		}
+		if status := request(t, server, http.MethodGet, "/admin/games/nope", nil); status != http.StatusBadRequest {
+			t.Errorf("Expected status %v, got %v", http.StatusBadRequest, status)
+		}
+	})
+
+	t.Run("force ends turn", func(t *testing.T) {
+		manager, _, _, server := setup(t)
+
+		p1 := pkg.NewTestSocket()
+		p2 := pkg.NewTestSocket()
+		game := startGame(t, manager, server, p1, p2)
+
+		if status := request(t, server, http.MethodPost, "/admin/games/"+game.ID.String()+"/end-turn", nil); status != http.StatusNoContent {
+			t.Fatalf("Expected status %v, got %v", http.StatusNoContent, status)
+		}
+
+		var games []pkg.GameSummary
+		request(t, server, http.MethodGet, "/admin/games", &games)
+		if games[0].Current != game.Players[1].ID {
+			t.Errorf("Expected current player %v, got %v", game.Players[1].ID, games[0].Current)
+		}
+	})
+
+	t.Run("force ends turn only after setup", func(t *testing.T) {
+		manager, _, _, server := setup(t)
+
+		p1 := pkg.NewTestSocket()
+		p2 := pkg.NewTestSocket()
+		manager.Create(nil, []pkg.Socket{p1, p2})
+
+		response := assertResponse(t, p1, pkg.ChooseCards)
+		var payload pkg.ChooseResources
+		pkg.ParsePayload(response.Payload, &payload)
+		for food := range payload.Food {
+			manager.DiscardFood(p1, map[pkg.FoodType]int{food: 0})
+			break
+		}
+
+		var games []pkg.GameSummary
+		request(t, server, http.MethodGet, "/admin/games", &games)
+
+		path := "/admin/games/" + games[0].ID.String() + "/end-turn"
+		if status := request(t, server, http.MethodPost, path, nil); status != http.StatusConflict {
+			t.Errorf("Expected status %v, got %v", http.StatusConflict, status)
+		}
+		assertResponse(t, p1, pkg.WaitOtherPlayers)
+	})
+
+	t.Run("kicks player", func(t *testing.T) {
+		manager, _, _, server := setup(t)
+
+		p1 := pkg.NewTestSocket()
+		p2 := pkg.NewTestSocket()
+		game := startGame(t, manager, server, p1, p2)
+		kicked := game.Players[0]
+
+		path := "/admin/games/" + game.ID.String() + "/players/" + kicked.ID.String() + "/kick"
+		if status := request(t, server, http.MethodPost, path, nil); status != http.StatusNoContent {
+			t.Fatalf("Expected status %v, got %v", http.StatusNoContent, status)
+		}
+		if status := request(t, server, http.MethodPost, path, nil); status != http.StatusConflict {
+			t.Errorf("Expected status %v kicking twice, got %v", http.StatusConflict, status)
+		}
+
+		var games []pkg.GameSummary
+		request(t, server, http.MethodGet, "/admin/games", &games)
+		if player := games[0].Players[0]; !player.Kicked || player.Connected {
+			t.Errorf("Expected kicked and disconnected player, got %+v", player)
+		}
+		if games[0].Current == kicked.ID {
+			t.Error("Expected the kicked player's turn to end")
+		}
+
+		for _, socket := range []*pkg.TestSocket{p1, p2} {
+			if socket.Session().ID() != kicked.Session {
+				continue
+			}
+			if _, err := manager.PlayerInfo(socket, kicked.ID); err != pkg.ErrNotSeatOwner {
+				t.Errorf("Expected error %v, got %v", pkg.ErrNotSeatOwner, err)
+			}
+			if _, err := manager.EndTurn(socket); err != pkg.ErrGameNotFound {
+				t.Errorf("Expected error %v, got %v", pkg.ErrGameNotFound, err)
+			}
+		}
+	})
+
+	t.Run("cancels game", func(t *testing.T) {
+		manager, _, _, server := setup(t)
+
+		p1 := pkg.NewTestSocket()
+		p2 := pkg.NewTestSocket()
+		game := startGame(t, manager, server, p1, p2)
+
+		if status := request(t, server, http.MethodPost, "/admin/games/"+game.ID.String()+"/cancel", nil); status != http.StatusNoContent {
+			t.Fatalf("Expected status %v, got %v", http.StatusNoContent, status)
+		}
+
+		assertResponse(t, p1, pkg.GameCanceled)
+		assertResponse(t, p2, pkg.GameCanceled)
+
+		var games []pkg.GameSummary
+		request(t, server, http.MethodGet, "/admin/games", &games)
+		if len(games) != 0 {
+			t.Errorf("Expected no games, got %v", len(games))
+		}
+		if _, err := manager.EndTurn(p1); err != pkg.ErrGameNotFound {
+			t.Errorf("Expected error %v, got %v", pkg.ErrGameNotFound, err)
+		}
+	})
+
+	t.Run("clears queue", func(t *testing.T) {
+		_, queue, _, server := setup(t)
+
+		player := pkg.NewTestSocket()
+		queue.Add(player, nil)
+		assertResponse(t, player, pkg.WaitForMatch)
+
+		var sessions []string
+		request(t, server, http.MethodGet, "/admin/queue", &sessions)
+		if len(sessions) != 1 || sessions[0] != player.Session().ID() {
+			t.Errorf("Expected queued session %v, got %v", player.Session().ID(), sessions)
+		}
+
+		var cleared map[string]int
+		if status := request(t, server, http.MethodDelete, "/admin/queue", &cleared); status != http.StatusOK {
+			t.Fatalf("Expected status %v, got %v", http.StatusOK, status)
+		}
+		if cleared["Removed"] != 1 || queue.Len() != 0 {
+			t.Errorf("Expected 1 player removed, got %v with %v left", cleared["Removed"], queue.Len())
+		}
+		assertResponse(t, player, pkg.Error)
+	})
+
+	t.Run("cancels match", func(t *testing.T) {
+		_, _, matchmaker, server := setup(t)
+
+		p1 := pkg.NewTestSocket()
+		p2 := pkg.NewTestSocket()
+		matchmaker.CreateMatch(nil, []pkg.Socket{p1, p2})
+		assertResponse(t, p1, pkg.MatchFound)
+		assertResponse(t, p2, pkg.MatchFound)
+
+		var matches []pkg.MatchSummary
+		request(t, server, http.MethodGet, "/admin/matches", &matches)
+		if len(matches) != 1 || len(matches[0].Sessions) != 2 {
+			t.Fatalf("Expected 1 match of 2 players, got %+v", matches)
+		}
+
+		path := "/admin/matches/" + matches[0].ID.String()
+		if status := request(t, server, http.MethodDelete, path, nil); status != http.StatusNoContent {
+			t.Fatalf("Expected status %v, got %v", http.StatusNoContent, status)
+		}
+		if status := request(t, server, http.MethodDelete, path, nil); status != http.StatusNotFound {
+			t.Errorf("Expected status %v, got %v", http.StatusNotFound, status)
+		}
+
+		assertResponse(t, p1, pkg.MatchDeclined)
+		assertResponse(t, p2, pkg.MatchDeclined)
+		if _, err := matchmaker.Accept(p1); err != pkg.ErrMatchNotFound {
+			t.Errorf("Expected error %v, got %v", pkg.ErrMatchNotFound, err)
+		}
+	})
+}
@@ -0,0 +1,338 @@
+package pkg
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const TOKEN_TTL = 24 * time.Hour
+
+var (
+	ErrInvalidCredentials   = errors.New("Invalid username or password")
+	ErrUsernameTaken        = errors.New("Username already taken")
+	ErrInvalidToken         = errors.New("Invalid or expired token")
+	ErrUnauthenticated      = errors.New("Authentication required")
+	ErrAlreadyAuthenticated = errors.New("Already authenticated")
+	ErrAccountsDisabled     = errors.New("Accounts are disabled, only guests may join")
+)
+
+type Account struct {
+	ID       string
+	Username string
+	Guest    bool
+}
+
+type Credentials struct {
+	Username string
+	Password string
+}
+
+type AuthenticatedPayload struct {
+	ID       string
+	Username string
+	Guest    bool
+	Token    string
+}
+
+type storedAccount struct {
+	Account
+	Hash []byte
+}
+
+// Registered accounts, persisted as JSON to path when it is given
+type AccountStore struct {
+	path     string
+	mutex    sync.Mutex
+	accounts map[string]*storedAccount
+}
+
+func NewAccountStore(path string) (*AccountStore, error) {
+	store := &AccountStore{
+		path:     path,
+		accounts: make(map[string]*storedAccount),
+	}
+
+	if path == "" {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &store.accounts); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *AccountStore) Create(username, password string) (*Account, error) {
+	username = strings.TrimSpace(username)
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := strings.ToLower(username)
+	if _, ok := s.accounts[key]; ok {
+		return nil, ErrUsernameTaken
+	}
+
+	stored := &storedAccount{
+		Account: Account{ID: uuid.NewString(), Username: username},
+		Hash:    hash,
+	}
+	s.accounts[key] = stored
+
+	if err := s.save(); err != nil {
+		delete(s.accounts, key)
+		return nil, err
+	}
+
+	return &stored.Account, nil
+}
+
+func (s *AccountStore) Verify(username, password string) (*Account, error) {
+	s.mutex.Lock()
+	stored, ok := s.accounts[strings.ToLower(strings.TrimSpace(username))]
+	s.mutex.Unlock()
+
+	if !ok {
+		// as slow as a wrong password, or timing tells which usernames exist
+		bcrypt.CompareHashAndPassword(unknownHash(), []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword(stored.Hash, []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &stored.Account, nil
+}
+
+var (
+	unknownOnce sync.Once
+	unknown     []byte
+)
+
+// Hash compared against when the username is unknown
+func unknownHash() []byte {
+	unknownOnce.Do(func() {
+		unknown, _ = bcrypt.GenerateFromPassword([]byte("unknown"), bcrypt.DefaultCost)
+	})
+	return unknown
+}
+
+// Whether the directory the store is persisted to is still there,
+// stores kept in memory only are always healthy
+func (s *AccountStore) CheckHealth() error {
+	if s.path == "" {
+		return nil
+	}
+
+	_, err := os.Stat(filepath.Dir(s.path))
+	return err
+}
+
+// Writes to a temporary file first so a crash does not leave the store truncated
+func (s *AccountStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(s.accounts)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+type authToken struct {
+	account *Account
+	expires time.Time
+}
+
+// Binds connections to accounts. Every successful handshake hands out
+// a token which authenticates later connections without credentials
+type Auth struct {
+	ttl    time.Duration
+	store  *AccountStore
+	mutex  sync.Mutex
+	tokens map[string]authToken
+	swept  time.Time
+}
+
+func NewAuth(store *AccountStore, ttl time.Duration) *Auth {
+	return &Auth{
+		ttl:    ttl,
+		store:  store,
+		tokens: make(map[string]authToken),
+	}
+}
+
+// Auth without a store only lets guests in, there is nothing to check
+func (a *Auth) CheckHealth() error {
+	if a.store == nil {
+		return nil
+	}
+	return a.store.CheckHealth()
+}
+
+func (a *Auth) Guest(socket Socket) (*Message, error) {
+	account := &Account{
+		ID:       uuid.NewString(),
+		Username: "guest-" + uuid.NewString()[:8],
+		Guest:    true,
+	}
+	return nil, a.authenticate(socket, account)
+}
+
+func (a *Auth) Register(socket Socket, credentials Credentials) (*Message, error) {
+	if socket.Session().Authenticated() {
+		return nil, ErrAlreadyAuthenticated
+	}
+	if a.store == nil {
+		return nil, ErrAccountsDisabled
+	}
+
+	account, err := a.store.Create(credentials.Username, credentials.Password)
+	if err != nil {
+		return nil, err
+	}
+	return nil, a.authenticate(socket, account)
+}
+
+func (a *Auth) Login(socket Socket, credentials Credentials) (*Message, error) {
+	if a.store == nil {
+		return nil, ErrAccountsDisabled
+	}
+
+	account, err := a.store.Verify(credentials.Username, credentials.Password)
+	if err != nil {
+		return nil, err
+	}
+	return nil, a.authenticate(socket, account)
+}
+
+func (a *Auth) Token(socket Socket, token string) (*Message, error) {
+	a.mutex.Lock()
+	stored, ok := a.tokens[token]
+	if ok && time.Now().After(stored.expires) {
+		delete(a.tokens, token)
+		ok = false
+	}
+	a.mutex.Unlock()
+
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	return nil, a.authenticate(socket, stored.account)
+}
+
+func (a *Auth) authenticate(socket Socket, account *Account) error {
+	if err := socket.Session().Authenticate(account); err != nil {
+		return err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	a.mutex.Lock()
+	a.sweep(now)
+	a.tokens[token] = authToken{account: account, expires: now.Add(a.ttl)}
+	a.mutex.Unlock()
+
+	_, err = reply(socket, Response{
+		Type: Authenticated,
+		Payload: AuthenticatedPayload{
+			ID:       account.ID,
+			Username: account.Username,
+			Guest:    account.Guest,
+			Token:    token,
+		},
+	})
+	return err
+}
+
+// Drops expired tokens, at most once per ttl so issuing stays cheap.
+// Must be called with the lock held
+func (a *Auth) sweep(now time.Time) {
+	if now.Before(a.swept.Add(a.ttl)) {
+		return
+	}
+	a.swept = now
+
+	for token, stored := range a.tokens {
+		if now.After(stored.expires) {
+			delete(a.tokens, token)
+		}
+	}
+}
+
+// Tokens handed out that were not swept yet
+func (a *Auth) Tokens() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return len(a.tokens)
+}
+
+func newToken() (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// Rejects messages from sessions that did not authenticate,
+// except for the public services and internal follow ups
+func RequireAuth(public ...string) Interceptor {
+	allowed := make(map[string]bool)
+	for _, service := range public {
+		allowed[service] = true
+	}
+
+	return func(next Handler) Handler {
+		return func(socket Socket, message Message) (*Message, error) {
+			if socket == nil || message.internal {
+				return next(socket, message)
+			}
+
+			service, _, _ := strings.Cut(message.Method, ".")
+			if !allowed[service] && !socket.Session().Authenticated() {
+				return nil, ErrUnauthenticated
+			}
+
+			return next(socket, message)
+		}
+	}
+}
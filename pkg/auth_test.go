@@ -0,0 +1,217 @@
+package pkg_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.internal.com/wingspan/pkg"
+)
+
+func authenticated(t testing.TB, socket *pkg.TestSocket) pkg.AuthenticatedPayload {
+	t.Helper()
+
+	var payload pkg.AuthenticatedPayload
+	response := assertResponse(t, socket, pkg.Authenticated)
+	if err := pkg.ParsePayload(response.Payload, &payload); err != nil {
+		t.Fatalf("Could not parse payload: %v", err)
+	}
+	return payload
+}
+
+func TestAccountStore(t *testing.T) {
+	t.Run("persists accounts", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "accounts.json")
+
+		store, err := pkg.NewAccountStore(path)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		account, err := store.Create("Alice", "secret")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		reloaded, err := pkg.NewAccountStore(path)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		verified, err := reloaded.Verify("alice", "secret")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if verified.ID != account.ID {
+			t.Errorf("Expected %v, got %v", account.ID, verified.ID)
+		}
+	})
+
+	t.Run("rejects wrong password", func(t *testing.T) {
+		store, _ := pkg.NewAccountStore("")
+		store.Create("alice", "secret")
+
+		if _, err := store.Verify("alice", "wrong"); err != pkg.ErrInvalidCredentials {
+			t.Errorf("Expected error %v, got %v", pkg.ErrInvalidCredentials, err)
+		}
+		if _, err := store.Verify("bob", "secret"); err != pkg.ErrInvalidCredentials {
+			t.Errorf("Expected error %v, got %v", pkg.ErrInvalidCredentials, err)
+		}
+	})
+
+	t.Run("unknown usernames take as long as wrong passwords", func(t *testing.T) {
+		store, _ := pkg.NewAccountStore("")
+		store.Create("alice", "secret")
+		store.Verify("bob", "secret")
+
+		start := time.Now()
+		store.Verify("alice", "wrong")
+		wrong := time.Since(start)
+
+		start = time.Now()
+		store.Verify("bob", "secret")
+		unknown := time.Since(start)
+
+		if unknown < wrong/4 {
+			t.Errorf("Expected unknown username to take about %v, took %v", wrong, unknown)
+		}
+	})
+
+	t.Run("rejects taken username", func(t *testing.T) {
+		store, _ := pkg.NewAccountStore("")
+		store.Create("alice", "secret")
+
+		if _, err := store.Create("ALICE", "other"); err != pkg.ErrUsernameTaken {
+			t.Errorf("Expected error %v, got %v", pkg.ErrUsernameTaken, err)
+		}
+	})
+}
+
+func TestAuth(t *testing.T) {
+	store, _ := pkg.NewAccountStore("")
+	auth := pkg.NewAuth(store, pkg.TOKEN_TTL)
+
+	t.Run("guest", func(t *testing.T) {
+		socket := pkg.NewTestSocket()
+
+		if _, err := auth.Guest(socket); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		payload := authenticated(t, socket)
+		if !payload.Guest || payload.Token == "" {
+			t.Errorf("Expected guest with token, got %v", payload)
+		}
+		if socket.Session().ID() != payload.ID {
+			t.Errorf("Expected session %v, got %v", payload.ID, socket.Session().ID())
+		}
+	})
+
+	t.Run("register and login", func(t *testing.T) {
+		first := pkg.NewTestSocket()
+		second := pkg.NewTestSocket()
+		credentials := pkg.Credentials{Username: "bob", Password: "secret"}
+
+		if _, err := auth.Register(first, credentials); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := auth.Login(second, credentials); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if first.Session().ID() != second.Session().ID() {
+			t.Errorf("Expected same identity, got %v and %v", first.Session().ID(), second.Session().ID())
+		}
+	})
+
+	t.Run("token", func(t *testing.T) {
+		first := pkg.NewTestSocket()
+		second := pkg.NewTestSocket()
+
+		auth.Guest(first)
+		payload := authenticated(t, first)
+
+		if _, err := auth.Token(second, payload.Token); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if second.Session().ID() != payload.ID {
+			t.Errorf("Expected %v, got %v", payload.ID, second.Session().ID())
+		}
+		if _, err := auth.Token(pkg.NewTestSocket(), "invalid"); err != pkg.ErrInvalidToken {
+			t.Errorf("Expected error %v, got %v", pkg.ErrInvalidToken, err)
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		auth := pkg.NewAuth(store, 0)
+		socket := pkg.NewTestSocket()
+
+		auth.Guest(socket)
+		payload := authenticated(t, socket)
+
+		if _, err := auth.Token(pkg.NewTestSocket(), payload.Token); err != pkg.ErrInvalidToken {
+			t.Errorf("Expected error %v, got %v", pkg.ErrInvalidToken, err)
+		}
+	})
+
+	t.Run("sweeps expired tokens", func(t *testing.T) {
+		auth := pkg.NewAuth(store, 0)
+
+		for i := 0; i < 3; i++ {
+			auth.Guest(pkg.NewTestSocket())
+			time.Sleep(time.Millisecond)
+		}
+
+		if tokens := auth.Tokens(); tokens != 1 {
+			t.Errorf("Expected only the last token kept, got %v", tokens)
+		}
+	})
+
+	t.Run("authenticates once", func(t *testing.T) {
+		socket := pkg.NewTestSocket()
+		auth.Guest(socket)
+
+		if _, err := auth.Guest(socket); err != pkg.ErrAlreadyAuthenticated {
+			t.Errorf("Expected error %v, got %v", pkg.ErrAlreadyAuthenticated, err)
+		}
+	})
+
+	t.Run("guests only without a store", func(t *testing.T) {
+		auth := pkg.NewAuth(nil, pkg.TOKEN_TTL)
+		credentials := pkg.Credentials{Username: "bob", Password: "secret"}
+
+		if _, err := auth.Register(pkg.NewTestSocket(), credentials); err != pkg.ErrAccountsDisabled {
+			t.Errorf("Expected error %v, got %v", pkg.ErrAccountsDisabled, err)
+		}
+		if _, err := auth.Login(pkg.NewTestSocket(), credentials); err != pkg.ErrAccountsDisabled {
+			t.Errorf("Expected error %v, got %v", pkg.ErrAccountsDisabled, err)
+		}
+		if _, err := auth.Guest(pkg.NewTestSocket()); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+}
+
+func TestRequireAuth(t *testing.T) {
+	handler := pkg.Chain(func(socket pkg.Socket, message pkg.Message) (*pkg.Message, error) {
+		return nil, nil
+	}, pkg.RequireAuth("Auth"))
+
+	socket := pkg.NewTestSocket()
+
+	if _, err := handler(socket, pkg.Message{Method: "Queue.Add"}); err != pkg.ErrUnauthenticated {
+		t.Errorf("Expected error %v, got %v", pkg.ErrUnauthenticated, err)
+	}
+	if _, err := handler(socket, pkg.Message{Method: "Auth.Guest"}); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if _, err := handler(nil, pkg.Message{Method: "Game.Create"}); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	socket.Session().Authenticate(&pkg.Account{ID: "player"})
+
+	if _, err := handler(socket, pkg.Message{Method: "Queue.Add"}); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package pkg
+
+import (
+	"container/list"
+	"sync"
+)
+
+type Event struct {
+	Topic   string
+	Payload any
+}
+
+// Services implementing it are handed the server's bus when registered
+type EventSubscriber interface {
+	Subscribe(bus *EventBus)
+}
+
+// Delivers published events asynchronously, one at a time and in
+// the order they were published. Publishing never blocks
+type EventBus struct {
+	mutex       sync.Mutex
+	cond        *sync.Cond
+	closed      bool
+	events      *list.List
+	subscribers map[string][]func(Event)
+}
+
+func NewEventBus() *EventBus {
+	bus := &EventBus{
+		events:      list.New(),
+		subscribers: make(map[string][]func(Event)),
+	}
+	bus.cond = sync.NewCond(&bus.mutex)
+
+	go bus.deliver()
+	return bus
+}
+
+func (b *EventBus) Subscribe(topic string, handler func(Event)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.subscribers[topic] = append(b.subscribers[topic], handler)
+}
+
+// Safe to call on a nil bus, in which case the event is dropped
+func (b *EventBus) Publish(topic string, payload any) {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.events.PushBack(Event{Topic: topic, Payload: payload})
+	b.cond.Signal()
+}
+
+// Stops accepting events, pending ones are still delivered
+func (b *EventBus) Close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.closed = true
+	b.cond.Broadcast()
+}
+
+func (b *EventBus) deliver() {
+	for {
+		b.mutex.Lock()
+		for b.events.Len() == 0 && !b.closed {
+			b.cond.Wait()
+		}
+
+		if b.events.Len() == 0 {
+			b.mutex.Unlock()
+			return
+		}
+
+		event := b.events.Remove(b.events.Front()).(Event)
+		handlers := append([]func(Event){}, b.subscribers[event.Topic]...)
+		b.mutex.Unlock()
+
+		for _, handler := range handlers {
+			handler(event)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package pkg_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"git.internal.com/wingspan/pkg"
+)
+
+func TestEventBus(t *testing.T) {
+	t.Run("delivers in order", func(t *testing.T) {
+		bus := pkg.NewEventBus()
+		defer bus.Close()
+
+		received := make(chan any, 10)
+		bus.Subscribe("topic", func(event pkg.Event) {
+			received <- event.Payload
+		})
+
+		for i := 0; i < 10; i++ {
+			bus.Publish("topic", i)
+		}
+
+		for i := 0; i < 10; i++ {
+			select {
+			case value := <-received:
+				if value != i {
+					t.Errorf("Expected %v, got %v", i, value)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Expected event to be delivered")
+			}
+		}
+	})
+
+	t.Run("publish from handler", func(t *testing.T) {
+		bus := pkg.NewEventBus()
+		defer bus.Close()
+
+		received := make(chan string, 3)
+		bus.Subscribe("first", func(event pkg.Event) {
+			received <- event.Topic
+			bus.Publish("second", nil)
+		})
+		bus.Subscribe("second", func(event pkg.Event) {
+			received <- event.Topic
+		})
+
+		bus.Publish("first", nil)
+		bus.Publish("first", nil)
+
+		topics := make([]string, 0)
+		for i := 0; i < 4; i++ {
+			select {
+			case topic := <-received:
+				topics = append(topics, topic)
+			case <-time.After(time.Second):
+				t.Fatal("Expected event to be delivered")
+			}
+		}
+
+		expected := []string{"first", "first", "second", "second"}
+		if !reflect.DeepEqual(topics, expected) {
+			t.Errorf("Expected %v, got %v", expected, topics)
+		}
+	})
+
+	t.Run("nil bus", func(t *testing.T) {
+		var bus *pkg.EventBus
+		bus.Publish("topic", nil)
+	})
+
+	t.Run("closed bus", func(t *testing.T) {
+		bus := pkg.NewEventBus()
+
+		received := make(chan pkg.Event, 1)
+		bus.Subscribe("topic", func(event pkg.Event) {
+			received <- event
+		})
+
+		bus.Close()
+		bus.Publish("topic", nil)
+
+		select {
+		case event := <-received:
+			t.Errorf("Expected no events after close, got %v", event)
+		case <-time.After(10 * time.Millisecond):
+		}
+	})
+}
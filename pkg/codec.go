@@ -0,0 +1,153 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Encodes messages and responses on the wire, negotiated
+// through the websocket subprotocol
+type Codec interface {
+	// Subprotocol clients request to use the codec
+	Name() string
+	// Websocket frame type messages are sent as
+	FrameType() int
+	Marshal(value any) ([]byte, error)
+	Unmarshal(data []byte, value any) error
+}
+
+var (
+	JSONCodec    Codec = jsonCodec{}
+	MsgpackCodec Codec = msgpackCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) FrameType() int {
+	return websocket.TextMessage
+}
+
+func (jsonCodec) Marshal(value any) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (jsonCodec) Unmarshal(data []byte, value any) error {
+	return json.Unmarshal(data, value)
+}
+
+// Responses are packed directly, their payloads as well when they are
+// plain values such as acks, errors and game over results. Other payloads
+// and everything decoded go through their JSON representation, so custom
+// JSON marshalers are honored and both codecs decode to the same values.
+// That costs a JSON encode and decode on top of the MessagePack one,
+// see BenchmarkCodec
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (msgpackCodec) FrameType() int {
+	return websocket.BinaryMessage
+}
+
+func (msgpackCodec) Marshal(value any) ([]byte, error) {
+	response, ok := value.(Response)
+	if !ok {
+		generic, err := transcode(value)
+		if err != nil {
+			return nil, err
+		}
+		return packCompact(generic)
+	}
+
+	if !plain(response.Payload) {
+		payload, err := transcode(response.Payload)
+		if err != nil {
+			return nil, err
+		}
+		response.Payload = payload
+	}
+
+	return packCompact(response)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, value any) error {
+	var generic any
+	if err := msgpack.Unmarshal(data, &generic); err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(generic)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(encoded, value)
+}
+
+func packCompact(value any) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := msgpack.NewEncoder(&buffer)
+	encoder.UseCompactInts(true)
+
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Whether the value packs the same as its JSON representation
+func plain(value any) bool {
+	switch value.(type) {
+	case nil, string, bool, int, int64, uint64, float64:
+		return true
+	}
+	return false
+}
+
+// Decodes the JSON representation of value into maps, slices and scalars
+func transcode(value any) (any, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var generic any
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return compactNumbers(generic), nil
+}
+
+// Turns JSON numbers into integers whenever possible
+// so they are packed in as few bytes as needed
+func compactNumbers(value any) any {
+	switch value := value.(type) {
+	case json.Number:
+		if integer, err := value.Int64(); err == nil {
+			return integer
+		}
+		float, _ := value.Float64()
+		return float
+	case []any:
+		for i, item := range value {
+			value[i] = compactNumbers(item)
+		}
+	case map[string]any:
+		for key, item := range value {
+			value[key] = compactNumbers(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,176 @@
+package pkg_test
+
+import (
+	"reflect"
+	"testing"
+
+	"git.internal.com/wingspan/pkg"
+	"github.com/google/uuid"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestCodec(t *testing.T) {
+	codecs := []pkg.Codec{pkg.JSONCodec, pkg.MsgpackCodec}
+
+	roundTrip := func(t testing.TB, codec pkg.Codec, response pkg.Response) pkg.Response {
+		t.Helper()
+
+		data, err := codec.Marshal(response)
+		if err != nil {
+			t.Fatalf("Could not encode with %v: %v", codec.Name(), err)
+		}
+
+		var decoded pkg.Response
+		if err := codec.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Could not decode with %v: %v", codec.Name(), err)
+		}
+		return decoded
+	}
+
+	t.Run("player info", func(t *testing.T) {
+		tray := pkg.NewBirdTray(3)
+		tray.Refill(pkg.NewDeck(10))
+
+		board := pkg.NewBoard()
+		board.PlayBird(&pkg.Bird{ID: 3, Name: "Owl", Habitat: pkg.Wetland, EggCount: 2})
+
+		payload := pkg.PlayerInfoPayload{
+			Turn:       2,
+			Round:      1,
+			MaxTurns:   7,
+			Duration:   60,
+			TimeLeft:   12.5,
+			Current:    uuid.New(),
+			BirdTray:   tray.Birds(),
+			TurnOrder:  []*pkg.Player{{ID: uuid.New()}},
+			BirdFeeder: map[pkg.FoodType]int{pkg.Fish: 2, pkg.Seed: 1},
+			Birds:      []*pkg.Bird{{ID: 9, FoodCost: map[pkg.FoodType]int{pkg.Rodent: 1}}},
+			Board:      board,
+			Food:       map[pkg.FoodType]int{pkg.Fruit: 3},
+		}
+
+		results := make([]pkg.PlayerInfoPayload, 0)
+		for _, codec := range codecs {
+			response := roundTrip(t, codec, pkg.Response{ID: "1", Type: pkg.PlayerInfo, Payload: payload})
+			if response.ID != "1" || response.Type != pkg.PlayerInfo {
+				t.Errorf("%v: unexpected response %v", codec.Name(), response)
+			}
+
+			var decoded pkg.PlayerInfoPayload
+			if err := pkg.ParsePayload(response.Payload, &decoded); err != nil {
+				t.Fatalf("%v: could not parse payload: %v", codec.Name(), err)
+			}
+			results = append(results, decoded)
+		}
+
+		if !reflect.DeepEqual(results[0], results[1]) {
+			t.Errorf("Expected %+v, got %+v", results[0], results[1])
+		}
+		if results[1].TimeLeft != 12.5 || results[1].BirdFeeder[pkg.Fish] != 2 {
+			t.Errorf("Unexpected payload %+v", results[1])
+		}
+	})
+
+	t.Run("round started", func(t *testing.T) {
+		tray := pkg.NewBirdTray(3)
+		tray.Refill(pkg.NewDeck(10))
+
+		payload := pkg.RoundStartedPayload{
+			Round:     1,
+			Turns:     7,
+			BirdTray:  tray,
+			TurnOrder: []*pkg.Player{{ID: uuid.New()}, {ID: uuid.New()}},
+		}
+
+		results := make([]pkg.Response, 0)
+		for _, codec := range codecs {
+			results = append(results, roundTrip(t, codec, pkg.Response{Type: pkg.RoundStarted, Payload: payload}))
+		}
+
+		if !reflect.DeepEqual(results[0], results[1]) {
+			t.Errorf("Expected %+v, got %+v", results[0], results[1])
+		}
+	})
+
+	t.Run("message params", func(t *testing.T) {
+		data, err := pkg.MsgpackCodec.Marshal(pkg.Message{
+			ID:     "2",
+			Method: "Game.PayBirdCost",
+			Params: pkg.PayBirdCostPayload{BirdID: 4, Food: []pkg.FoodType{pkg.Fish}},
+		})
+		if err != nil {
+			t.Fatalf("Could not encode message: %v", err)
+		}
+
+		var message pkg.Message
+		if err := pkg.MsgpackCodec.Unmarshal(data, &message); err != nil {
+			t.Fatalf("Could not decode message: %v", err)
+		}
+
+		var params pkg.PayBirdCostPayload
+		if err := pkg.ParsePayload(message.Params, &params); err != nil {
+			t.Fatalf("Could not parse params: %v", err)
+		}
+		if message.ID != "2" || params.BirdID != 4 || params.Food[0] != pkg.Fish {
+			t.Errorf("Unexpected message %+v with params %+v", message, params)
+		}
+	})
+
+	t.Run("plain payloads", func(t *testing.T) {
+		responses := []pkg.Response{
+			{ID: "3", Type: pkg.Ack},
+			{Type: pkg.GameOver, Payload: "You win"},
+			{Seq: 300, Type: pkg.Error, Payload: "Game over"},
+		}
+
+		for _, response := range responses {
+			data, err := pkg.MsgpackCodec.Marshal(response)
+			if err != nil {
+				t.Fatalf("Could not encode %v: %v", response.Type, err)
+			}
+
+			var fields map[string]any
+			if err := msgpack.Unmarshal(data, &fields); err != nil {
+				t.Fatalf("Could not decode %v: %v", response.Type, err)
+			}
+			if _, ok := fields["ID"]; ok != (response.ID != "") {
+				t.Errorf("Expected ID only when set, got %v", fields)
+			}
+			if _, ok := fields["Seq"]; ok != (response.Seq != 0) {
+				t.Errorf("Expected Seq only when set, got %v", fields)
+			}
+
+			if decoded := roundTrip(t, pkg.MsgpackCodec, response); !reflect.DeepEqual(decoded, roundTrip(t, pkg.JSONCodec, response)) {
+				t.Errorf("Expected both codecs to decode %+v alike, got %+v", response, decoded)
+			}
+		}
+	})
+}
+
+func BenchmarkCodec(b *testing.B) {
+	tray := pkg.NewBirdTray(3)
+	tray.Refill(pkg.NewDeck(10))
+
+	responses := map[string]pkg.Response{
+		"ack": {ID: "1", Type: pkg.Ack},
+		"round started": {Type: pkg.RoundStarted, Payload: pkg.RoundStartedPayload{
+			Round:     1,
+			Turns:     7,
+			BirdTray:  tray,
+			TurnOrder: []*pkg.Player{{ID: uuid.New()}, {ID: uuid.New()}},
+		}},
+	}
+
+	for _, codec := range []pkg.Codec{pkg.JSONCodec, pkg.MsgpackCodec} {
+		for name, response := range responses {
+			b.Run(codec.Name()+"/"+name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := codec.Marshal(response); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
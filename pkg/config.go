@@ -0,0 +1,277 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const ENV_PREFIX = "WINGSPAN_"
+
+var (
+	ErrInvalidConfig = errors.New("Invalid configuration")
+)
+
+type Config struct {
+	Addr            string
+	TLSCert         string
+	TLSKey          string
+	AllowedOrigins  []string
+	AdminToken      string
+	Accounts        string
+	TokenTTL        time.Duration
+	MaxSessions     int
+	Socket          SocketOptions
+	RateLimits      RateLimits
+	Logging         LogLevels
+	Players         int
+	MatchTimeout    time.Duration
+	ShutdownTimeout time.Duration
+	SnapshotDir     string
+	Rules           GameRules
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Addr:            "0.0.0.0:8080",
+		Accounts:        "accounts.json",
+		TokenTTL:        TOKEN_TTL,
+		MaxSessions:     MAX_SESSIONS,
+		Socket:          DefaultSocketOptions(),
+		RateLimits:      DefaultRateLimits(),
+		Logging:         DefaultLogLevels(),
+		Players:         2,
+		MatchTimeout:    15 * time.Second,
+		ShutdownTimeout: 30 * time.Second,
+		SnapshotDir:     "snapshots",
+		Rules:           DefaultRules(),
+	}
+}
+
+// Loads the configuration from, in increasing order of precedence,
+// defaults, a JSON file, WINGSPAN_* environment variables and flags.
+// The file is given by -config or WINGSPAN_CONFIG and maps flag names
+// to values, e.g. {"turn-duration": "90s", "max-rounds": 4}
+func LoadConfig(args []string) (Config, error) {
+	config := DefaultConfig()
+
+	flags := flag.NewFlagSet("wingspan", flag.ContinueOnError)
+	file := flags.String("config", os.Getenv(ENV_PREFIX+"CONFIG"), "path to a JSON config file")
+
+	flags.StringVar(&config.Addr, "addr", config.Addr, "address to listen on")
+	flags.StringVar(&config.TLSCert, "tls-cert", config.TLSCert, "certificate file, enables TLS along with tls-key")
+	flags.StringVar(&config.TLSKey, "tls-key", config.TLSKey, "private key file, enables TLS along with tls-cert")
+	flags.Func("allowed-origins", "comma separated origins allowed to connect, all when empty", func(value string) error {
+		config.AllowedOrigins = nil
+		for _, origin := range strings.Split(value, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				config.AllowedOrigins = append(config.AllowedOrigins, origin)
+			}
+		}
+		return nil
+	})
+	flags.StringVar(&config.AdminToken, "admin-token", config.AdminToken, "bearer token required by the admin API, disabled when empty")
+	flags.StringVar(&config.Accounts, "accounts", config.Accounts, "file registered accounts are stored in")
+	flags.DurationVar(&config.TokenTTL, "token-ttl", config.TokenTTL, "how long authentication tokens are valid")
+	flags.IntVar(&config.MaxSessions, "max-sessions", config.MaxSessions, "HTTP gateway sessions kept at once, 0 is unbounded")
+	flags.DurationVar(&config.Socket.PingInterval, "ping-interval", config.Socket.PingInterval, "how often connections are pinged, 0 disables heartbeats")
+	flags.DurationVar(&config.Socket.ReadTimeout, "read-timeout", config.Socket.ReadTimeout, "silence after which a connection is considered dead, 0 waits forever")
+	flags.DurationVar(&config.Socket.WriteTimeout, "write-timeout", config.Socket.WriteTimeout, "how long writes may block, 0 waits forever")
+	flags.IntVar(&config.Socket.QueueSize, "send-queue", config.Socket.QueueSize, "responses queued per connection or gateway session, 0 is unbounded")
+	flags.Var(&config.Socket.SlowConsumer, "slow-consumer", "what to do when a connection's queue is full: drop, coalesce or disconnect")
+	flags.Int64Var(&config.Socket.MaxMessageSize, "max-message-size", config.Socket.MaxMessageSize, "largest message accepted in bytes, 0 accepts any size")
+	flags.IntVar(&config.Socket.MaxInvalid, "max-invalid", config.Socket.MaxInvalid, "undecodable messages tolerated per connection, 0 tolerates any amount")
+	flags.Float64Var(&config.RateLimits.Connection.Rate, "rate", config.RateLimits.Connection.Rate, "messages per second per connection, 0 disables the connection limit")
+	flags.IntVar(&config.RateLimits.Connection.Burst, "burst", config.RateLimits.Connection.Burst, "messages a connection may send at once")
+	flags.Func("method-limits", "comma separated per method limits as Service.Method=rate:burst", func(value string) error {
+		limits, err := parseMethodLimits(value)
+		if err == nil {
+			config.RateLimits.Methods = limits
+		}
+		return err
+	})
+	flags.IntVar(&config.RateLimits.ThrottleAfter, "throttle-after", config.RateLimits.ThrottleAfter, "violations before a connection is throttled, 0 never throttles")
+	flags.IntVar(&config.RateLimits.DisconnectAfter, "disconnect-after", config.RateLimits.DisconnectAfter, "violations before a connection is dropped, 0 never drops")
+	flags.DurationVar(&config.RateLimits.Throttle, "throttle", config.RateLimits.Throttle, "delay applied to each message of a throttled connection")
+	flags.Var(&config.Logging.Default, "log-level", "minimum level logged: debug, info, warn, error or off")
+	flags.Func("log-levels", "comma separated per subsystem levels as subsystem=level, e.g. game=debug", func(value string) error {
+		levels, err := parseLogLevels(value)
+		if err == nil {
+			config.Logging.Subsystems = levels
+		}
+		return err
+	})
+	flags.IntVar(&config.Players, "players", config.Players, "players per match")
+	flags.DurationVar(&config.MatchTimeout, "match-timeout", config.MatchTimeout, "time players have to accept a match")
+	flags.DurationVar(&config.ShutdownTimeout, "shutdown-timeout", config.ShutdownTimeout, "time games have to finish on shutdown")
+	flags.StringVar(&config.SnapshotDir, "snapshot-dir", config.SnapshotDir, "directory games still running after shutdown-timeout are saved to, none are saved when empty")
+	flags.DurationVar(&config.Rules.SetupDuration, "setup-duration", config.Rules.SetupDuration, "time players have to choose birds and food")
+	flags.DurationVar(&config.Rules.TurnDuration, "turn-duration", config.Rules.TurnDuration, "time players have to play a turn")
+	flags.IntVar(&config.Rules.MaxRounds, "max-rounds", config.Rules.MaxRounds, "rounds per game")
+	flags.IntVar(&config.Rules.MaxTurns, "max-turns", config.Rules.MaxTurns, "turns on the first round")
+	flags.IntVar(&config.Rules.MaxBirdsTray, "max-birds-tray", config.Rules.MaxBirdsTray, "birds on the tray")
+	flags.IntVar(&config.Rules.MaxFoodFeeder, "max-food-feeder", config.Rules.MaxFoodFeeder, "food on the birdfeeder")
+	flags.IntVar(&config.Rules.InitialBirds, "initial-birds", config.Rules.InitialBirds, "birds dealt to each player")
+	flags.IntVar(&config.Rules.InitialFood, "initial-food", config.Rules.InitialFood, "food dealt to each player")
+
+	if err := flags.Parse(args); err != nil {
+		return config, err
+	}
+
+	explicit := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	// lower precedence sources only fill what flags did not set
+	set := func(name, value, source string) error {
+		if explicit[name] || name == "config" {
+			return nil
+		}
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("%w: %v from %v: %v", ErrInvalidConfig, name, source, err)
+		}
+		return nil
+	}
+
+	if *file != "" {
+		values, err := readConfigFile(*file)
+		if err != nil {
+			return config, err
+		}
+		for name, value := range values {
+			if flags.Lookup(name) == nil {
+				return config, fmt.Errorf("%w: unknown setting %v in %v", ErrInvalidConfig, name, *file)
+			}
+			if err := set(name, value, *file); err != nil {
+				return config, err
+			}
+		}
+	}
+
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		env := ENV_PREFIX + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value, ok := os.LookupEnv(env); ok && err == nil {
+			err = set(f.Name, value, env)
+		}
+	})
+	if err != nil {
+		return config, err
+	}
+
+	return config, config.Validate()
+}
+
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// numbers are kept as written, floats would turn 1000000 into 1e+06
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var raw map[string]any
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%w: %v: %v", ErrInvalidConfig, path, err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("%w: %v: unexpected data after the configuration", ErrInvalidConfig, path)
+	}
+
+	values := make(map[string]string)
+	for name, value := range raw {
+		if list, ok := value.([]any); ok {
+			items := make([]string, 0, len(list))
+			for _, item := range list {
+				items = append(items, configValue(item))
+			}
+			values[name] = strings.Join(items, ",")
+		} else {
+			values[name] = configValue(value)
+		}
+	}
+	return values, nil
+}
+
+func configValue(value any) string {
+	if number, ok := value.(json.Number); ok {
+		return number.String()
+	}
+	return fmt.Sprint(value)
+}
+
+func parseMethodLimits(value string) (map[string]RateLimit, error) {
+	limits := make(map[string]RateLimit)
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		method, limit, ok := strings.Cut(entry, "=")
+		rate, burst, ok2 := strings.Cut(limit, ":")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("expected Service.Method=rate:burst, got %v", entry)
+		}
+
+		var parsed RateLimit
+		if _, err := fmt.Sscan(rate, &parsed.Rate); err != nil {
+			return nil, fmt.Errorf("invalid rate for %v: %v", method, err)
+		}
+		if _, err := fmt.Sscan(burst, &parsed.Burst); err != nil {
+			return nil, fmt.Errorf("invalid burst for %v: %v", method, err)
+		}
+		limits[method] = parsed
+	}
+	return limits, nil
+}
+
+func (c Config) TLS() bool {
+	return c.TLSCert != "" && c.TLSKey != ""
+}
+
+func (c Config) Validate() error {
+	rules := c.Rules
+	checks := []struct {
+		ok      bool
+		message string
+	}{
+		{c.Addr != "", "addr is required"},
+		{(c.TLSCert == "") == (c.TLSKey == ""), "tls-cert and tls-key go together"},
+		{c.TokenTTL > 0, "token-ttl must be positive"},
+		{c.MaxSessions >= 0, "max-sessions cannot be negative"},
+		{c.Socket.PingInterval >= 0 && c.Socket.ReadTimeout >= 0 && c.Socket.WriteTimeout >= 0, "socket timeouts cannot be negative"},
+		{c.Socket.QueueSize >= 0, "send-queue cannot be negative"},
+		{c.Socket.MaxMessageSize >= 0 && c.Socket.MaxInvalid >= 0, "max-message-size and max-invalid cannot be negative"},
+		{c.RateLimits.Connection.Rate >= 0 && c.RateLimits.Connection.Burst >= 0, "rate and burst cannot be negative"},
+		{c.RateLimits.ThrottleAfter >= 0 && c.RateLimits.DisconnectAfter >= 0 && c.RateLimits.Throttle >= 0, "throttle settings cannot be negative"},
+		{c.Socket.ReadTimeout == 0 || c.Socket.PingInterval < c.Socket.ReadTimeout, "ping-interval must be shorter than read-timeout"},
+		{c.Players > 0, "players must be positive"},
+		{c.MatchTimeout > 0, "match-timeout must be positive"},
+		{c.ShutdownTimeout >= 0, "shutdown-timeout cannot be negative"},
+		{rules.SetupDuration > 0, "setup-duration must be positive"},
+		{rules.TurnDuration > 0, "turn-duration must be positive"},
+		{rules.MaxRounds > 0, "max-rounds must be positive"},
+		{rules.MaxTurns >= rules.MaxRounds, "max-turns must leave at least one turn on the last round"},
+		{rules.MaxBirdsTray > 0, "max-birds-tray must be positive"},
+		{rules.MaxFoodFeeder > 0, "max-food-feeder must be positive"},
+		{rules.InitialBirds >= 0, "initial-birds cannot be negative"},
+		{rules.InitialFood >= 0, "initial-food cannot be negative"},
+		{c.Players*rules.InitialBirds+rules.MaxBirdsTray <= MAX_DECK_SIZE, "not enough cards in the deck to deal"},
+	}
+
+	for _, check := range checks {
+		if !check.ok {
+			return fmt.Errorf("%w: %v", ErrInvalidConfig, check.message)
+		}
+	}
+
+	return nil
+}
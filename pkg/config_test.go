@@ -0,0 +1,175 @@
+package pkg_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"git.internal.com/wingspan/pkg"
+)
+
+func TestConfig(t *testing.T) {
+	writeFile := func(t testing.TB, content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Could not write config file: %v", err)
+		}
+		return path
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		config, err := pkg.LoadConfig(nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if config.Rules != pkg.DefaultRules() {
+			t.Errorf("Expected %v, got %v", pkg.DefaultRules(), config.Rules)
+		}
+		if config.Players != 2 {
+			t.Errorf("Expected %v, got %v", 2, config.Players)
+		}
+	})
+
+	t.Run("precedence", func(t *testing.T) {
+		path := writeFile(t, `{"addr": ":9000", "players": 3, "turn-duration": "90s", "max-rounds": 3}`)
+
+		t.Setenv("WINGSPAN_CONFIG", path)
+		t.Setenv("WINGSPAN_PLAYERS", "4")
+		t.Setenv("WINGSPAN_MAX_ROUNDS", "2")
+
+		config, err := pkg.LoadConfig([]string{"-max-rounds", "1"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if config.Addr != ":9000" {
+			t.Errorf("Expected addr from file, got %v", config.Addr)
+		}
+		if config.Rules.TurnDuration != 90*time.Second {
+			t.Errorf("Expected turn duration from file, got %v", config.Rules.TurnDuration)
+		}
+		if config.Players != 4 {
+			t.Errorf("Expected players from env, got %v", config.Players)
+		}
+		if config.Rules.MaxRounds != 1 {
+			t.Errorf("Expected max rounds from flags, got %v", config.Rules.MaxRounds)
+		}
+	})
+
+	t.Run("config flag", func(t *testing.T) {
+		path := writeFile(t, `{"match-timeout": "5s"}`)
+
+		config, err := pkg.LoadConfig([]string{"-config", path})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if config.MatchTimeout != 5*time.Second {
+			t.Errorf("Expected %v, got %v", 5*time.Second, config.MatchTimeout)
+		}
+	})
+
+	t.Run("large numbers", func(t *testing.T) {
+		path := writeFile(t, `{"max-message-size": 1000000, "rate": 2.5}`)
+
+		config, err := pkg.LoadConfig([]string{"-config", path})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if config.Socket.MaxMessageSize != 1000000 {
+			t.Errorf("Expected %v, got %v", 1000000, config.Socket.MaxMessageSize)
+		}
+		if config.RateLimits.Connection.Rate != 2.5 {
+			t.Errorf("Expected %v, got %v", 2.5, config.RateLimits.Connection.Rate)
+		}
+	})
+
+	t.Run("tls and origins", func(t *testing.T) {
+		path := writeFile(t, `{"tls-cert": "cert.pem", "tls-key": "key.pem", "allowed-origins": ["https://a.example", "https://b.example"]}`)
+
+		config, err := pkg.LoadConfig([]string{"-config", path})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !config.TLS() {
+			t.Error("Expected TLS to be enabled")
+		}
+		if len(config.AllowedOrigins) != 2 || config.AllowedOrigins[1] != "https://b.example" {
+			t.Errorf("Expected two origins, got %v", config.AllowedOrigins)
+		}
+	})
+
+	t.Run("method limits", func(t *testing.T) {
+		config, err := pkg.LoadConfig([]string{"-method-limits", "Queue.Add=0.5:2, Game.GainFood=4:8"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		expected := map[string]pkg.RateLimit{
+			"Queue.Add":     {Rate: 0.5, Burst: 2},
+			"Game.GainFood": {Rate: 4, Burst: 8},
+		}
+		if !reflect.DeepEqual(config.RateLimits.Methods, expected) {
+			t.Errorf("Expected %v, got %v", expected, config.RateLimits.Methods)
+		}
+
+		if _, err := pkg.LoadConfig([]string{"-method-limits", "Queue.Add=fast"}); err == nil {
+			t.Error("Expected error, got nothing")
+		}
+	})
+
+	t.Run("log levels", func(t *testing.T) {
+		config, err := pkg.LoadConfig([]string{"-log-level", "warn", "-log-levels", "game=debug, queue=off"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if config.Logging.Level("game") != pkg.LogDebug || config.Logging.Level("queue") != pkg.LogOff {
+			t.Errorf("Expected per subsystem levels, got %v", config.Logging.Subsystems)
+		}
+		if config.Logging.Level("matchmaker") != pkg.LogWarn {
+			t.Errorf("Expected warn by default, got %v", config.Logging.Level("matchmaker"))
+		}
+
+		if _, err := pkg.LoadConfig([]string{"-log-levels", "game=loud"}); err == nil {
+			t.Error("Expected error, got nothing")
+		}
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		cases := map[string]func(t *testing.T) error{
+			"unknown setting": func(t *testing.T) error {
+				_, err := pkg.LoadConfig([]string{"-config", writeFile(t, `{"unknown": 1}`)})
+				return err
+			},
+			"bad env": func(t *testing.T) error {
+				t.Setenv("WINGSPAN_TURN_DURATION", "forever")
+				_, err := pkg.LoadConfig(nil)
+				return err
+			},
+			"validation": func(t *testing.T) error {
+				_, err := pkg.LoadConfig([]string{"-max-turns", "2", "-max-rounds", "4"})
+				return err
+			},
+			"tls pair": func(t *testing.T) error {
+				_, err := pkg.LoadConfig([]string{"-tls-cert", "cert.pem"})
+				return err
+			},
+			"deck": func(t *testing.T) error {
+				_, err := pkg.LoadConfig([]string{"-players", "5", "-initial-birds", "40"})
+				return err
+			},
+		}
+
+		for name, load := range cases {
+			t.Run(name, func(t *testing.T) {
+				if err := load(t); !errors.Is(err, pkg.ErrInvalidConfig) {
+					t.Errorf("Expected error %v, got %v", pkg.ErrInvalidConfig, err)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package pkg
+
+import "sync"
+
+const EVENT_LOG_SIZE = 128
+
+// Numbers responses and keeps the most recent ones so a client
+// coming back can be sent exactly what it missed
+type EventLog struct {
+	mutex  sync.Mutex
+	size   int
+	seq    uint64
+	events []Response
+}
+
+func NewEventLog(size int) *EventLog {
+	return &EventLog{
+		size:   size,
+		events: make([]Response, 0, size),
+	}
+}
+
+// Assigns the next sequence number to response and records it
+func (l *EventLog) Append(response Response) Response {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.seq++
+	response.Seq = l.seq
+
+	if len(l.events) == l.size {
+		copy(l.events, l.events[1:])
+		l.events = l.events[:l.size-1]
+	}
+	l.events = append(l.events, response)
+
+	return response
+}
+
+// Sequence number of the last event recorded
+func (l *EventLog) Seq() uint64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.seq
+}
+
+// Events recorded after seq, complete is false when some
+// of them were already dropped to make room for newer ones
+func (l *EventLog) Since(seq uint64) (events []Response, complete bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	events = make([]Response, 0)
+	for _, event := range l.events {
+		if event.Seq > seq {
+			events = append(events, event)
+		}
+	}
+
+	missed := l.seq - seq
+	if seq > l.seq {
+		missed = 0
+	}
+
+	return events, uint64(len(events)) == missed
+}
@@ -0,0 +1,60 @@
+package pkg_test
+
+import (
+	"testing"
+
+	"git.internal.com/wingspan/pkg"
+)
+
+func TestEventLog(t *testing.T) {
+	t.Run("numbers events", func(t *testing.T) {
+		log := pkg.NewEventLog(5)
+
+		for i := 1; i <= 3; i++ {
+			if event := log.Append(pkg.Response{Type: pkg.MatchFound}); event.Seq != uint64(i) {
+				t.Errorf("Expected seq %v, got %v", i, event.Seq)
+			}
+		}
+		if log.Seq() != 3 {
+			t.Errorf("Expected %v, got %v", 3, log.Seq())
+		}
+	})
+
+	t.Run("since", func(t *testing.T) {
+		log := pkg.NewEventLog(5)
+		for i := 0; i < 4; i++ {
+			log.Append(pkg.Response{Type: pkg.MatchFound})
+		}
+
+		events, complete := log.Since(2)
+		if !complete {
+			t.Error("Expected complete replay")
+		}
+		if len(events) != 2 || events[0].Seq != 3 || events[1].Seq != 4 {
+			t.Errorf("Expected events 3 and 4, got %v", events)
+		}
+
+		if events, complete := log.Since(4); len(events) != 0 || !complete {
+			t.Errorf("Expected nothing missed, got %v", events)
+		}
+	})
+
+	t.Run("drops oldest", func(t *testing.T) {
+		log := pkg.NewEventLog(2)
+		for i := 0; i < 5; i++ {
+			log.Append(pkg.Response{Type: pkg.MatchFound})
+		}
+
+		events, complete := log.Since(1)
+		if complete {
+			t.Error("Expected incomplete replay")
+		}
+		if len(events) != 2 || events[0].Seq != 4 {
+			t.Errorf("Expected events 4 and 5, got %v", events)
+		}
+
+		if _, complete := log.Since(3); !complete {
+			t.Error("Expected complete replay")
+		}
+	})
+}
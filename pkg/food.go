@@ -21,14 +21,21 @@ const (
 
 type Birdfeeder struct {
 	food *sync.Map
+	rand *rand.Rand
 	size int32
 	len  int32
 }
 
 func NewBirdfeeder(size int) *Birdfeeder {
+	return NewBirdfeederWithRand(size, defaultRand)
+}
+
+// Rolls the dice with rng, games pass their own
+func NewBirdfeederWithRand(size int, rng *rand.Rand) *Birdfeeder {
 	feeder := &Birdfeeder{
 		size: int32(size),
 		food: new(sync.Map),
+		rand: rng,
 	}
 	feeder.Refill()
 	return feeder
@@ -71,7 +78,7 @@ func (f *Birdfeeder) Refill() {
 	curr := atomic.LoadInt32(&f.len)
 
 	for i := 0; i < int(size-curr); i++ {
-		foodType := FoodType(rand.Intn(FOOD_TYPE_COUNT))
+		foodType := FoodType(f.rand.Intn(FOOD_TYPE_COUNT))
 		curr, loaded := f.food.LoadOrStore(foodType, 1)
 		if loaded {
 			f.food.Store(foodType, 1+curr.(int))
@@ -1,6 +1,7 @@
 package pkg_test
 
 import (
+	"reflect"
 	"testing"
 
 	"git.internal.com/wingspan/pkg"
@@ -8,7 +9,9 @@ import (
 
 func TestBirdfeeder(t *testing.T) {
 	t.Run("get food", func(t *testing.T) {
-		feeder := pkg.NewBirdfeeder(5)
+		feeder := pkg.NewBirdfeederWithRand(5, pkg.NewRand(TEST_SEED))
+
+		// the seed rolls a single rodent
 		err := feeder.GetFood(pkg.Rodent, 1)
 
 		if err != nil {
@@ -18,14 +21,19 @@ func TestBirdfeeder(t *testing.T) {
 			t.Errorf("expected len %v, got %v", 4, feeder.Len())
 		}
 		if err := feeder.GetFood(pkg.Rodent, 1); err == nil {
-			t.Error("should not have seed again")
+			t.Error("should not have rodent again")
 		}
 	})
 
 	t.Run("refill", func(t *testing.T) {
-		feeder := pkg.NewBirdfeeder(1)
-		if err := feeder.GetFood(pkg.Fish, 1); err != nil {
-			t.Fatalf("expected no error, got %v", err)
+		feeder := pkg.NewBirdfeederWithRand(1, pkg.NewRand(TEST_SEED))
+		for food := range feeder.List() {
+			if err := feeder.GetFood(food, 1); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+		if feeder.Len() != 0 {
+			t.Fatalf("expected empty feeder, got %v", feeder.Len())
 		}
 
 		feeder.Refill()
@@ -34,6 +42,15 @@ func TestBirdfeeder(t *testing.T) {
 		}
 	})
 
+	t.Run("same seed rolls the same food", func(t *testing.T) {
+		first := pkg.NewBirdfeederWithRand(20, pkg.NewRand(42))
+		second := pkg.NewBirdfeederWithRand(20, pkg.NewRand(42))
+
+		if !reflect.DeepEqual(first.List(), second.List()) {
+			t.Errorf("expected %v, got %v", first.List(), second.List())
+		}
+	})
+
 	t.Run("concurrency", func(t *testing.T) {
 		feeder := pkg.NewBirdfeeder(1)
 		food := feeder.List()
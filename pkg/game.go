@@ -1,23 +1,27 @@
 package pkg
 
 import (
+	"crypto/subtle"
 	"errors"
-	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 var (
-	ErrGameOver         = errors.New("Game over")
-	ErrRoundEnded       = errors.New("Round ended")
-	ErrNoPlayerReady    = errors.New("No player ready")
-	ErrFoodNotFound     = errors.New("Food not found")
-	ErrNotEnoughFood    = errors.New("Not enough food")
-	ErrNotEnoughEggs    = errors.New("Not enough eggs")
-	ErrBirdCardNotFound = errors.New("Bird card not found")
-	ErrChooseResources  = errors.New("Choose resources")
+	ErrGameOver           = errors.New("Game over")
+	ErrRoundEnded         = errors.New("Round ended")
+	ErrNoPlayerReady      = errors.New("No player ready")
+	ErrFoodNotFound       = errors.New("Food not found")
+	ErrNotEnoughFood      = errors.New("Not enough food")
+	ErrNotEnoughEggs      = errors.New("Not enough eggs")
+	ErrBirdCardNotFound   = errors.New("Bird card not found")
+	ErrChooseResources    = errors.New("Choose resources")
+	ErrGameStopped        = errors.New("Game stopped")
+	ErrInvalidResumeToken = errors.New("Invalid resume token")
+	ErrPlayerKicked       = errors.New("Player was kicked from the game")
 )
 
 const (
@@ -27,23 +31,78 @@ const (
 	MAX_FOOD_FEEDER = 5
 )
 
+// Tunable rules a game is played by
+type GameRules struct {
+	MaxRounds     int
+	MaxTurns      int
+	MaxBirdsTray  int
+	MaxFoodFeeder int
+	InitialBirds  int
+	InitialFood   int
+	SetupDuration time.Duration
+	TurnDuration  time.Duration
+}
+
+func DefaultRules() GameRules {
+	return GameRules{
+		MaxRounds:     MAX_ROUNDS,
+		MaxTurns:      MAX_TURNS,
+		MaxBirdsTray:  MAX_BIRDS_TRAY,
+		MaxFoodFeeder: MAX_FOOD_FEEDER,
+		InitialBirds:  INITIAL_BIRDS,
+		InitialFood:   INITIAL_FOOD,
+		SetupDuration: time.Minute,
+		TurnDuration:  time.Minute,
+	}
+}
+
 type Game struct {
-	mutex        sync.Mutex
-	currRound    int
-	currTurn     int
-	firstPlayer  *Player
-	deck         Deck
-	timer        *time.Timer
-	turnStart    time.Time
-	turnDuration time.Duration
-	turnOrder    *RingBuffer[*Player]
-	sockets      *sync.Map
-	players      *sync.Map
-	birdTray     *BirdTray
-	birdFeeder   *Birdfeeder
+	ID          uuid.UUID
+	seed        int64
+	mutex       sync.Mutex
+	currRound   int
+	currTurn    int
+	firstPlayer *Player
+	deck        Deck
+	timer       *time.Timer
+	stopped     bool
+	over        bool
+	turnStart   time.Time
+	rules       GameRules
+	turnOrder   *RingBuffer[*Player]
+	sockets     *sync.Map
+	players     *sync.Map
+	birdTray    *BirdTray
+	birdFeeder  *Birdfeeder
+	counters    *GameCounters
+	logger      *Logger
+
+	// told when the game cancels itself, so it can be let go of
+	onCancel func()
+	// ends timed out turns in place of EndTurn, so the results
+	// of a game ending on a timeout are sent as well
+	onTurnTimeout func() error
+}
+
+// Totals kept across the games they are shared by
+type GameCounters struct {
+	TurnTimeouts atomic.Uint64
+	Canceled     atomic.Uint64
 }
 
 func NewGame(sockets []Socket, turnDuration time.Duration) (*Game, error) {
+	rules := DefaultRules()
+	rules.TurnDuration = turnDuration
+	return NewGameWithRules(sockets, rules)
+}
+
+func NewGameWithRules(sockets []Socket, rules GameRules) (*Game, error) {
+	return NewGameWithSeed(sockets, rules, newSeed())
+}
+
+// Every roll of the game comes from seed, the same seed and the
+// same moves always play out the same game
+func NewGameWithSeed(sockets []Socket, rules GameRules, seed int64) (*Game, error) {
 	if len(sockets) == 0 {
 		return nil, ErrNoPlayers
 	}
@@ -51,43 +110,47 @@ func NewGame(sockets []Socket, turnDuration time.Duration) (*Game, error) {
 	players := new(sync.Map)
 	gameSockets := new(sync.Map)
 
+	rng := NewRand(seed)
 	deck := NewDeck(MAX_DECK_SIZE)
 
 	for _, socket := range sockets {
-		player := NewPlayer(socket)
+		player := NewPlayerWithRand(socket, rng)
 
-		for i := 0; i < INITIAL_FOOD; i++ {
-			foodType := FoodType(rand.Intn(FOOD_TYPE_COUNT))
+		for i := 0; i < rules.InitialFood; i++ {
+			foodType := FoodType(rng.Intn(FOOD_TYPE_COUNT))
 			player.GainFood(foodType, 1)
 		}
 
-		if err := player.Draw(deck, INITIAL_BIRDS); err != nil {
+		if err := player.Draw(deck, rules.InitialBirds); err != nil {
 			return nil, err
 		}
-		players.Store(socket, player)
+		players.Store(player.Owner(), player)
 		gameSockets.Store(player, socket)
 	}
 
-	birdTray := NewBirdTray(MAX_BIRDS_TRAY)
+	birdTray := NewBirdTray(int32(rules.MaxBirdsTray))
 	birdTray.Refill(deck)
 
 	return &Game{
-		deck:         deck,
-		turnDuration: turnDuration,
-		players:      players,
-		sockets:      gameSockets,
-		birdTray:     birdTray,
-		turnOrder:    NewRingBuffer[*Player](len(sockets)),
-		birdFeeder:   NewBirdfeeder(MAX_FOOD_FEEDER),
+		ID:         uuid.New(),
+		seed:       seed,
+		deck:       deck,
+		rules:      rules,
+		players:    players,
+		sockets:    gameSockets,
+		birdTray:   birdTray,
+		turnOrder:  NewRingBuffer[*Player](len(sockets)),
+		birdFeeder: NewBirdfeederWithRand(rules.MaxFoodFeeder, rng),
+		counters:   new(GameCounters),
+		logger:     DiscardLogger(),
 	}, nil
 }
 
 func (g *Game) Start(timeout time.Duration) {
-	g.players.Range(func(key, value any) bool {
-		socket := key.(Socket)
+	g.players.Range(func(_, value any) bool {
 		player := value.(*Player)
 
-		socket.Send(Response{
+		player.Send(Response{
 			Type: ChooseCards,
 			Payload: ChooseResources{
 				Time:  timeout.Seconds(),
@@ -102,13 +165,22 @@ func (g *Game) Start(timeout time.Duration) {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 
+	if g.stopped {
+		return
+	}
+
 	g.timer = time.AfterFunc(timeout, func() {
-		g.Broadcast(Response{Type: GameCanceled})
+		g.counters.Canceled.Add(1)
+		g.logger.Info("Game canceled", "reason", "setup timed out")
+		g.Cancel()
+		if g.onCancel != nil {
+			g.onCancel()
+		}
 	})
 }
 
 func (g *Game) ChooseBirds(socket Socket, birdsToKeep []BirdID) error {
-	value, ok := g.players.Load(socket)
+	value, ok := g.players.Load(socket.Session().ID())
 	if !ok {
 		return ErrGameNotFound
 	}
@@ -118,7 +190,7 @@ func (g *Game) ChooseBirds(socket Socket, birdsToKeep []BirdID) error {
 		return err
 	}
 
-	_, err := socket.Send(Response{
+	_, err := player.Send(Response{
 		Type:    DiscardFood,
 		Payload: len(birdsToKeep),
 	})
@@ -128,7 +200,7 @@ func (g *Game) ChooseBirds(socket Socket, birdsToKeep []BirdID) error {
 
 // Discards food and returns whether every player is ready
 func (g *Game) DiscardFood(socket Socket, chosenFood map[FoodType]int) (bool, error) {
-	value, ok := g.players.Load(socket)
+	value, ok := g.players.Load(socket.Session().ID())
 	if !ok {
 		return false, ErrGameNotFound
 	}
@@ -148,7 +220,7 @@ func (g *Game) DiscardFood(socket Socket, chosenFood map[FoodType]int) (bool, er
 	if g.turnOrder.Full() {
 		g.timer.Stop()
 	} else {
-		socket.Send(Response{
+		player.Send(Response{
 			Type: WaitOtherPlayers,
 		})
 	}
@@ -185,15 +257,15 @@ func (g *Game) DrawFromDeck(socket Socket) error {
 		player.GainBird(bird)
 	}
 
-	g.players.Range(func(key, _ any) bool {
-		s := key.(Socket)
-		if s == socket {
-			s.Send(Response{
+	g.players.Range(func(_, value any) bool {
+		p := value.(*Player)
+		if p == player {
+			p.Send(Response{
 				Type:    BirdsDrawn,
 				Payload: drawnBirds,
 			})
 		} else {
-			s.Send(Response{
+			p.Send(Response{
 				Type:    BirdsDrawn,
 				Payload: len(drawnBirds),
 			})
@@ -383,6 +455,7 @@ func (g *Game) StartRound() error {
 	g.mutex.Lock()
 	g.currTurn = 0
 	g.firstPlayer = g.turnOrder.Peek()
+	g.logger.Info("Round started", "round", g.currRound)
 
 	g.Broadcast(Response{
 		Type: RoundStarted,
@@ -390,7 +463,7 @@ func (g *Game) StartRound() error {
 			Round:     g.currRound,
 			TurnOrder: g.TurnOrder(),
 			BirdTray:  g.birdTray,
-			Turns:     MAX_TURNS - g.currRound,
+			Turns:     g.rules.MaxTurns - g.currRound,
 		},
 	})
 
@@ -406,29 +479,34 @@ func (g *Game) StartTurn() error {
 	current := g.turnOrder.Peek()
 	g.mutex.Lock()
 
+	if g.stopped {
+		g.mutex.Unlock()
+		return ErrGameStopped
+	}
+
 	g.turnStart = time.Now()
 
 	g.players.Range(func(key, val any) bool {
 		player := val.(*Player)
 		if player == current {
-			player.socket.Send(Response{
+			player.Send(Response{
 				Type: StartTurn,
 				Payload: StartTurnPayload{
 					Turn:     g.currTurn,
 					BirdTray: g.birdTray,
-					Duration: g.turnDuration.Seconds(),
-					TimeLeft: g.turnDuration.Seconds(),
+					Duration: g.rules.TurnDuration.Seconds(),
+					TimeLeft: g.rules.TurnDuration.Seconds(),
 				},
 			})
 		} else {
-			player.socket.Send(Response{
+			player.Send(Response{
 				Type: WaitTurn,
 				Payload: WaitTurnPayload{
 					Current:  current.ID,
 					Turn:     g.currTurn,
 					BirdTray: g.birdTray,
-					Duration: g.turnDuration.Seconds(),
-					TimeLeft: g.turnDuration.Seconds(),
+					Duration: g.rules.TurnDuration.Seconds(),
+					TimeLeft: g.rules.TurnDuration.Seconds(),
 				},
 			})
 		}
@@ -437,8 +515,20 @@ func (g *Game) StartTurn() error {
 
 	defer g.mutex.Unlock()
 
-	g.timer = time.AfterFunc(g.turnDuration, func() {
-		g.EndTurn()
+	round, turn := g.currRound, g.currTurn
+	g.logger.Info("Turn started", "player", current.ID, "round", round, "turn", turn)
+
+	g.timer = time.AfterFunc(g.rules.TurnDuration, func() {
+		g.counters.TurnTimeouts.Add(1)
+		g.logger.Info("Turn timed out", "player", current.ID, "round", round, "turn", turn)
+
+		endTurn := g.EndTurn
+		if g.onTurnTimeout != nil {
+			endTurn = g.onTurnTimeout
+		}
+		if err := endTurn(); err != nil {
+			g.logger.Warn("Could not end timed out turn", "player", current.ID, "error", err)
+		}
 	})
 
 	return nil
@@ -448,12 +538,15 @@ func (g *Game) EndTurn() error {
 	g.mutex.Lock()
 
 	g.timer.Stop()
+	if current := g.turnOrder.Peek(); current != nil {
+		g.logger.Info("Turn ended", "player", current.ID, "round", g.currRound, "turn", g.currTurn)
+	}
 	g.turnOrder.Push(g.turnOrder.Dequeue())
 
 	if g.turnOrder.Peek() == g.firstPlayer {
 		g.currTurn++
 
-		if g.currTurn >= (MAX_TURNS - g.currRound) {
+		if g.currTurn >= (g.rules.MaxTurns - g.currRound) {
 			g.mutex.Unlock()
 			return g.EndRound()
 		}
@@ -471,10 +564,14 @@ func (g *Game) EndTurn() error {
 func (g *Game) EndRound() error {
 	g.mutex.Lock()
 
+	g.logger.Info("Round ended", "round", g.currRound)
 	g.currRound++
 	g.turnOrder.Push(g.turnOrder.Dequeue())
 
-	if g.currRound >= MAX_ROUNDS {
+	if g.currRound >= g.rules.MaxRounds {
+		g.logger.Info("Game over", "rounds", g.currRound)
+		g.over = true
+		g.mutex.Unlock()
 		return ErrGameOver
 	}
 
@@ -486,14 +583,15 @@ func (g *Game) EndRound() error {
 	return ErrRoundEnded
 }
 
-func (g *Game) GetResult() (Socket, []Socket) {
+func (g *Game) GetResult() (*Player, []*Player) {
 	var winner *Player
 	winnerScore := -1
-	losers := make([]Socket, 0)
+	players := make([]*Player, 0)
 
-	g.players.Range(func(key, value any) bool {
+	g.players.Range(func(_, value any) bool {
 		player := value.(*Player)
 		score := player.TotalScore()
+		players = append(players, player)
 
 		if score > winnerScore {
 			winnerScore = score
@@ -502,19 +600,26 @@ func (g *Game) GetResult() (Socket, []Socket) {
 			if player.CountFood() > winner.CountFood() {
 				winner = player
 			}
-		} else {
-			losers = append(losers, key.(Socket))
 		}
 		return true
 	})
 
-	return winner.socket, losers
+	// everyone else lost, including players the winner overtook
+	losers := make([]*Player, 0)
+	for _, player := range players {
+		if player != winner {
+			losers = append(losers, player)
+		}
+	}
+
+	return winner, losers
 }
 
+// Players are ranged by seat, the sessions they are
+// seated by change when they resume
 func (g *Game) Broadcast(response Response) {
-	g.players.Range(func(key, _ any) bool {
-		socket := key.(Socket)
-		socket.Send(response)
+	g.sockets.Range(func(key, _ any) bool {
+		key.(*Player).Send(response)
 		return true
 	})
 }
@@ -554,21 +659,239 @@ func (g *Game) TurnOrder() []*Player {
 	return g.turnOrder.Values()
 }
 
+// Seed the game's randomness was created from
+func (g *Game) Seed() int64 {
+	return g.seed
+}
+
+func (g *Game) Round() int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.currRound
+}
+
+func (g *Game) Over() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.over
+}
+
+// Stops the game timers for good, no more turns are started
+func (g *Game) Stop() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.stopped = true
+	if g.timer != nil {
+		g.timer.Stop()
+	}
+}
+
+// Cancels the game at any point, players are told and no
+// more turns are started
+func (g *Game) Cancel() {
+	g.Stop()
+
+	g.mutex.Lock()
+	g.over = true
+	g.mutex.Unlock()
+
+	g.Broadcast(Response{Type: GameCanceled})
+}
+
+// Takes the seat away from the player, who is disconnected and can't
+// resume it. Their turns are left to time out
+func (g *Game) Kick(id uuid.UUID) (*Player, error) {
+	player := g.GetPlayer(id)
+	if player == nil {
+		return nil, ErrPlayerNotFound
+	}
+	if player.Kicked() {
+		return nil, ErrPlayerKicked
+	}
+
+	if socket := player.kick(); socket != nil {
+		socket.Send(Response{Type: Error, Payload: ErrPlayerKicked.Error()})
+		closeWithReason(socket, ErrPlayerKicked.Error())
+	}
+	return player, nil
+}
+
+type PlayerSummary struct {
+	ID        uuid.UUID
+	Session   string
+	Connected bool
+	Kicked    bool
+}
+
+type GameSummary struct {
+	ID      uuid.UUID
+	Seed    int64
+	Round   int
+	Turn    int
+	Current uuid.UUID
+	Players []PlayerSummary
+}
+
+// Who is playing and whose turn it is, players in turn order
+// once the game started
+func (g *Game) Summary() GameSummary {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	summary := GameSummary{
+		ID:      g.ID,
+		Seed:    g.seed,
+		Round:   g.currRound,
+		Turn:    g.currTurn,
+		Players: make([]PlayerSummary, 0),
+	}
+
+	if current := g.turnOrder.Peek(); current != nil {
+		summary.Current = current.ID
+	}
+
+	var players []*Player
+	if g.turnOrder.Len() > 0 {
+		players = g.TurnOrder()
+	} else {
+		g.players.Range(func(_, value any) bool {
+			players = append(players, value.(*Player))
+			return true
+		})
+	}
+
+	for _, player := range players {
+		if player == nil {
+			continue
+		}
+		summary.Players = append(summary.Players, PlayerSummary{
+			ID:        player.ID,
+			Session:   player.Owner(),
+			Connected: player.connection() != nil,
+			Kicked:    player.Kicked(),
+		})
+	}
+
+	return summary
+}
+
+type PlayerSnapshot struct {
+	ID    uuid.UUID
+	Food  map[FoodType]int
+	Birds []*Bird
+	Board *Board
+	Score int
+}
+
+type GameSnapshot struct {
+	ID         uuid.UUID
+	Seed       int64
+	Round      int
+	Turn       int
+	Current    uuid.UUID
+	TurnOrder  []uuid.UUID
+	Players    []PlayerSnapshot
+	BirdTray   []*Bird
+	BirdFeeder map[FoodType]int
+	DeckSize   int
+	TakenAt    time.Time
+}
+
+func (g *Game) Snapshot() GameSnapshot {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	snapshot := GameSnapshot{
+		ID:         g.ID,
+		Seed:       g.seed,
+		Round:      g.currRound,
+		Turn:       g.currTurn,
+		TurnOrder:  make([]uuid.UUID, 0),
+		Players:    make([]PlayerSnapshot, 0),
+		BirdTray:   g.BirdTray(),
+		BirdFeeder: g.Birdfeeder(),
+		DeckSize:   g.deck.Len(),
+		TakenAt:    time.Now(),
+	}
+
+	if current := g.turnOrder.Peek(); current != nil {
+		snapshot.Current = current.ID
+	}
+
+	for _, player := range g.TurnOrder() {
+		if player != nil {
+			snapshot.TurnOrder = append(snapshot.TurnOrder, player.ID)
+		}
+	}
+
+	g.players.Range(func(_, value any) bool {
+		player := value.(*Player)
+		snapshot.Players = append(snapshot.Players, PlayerSnapshot{
+			ID:    player.ID,
+			Food:  player.GetFood(),
+			Birds: player.GetBirdCards(),
+			Board: player.board,
+			Score: player.TotalScore(),
+		})
+		return true
+	})
+
+	return snapshot
+}
+
+// Keeps the seat so the player can resume it, events meanwhile are
+// only recorded. Ignores sockets the player already replaced
 func (g *Game) Disconnect(socket Socket) error {
-	_, ok := g.players.LoadAndDelete(socket)
-	if !ok {
+	value, ok := g.players.Load(socket.Session().ID())
+	if !ok || value.(*Player).connection() != socket {
 		return ErrPlayerNotFound
 	}
+
+	value.(*Player).attach(nil)
 	return nil
 }
 
+// Points the player's seat to a new socket, which may belong to a new
+// session when resuming, so the seat is keyed by it from now on
+func (g *Game) Rebind(player *Player, socket Socket) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.players.Delete(player.Owner())
+	player.attach(socket)
+	g.players.Store(player.Owner(), player)
+	g.sockets.Store(player, socket)
+}
+
+// Reattaches the seat holding token to socket and replays the events
+// after seq, complete is false when some were too old to be kept
+func (g *Game) Resume(socket Socket, playerId uuid.UUID, token string, seq uint64) (complete bool, err error) {
+	player := g.GetPlayer(playerId)
+	if player == nil || subtle.ConstantTimeCompare([]byte(player.resumeToken()), []byte(token)) != 1 {
+		return false, ErrInvalidResumeToken
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.players.Delete(player.Owner())
+	complete, err = player.resume(socket, seq)
+	g.players.Store(player.Owner(), player)
+	g.sockets.Store(player, socket)
+
+	return complete, err
+}
+
 func (g *Game) validateSocket(socket Socket) (*Player, error) {
 	curr := g.turnOrder.Peek()
 	if curr == nil {
 		return nil, ErrNoPlayerReady
 	}
 
-	value, ok := g.players.Load(socket)
+	value, ok := g.players.Load(socket.Session().ID())
 	if !ok {
 		return nil, ErrGameNotFound
 	}
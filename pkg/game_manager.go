@@ -1,7 +1,12 @@
 package pkg
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
@@ -14,75 +19,117 @@ const (
 )
 
 var (
-	ErrGameNotFound = errors.New("You're probably not playing any games")
+	ErrGameNotFound   = errors.New("You're probably not playing any games")
+	ErrServerDraining = errors.New("Server is shutting down")
+	ErrNotSeatOwner   = errors.New("Seat belongs to another player")
 )
 
+// Games are keyed by session ID
 type GameManager struct {
-	games   *sync.Map
-	players *sync.Map
+	rules     GameRules
+	games     *sync.Map
+	players   *sync.Map
+	mutex     sync.Mutex
+	draining  bool
+	snapshots []GameSnapshot
+	// where games stopped while draining are written, nowhere when empty
+	snapshotDir string
+	counters    *GameCounters
+	logger      *Logger
 }
 
 func NewGameManager() *GameManager {
+	return NewGameManagerWithRules(DefaultRules())
+}
+
+func NewGameManagerWithRules(rules GameRules) *GameManager {
 	return &GameManager{
-		games:   new(sync.Map),
-		players: new(sync.Map),
+		rules:    rules,
+		games:    new(sync.Map),
+		players:  new(sync.Map),
+		counters: new(GameCounters),
+		logger:   DiscardLogger(),
 	}
 }
 
+func (g *GameManager) SetLogger(logger *Logger) {
+	g.logger = logger
+}
+
+// Writes games stopped while draining to dir as {game id}.json,
+// so they outlive the process. Must be called before draining
+func (g *GameManager) SetSnapshotDir(dir string) {
+	g.snapshotDir = dir
+}
+
 func (g *GameManager) Create(socket Socket, sockets []Socket) (*Message, error) {
-	game, err := NewGame(sockets, time.Minute)
+	g.mutex.Lock()
+	draining := g.draining
+	g.mutex.Unlock()
+
+	if draining {
+		for _, player := range sockets {
+			player.Send(Response{Type: GameCanceled})
+		}
+		g.logger.Info("Game canceled", "reason", "draining", "sessions", sessionIDs(sockets))
+		return nil, ErrServerDraining
+	}
+
+	game, err := NewGameWithRules(sockets, g.rules)
 	if err != nil {
 		return nil, err
 	}
+	game.counters = g.counters
+	game.logger = g.logger.With("game", game.ID, "seed", game.Seed())
+	game.onCancel = func() { g.remove(game) }
+	game.onTurnTimeout = func() error { return g.endTurn(game) }
 
 	for _, socket := range sockets {
-		value, _ := game.players.Load(socket)
+		value, _ := game.players.Load(socket.Session().ID())
 		player := value.(*Player)
 
-		g.games.Store(socket, game)
+		g.games.Store(socket.Session().ID(), game)
 		g.players.Store(player.ID, game)
+		game.logger.Debug("Player seated", "player", player.ID, "session", socket.Session().ID(), "conn", socket.Session().ConnectionID())
 	}
+	game.logger.Info("Game created", "players", len(sockets))
 
-	game.Start(time.Minute)
+	game.Start(g.rules.SetupDuration)
 	return nil, nil
 }
 
-func (g *GameManager) ChooseBirds(socket Socket, birds []any) (*Message, error) {
+func (g *GameManager) ChooseBirds(socket Socket, birds []BirdID) (*Message, error) {
 	game, err := g.GetSocketGame(socket)
 	if err != nil {
 		return nil, err
 	}
-
-	var ids []BirdID
-	if err := ParsePayload(birds, &ids); err != nil {
-		return nil, err
-	}
-
-	return nil, game.ChooseBirds(socket, ids)
+	return nil, game.ChooseBirds(socket, birds)
 }
 
-func (g *GameManager) DiscardFood(socket Socket, params map[string]any) (*Message, error) {
+func (g *GameManager) DiscardFood(socket Socket, chosenFood map[FoodType]int) (*Message, error) {
 	game, err := g.GetSocketGame(socket)
 	if err != nil {
 		return nil, err
 	}
 
-	var chosenFood map[FoodType]int
-	if err := ParsePayload(params, &chosenFood); err != nil {
-		return nil, err
-	}
-
 	ready, err := game.DiscardFood(socket, chosenFood)
 	if err != nil {
 		return nil, err
 	}
 
 	if ready {
+		game.logger.Info("Game started")
 		for _, player := range game.TurnOrder() {
-			player.socket.Send(Response{
-				Type:    GameStarted,
-				Payload: player.ID,
-			})
+			var payload any = GameStartedPayload{
+				ID:    player.ID,
+				Token: player.resumeToken(),
+				Seed:  game.Seed(),
+			}
+			if player.Protocol().Version < RESUME_PROTOCOL_VERSION {
+				payload = player.ID
+			}
+
+			player.Send(Response{Type: GameStarted, Payload: payload})
 		}
 
 		if err := game.StartRound(); err != nil {
@@ -109,18 +156,12 @@ func (g *GameManager) DrawFromDeck(socket Socket) (*Message, error) {
 	return nil, game.DrawFromDeck(socket)
 }
 
-func (g *GameManager) DrawFromTray(socket Socket, birds []any) (*Message, error) {
+func (g *GameManager) DrawFromTray(socket Socket, birds []BirdID) (*Message, error) {
 	game, err := g.GetSocketGame(socket)
 	if err != nil {
 		return nil, err
 	}
-
-	var ids []BirdID
-	if err := ParsePayload(birds, &ids); err != nil {
-		return nil, err
-	}
-
-	return nil, game.DrawFromTray(socket, ids)
+	return nil, game.DrawFromTray(socket, birds)
 }
 
 func (g *GameManager) GainFood(socket Socket) (*Message, error) {
@@ -131,17 +172,11 @@ func (g *GameManager) GainFood(socket Socket) (*Message, error) {
 	return nil, game.GainFood(socket)
 }
 
-func (g *GameManager) ChooseFood(socket Socket, payload map[string]any) (*Message, error) {
+func (g *GameManager) ChooseFood(socket Socket, chosen map[FoodType]int) (*Message, error) {
 	game, err := g.GetSocketGame(socket)
 	if err != nil {
 		return nil, err
 	}
-
-	var chosen map[FoodType]int
-	if err := ParsePayload(payload, &chosen); err != nil {
-		return nil, err
-	}
-
 	return nil, game.ChooseFood(socket, chosen)
 }
 
@@ -161,73 +196,57 @@ func (g *GameManager) LayEggsOnBirds(socket Socket, chosen map[BirdID]int) (*Mes
 	return nil, game.LayEggsOnBirds(socket, chosen)
 }
 
-func (g *GameManager) PlayCard(socket Socket, birdId float64) (*Message, error) {
+func (g *GameManager) PlayCard(socket Socket, birdId BirdID) (*Message, error) {
 	game, err := g.GetSocketGame(socket)
 	if err != nil {
 		return nil, err
 	}
-	return nil, game.PlayBird(socket, BirdID(birdId))
+	return nil, game.PlayBird(socket, birdId)
 }
 
-func (g *GameManager) PayBirdCost(socket Socket, payload map[string]any) (*Message, error) {
+func (g *GameManager) PayBirdCost(socket Socket, payload PayBirdCostPayload) (*Message, error) {
 	game, err := g.GetSocketGame(socket)
 	if err != nil {
 		return nil, err
 	}
-
-	var data struct {
-		BirdID BirdID
-		Food   []FoodType
-		Eggs   map[BirdID]int
-	}
-
-	if err := ParsePayload(payload, &data); err != nil {
-		return nil, err
-	}
-
-	return nil, game.PayBirdCost(socket, data.BirdID, data.Food, data.Eggs)
+	return nil, game.PayBirdCost(socket, payload.BirdID, payload.Food, payload.Eggs)
 }
 
-func (g *GameManager) ActivatePower(socket Socket, birdId float64) (*Message, error) {
+func (g *GameManager) ActivatePower(socket Socket, birdId BirdID) (*Message, error) {
 	game, err := g.GetSocketGame(socket)
 	if err != nil {
 		return nil, err
 	}
-	return nil, game.ActivatePower(socket, BirdID(birdId))
+	return nil, game.ActivatePower(socket, birdId)
 }
 
-func (g *GameManager) PlayerInfo(socket Socket, playerId string) (*Message, error) {
-	uuid, err := uuid.Parse(playerId)
-	if err != nil {
-		return nil, err
-	}
-
-	value, ok := g.players.Load(uuid)
+func (g *GameManager) PlayerInfo(socket Socket, playerId uuid.UUID) (*Message, error) {
+	value, ok := g.players.Load(playerId)
 	if !ok {
 		return nil, ErrGameNotFound
 	}
 
 	game := value.(*Game)
-	player := game.GetPlayer(uuid)
+	player := game.GetPlayer(playerId)
 
 	if player == nil {
 		return nil, ErrPlayerNotFound
 	}
 
-	// if this socket points to no games, store it for the game found
-	if _, ok := g.games.Load(socket); !ok {
-		player.socket = socket
-		g.games.Store(socket, game)
-		game.players.Store(socket, player)
-		game.sockets.Store(player, socket)
+	// only the player's own session may take the seat over
+	if player.Kicked() || player.Owner() != socket.Session().ID() {
+		return nil, ErrNotSeatOwner
 	}
 
+	game.Rebind(player, socket)
+	g.games.Store(player.Owner(), game)
+
 	current, err := game.CurrentPlayer()
 	if err != nil {
 		return nil, err
 	}
 
-	socket.Send(Response{
+	reply(socket, Response{
 		Type: PlayerInfo,
 		Payload: PlayerInfoPayload{
 			Board:      player.board,
@@ -239,26 +258,68 @@ func (g *GameManager) PlayerInfo(socket Socket, playerId string) (*Message, erro
 			BirdTray:   game.BirdTray(),
 			TurnOrder:  game.TurnOrder(),
 			BirdFeeder: game.Birdfeeder(),
-			MaxTurns:   MAX_TURNS - game.currRound,
-			Duration:   game.turnDuration.Seconds(),
-			TimeLeft:   game.turnDuration.Seconds() - time.Since(game.turnStart).Seconds(),
+			MaxTurns:   game.rules.MaxTurns - game.currRound,
+			Duration:   game.rules.TurnDuration.Seconds(),
+			TimeLeft:   game.rules.TurnDuration.Seconds() - time.Since(game.turnStart).Seconds(),
 		},
 	})
 
 	return nil, nil
 }
 
+// Takes the seat back after reconnecting, replaying the events missed.
+// When some are too old to replay the client gets the full state instead
+func (g *GameManager) Resume(socket Socket, payload ResumePayload) (*Message, error) {
+	if !socket.Session().Protocol().Has(CapabilityResume) {
+		return nil, ErrNotNegotiated
+	}
+
+	value, ok := g.players.Load(payload.Player)
+	if !ok {
+		return nil, ErrGameNotFound
+	}
+
+	game := value.(*Game)
+	player := game.GetPlayer(payload.Player)
+	if player == nil {
+		return nil, ErrPlayerNotFound
+	}
+
+	previous := player.Owner()
+	complete, err := game.Resume(socket, payload.Player, payload.Token, payload.Seq)
+	if err != nil {
+		return nil, err
+	}
+
+	g.games.Delete(previous)
+	g.games.Store(socket.Session().ID(), game)
+	game.logger.Info("Player resumed", "player", payload.Player, "session", socket.Session().ID(), "conn", socket.Session().ConnectionID(), "complete", complete)
+
+	if !complete {
+		return g.PlayerInfo(socket, payload.Player)
+	}
+
+	reply(socket, Response{Type: Resumed, Payload: payload.Player})
+	return nil, nil
+}
+
 func (g *GameManager) EndTurn(socket Socket) (*Message, error) {
 	game, err := g.GetSocketGame(socket)
 	if err != nil {
 		return nil, err
 	}
+	return nil, g.endTurn(game)
+}
 
-	err = game.EndTurn()
+// Ends the current turn, sending the results when it was the
+// last of the game and announcing the end of the round
+func (g *GameManager) endTurn(game *Game) error {
+	err := game.EndTurn()
 
 	if err != nil {
 		if err == ErrGameOver {
 			winner, losers := game.GetResult()
+			game.logger.Info("Game results sent", "winner", winner.ID, "losers", len(losers))
 
 			winner.Send(Response{
 				Type:    GameOver,
@@ -272,37 +333,224 @@ func (g *GameManager) EndTurn(socket Socket) (*Message, error) {
 				})
 			}
 
-			game.players.Range(func(socket, value any) bool {
-				g.games.Delete(socket.(Socket))
-				g.players.Delete(value.(*Player).ID)
-				return true
-			})
+			g.remove(game)
 		}
 		if err == ErrRoundEnded {
 			game.Broadcast(Response{Type: RoundEnded})
 		}
-		return nil, nil
+		return nil
 	}
 
-	return nil, err
+	return err
 }
 
+func (g *GameManager) remove(game *Game) {
+	game.players.Range(func(id, value any) bool {
+		g.games.Delete(id)
+		g.players.Delete(value.(*Player).ID)
+		return true
+	})
+}
+
+// Games in progress, including those still being set up
+func (g *GameManager) Games() []GameSummary {
+	summaries := make([]GameSummary, 0)
+	for _, game := range g.activeGames() {
+		summaries = append(summaries, game.Summary())
+	}
+	return summaries
+}
+
+// Number of games in progress
+func (g *GameManager) Active() int {
+	return len(g.activeGames())
+}
+
+func (g *GameManager) FindGame(id uuid.UUID) (*Game, error) {
+	for _, game := range g.activeGames() {
+		if game.ID == id {
+			return game, nil
+		}
+	}
+	return nil, ErrGameNotFound
+}
+
+// Ends the current player's turn as if its timer had run out
+func (g *GameManager) ForceEndTurn(id uuid.UUID) error {
+	game, err := g.FindGame(id)
+	if err != nil {
+		return err
+	}
+
+	// players discarding food are queued as they finish,
+	// turns only start once all of them did
+	current, err := game.CurrentPlayer()
+	if err != nil || !game.turnOrder.Full() {
+		return ErrNoPlayerReady
+	}
+
+	game.logger.Warn("Turn ended by an operator", "player", current.ID, "round", game.Round())
+	return g.endTurn(game)
+}
+
+func (g *GameManager) CancelGame(id uuid.UUID) error {
+	game, err := g.FindGame(id)
+	if err != nil {
+		return err
+	}
+
+	game.Cancel()
+	g.remove(game)
+	game.logger.Warn("Game canceled", "reason", "operator")
+	return nil
+}
+
+// Removes the player from the game, ending their turn
+// right away when it was theirs
+func (g *GameManager) Kick(id uuid.UUID, playerId uuid.UUID) error {
+	game, err := g.FindGame(id)
+	if err != nil {
+		return err
+	}
+
+	player := game.GetPlayer(playerId)
+	if player == nil {
+		return ErrPlayerNotFound
+	}
+
+	// the socket is closed once kicked, its disconnect
+	// must not find the game anymore
+	g.games.Delete(player.Owner())
+	if _, err := game.Kick(playerId); err != nil {
+		return err
+	}
+	game.logger.Warn("Player kicked", "player", playerId, "session", player.Owner())
+
+	if current, err := game.CurrentPlayer(); err == nil && current == player && game.turnOrder.Full() {
+		return g.endTurn(game)
+	}
+	return nil
+}
+
+// The seat is kept for the player to resume
 func (g *GameManager) Disconnect(socket Socket) (*Message, error) {
 	game, err := g.GetSocketGame(socket)
 	if err != nil {
 		return nil, err
 	}
-	if err := game.Disconnect(socket); err != nil {
-		return nil, err
+	game.logger.Info("Player disconnected", "session", socket.Session().ID(), "conn", socket.Session().ConnectionID())
+	return nil, game.Disconnect(socket)
+}
+
+// Waits for games in progress to finish until ctx is done,
+// the ones still running by then are stopped and snapshotted
+// to the snapshot directory
+func (g *GameManager) Drain(ctx context.Context) error {
+	g.mutex.Lock()
+	g.draining = true
+	g.mutex.Unlock()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for len(g.activeGames()) > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			for _, game := range g.activeGames() {
+				game.Stop()
+				game.logger.Warn("Game stopped while draining", "round", game.Round())
+
+				snapshot := game.Snapshot()
+				g.mutex.Lock()
+				g.snapshots = append(g.snapshots, snapshot)
+				g.mutex.Unlock()
+
+				if path, err := g.writeSnapshot(snapshot); err != nil {
+					game.logger.Error("Could not write snapshot", "error", err)
+				} else if path != "" {
+					game.logger.Info("Snapshot written", "path", path)
+				}
+			}
+			return ctx.Err()
+		}
 	}
-	g.games.Delete(socket)
-	return nil, nil
+
+	return nil
+}
+
+// Games stopped while draining
+func (g *GameManager) Snapshots() []GameSnapshot {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return append([]GameSnapshot{}, g.snapshots...)
+}
+
+// Writes to a temporary file first so a crash does not leave the snapshot truncated
+func (g *GameManager) writeSnapshot(snapshot GameSnapshot) (string, error) {
+	if g.snapshotDir == "" {
+		return "", nil
+	}
+
+	if err := os.MkdirAll(g.snapshotDir, 0700); err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(g.snapshotDir, snapshot.ID.String()+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp, path)
+}
+
+func (g *GameManager) CollectMetrics(metrics *Metrics) {
+	metrics.Gauge("wingspan_games_active", "Games in progress by round")
+	metrics.Counter("wingspan_turn_timeouts_total", "Turns ended by their timer")
+	metrics.Counter("wingspan_games_canceled_total", "Games canceled before every player was ready")
+
+	rounds := make(map[int]int)
+	for _, game := range g.activeGames() {
+		rounds[game.Round()]++
+	}
+	for round, games := range rounds {
+		metrics.Set("wingspan_games_active", float64(games), "round", strconv.Itoa(round))
+	}
+
+	metrics.Add("wingspan_turn_timeouts_total", float64(g.counters.TurnTimeouts.Load()))
+	metrics.Add("wingspan_games_canceled_total", float64(g.counters.Canceled.Load()))
+}
+
+func (g *GameManager) activeGames() []*Game {
+	games := make([]*Game, 0)
+	seen := make(map[*Game]bool)
+
+	g.players.Range(func(_, value any) bool {
+		game := value.(*Game)
+		if !seen[game] && !game.Over() {
+			games = append(games, game)
+		}
+		seen[game] = true
+		return true
+	})
+
+	return games
 }
 
 func (g *GameManager) GetSocketGame(socket Socket) (*Game, error) {
-	value, ok := g.games.Load(socket)
+	value, ok := g.games.Load(socket.Session().ID())
 	if !ok {
 		return nil, ErrGameNotFound
 	}
 	return value.(*Game), nil
 }
+
+func (g *GameManager) InternalMethods() []string {
+	return []string{"Create", "Disconnect"}
+}
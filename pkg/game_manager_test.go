@@ -1,8 +1,15 @@
 package pkg_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
-	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -34,6 +41,11 @@ func assertFoodQty(t testing.TB, food map[pkg.FoodType]int, expected int) {
 }
 
 func TestGameManager(t *testing.T) {
+	resumable := pkg.Protocol{
+		Version:      pkg.PROTOCOL_VERSION,
+		Capabilities: map[string]bool{pkg.CapabilityResume: true, pkg.CapabilitySeq: true},
+	}
+
 	discardFood := func(t testing.TB, player pkg.Socket, manager *pkg.GameManager) {
 		t.Helper()
 
@@ -42,12 +54,12 @@ func TestGameManager(t *testing.T) {
 		var payload pkg.ChooseResources
 		pkg.ParsePayload(response.Payload, &payload)
 
-		keys := []string{}
+		keys := []pkg.FoodType{}
 		for k := range payload.Food {
-			keys = append(keys, strconv.FormatInt(int64(k), 10))
+			keys = append(keys, k)
 		}
 
-		if _, err := manager.DiscardFood(player, map[string]any{keys[0]: 0}); err != nil {
+		if _, err := manager.DiscardFood(player, map[pkg.FoodType]int{keys[0]: 0}); err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
 	}
@@ -58,12 +70,12 @@ func TestGameManager(t *testing.T) {
 		p1 := pkg.NewTestSocket()
 		manager.Create(nil, []pkg.Socket{p1})
 
-		if _, err := manager.ChooseBirds(p1, []any{169}); err != nil {
+		if _, err := manager.ChooseBirds(p1, []pkg.BirdID{169}); err != nil {
 			t.Errorf("Expecte no error, got %v", err)
 		}
 
 		p2 := pkg.NewTestSocket()
-		if _, err := manager.ChooseBirds(p2, []any{1}); err == nil {
+		if _, err := manager.ChooseBirds(p2, []pkg.BirdID{1}); err == nil {
 			t.Error("Expected error, got nothing")
 		}
 	})
@@ -114,7 +126,7 @@ func TestGameManager(t *testing.T) {
 			t.Fatalf("Error parsing payload: %v", err)
 		}
 
-		chosenBirds := []any{payload.Birds[0].ID, payload.Birds[4].ID}
+		chosenBirds := []pkg.BirdID{payload.Birds[0].ID, payload.Birds[4].ID}
 		if _, err := manager.ChooseBirds(p1, chosenBirds); err != nil {
 			t.Errorf("Error chosing birds: %v", err)
 		}
@@ -169,11 +181,11 @@ func TestGameManager(t *testing.T) {
 		go manager.Create(nil, []pkg.Socket{p1})
 		go manager.Create(nil, []pkg.Socket{p2})
 
-		go manager.ChooseBirds(p1, []any{0})
-		go manager.ChooseBirds(p2, []any{0})
+		go manager.ChooseBirds(p1, []pkg.BirdID{0})
+		go manager.ChooseBirds(p2, []pkg.BirdID{0})
 
-		go manager.DiscardFood(p1, map[string]any{})
-		go manager.DiscardFood(p2, map[string]any{})
+		go manager.DiscardFood(p1, map[pkg.FoodType]int{})
+		go manager.DiscardFood(p2, map[pkg.FoodType]int{})
 	})
 
 	t.Run("game over", func(t *testing.T) {
@@ -226,6 +238,35 @@ func TestGameManager(t *testing.T) {
 		}
 	})
 
+	t.Run("game over on a timed out turn", func(t *testing.T) {
+		rules := pkg.DefaultRules()
+		rules.MaxRounds = 1
+		rules.MaxTurns = 1
+		rules.TurnDuration = 20 * time.Millisecond
+		manager := pkg.NewGameManagerWithRules(rules)
+
+		p1 := pkg.NewTestSocket()
+		p2 := pkg.NewTestSocket()
+
+		manager.Create(nil, []pkg.Socket{p1, p2})
+
+		discardFood(t, p1, manager)
+		discardFood(t, p2, manager)
+
+		// both turns time out, the second one ends the game
+		time.Sleep(100 * time.Millisecond)
+
+		assertResponse(t, p1, pkg.GameOver)
+		assertResponse(t, p2, pkg.GameOver)
+
+		if _, err := manager.GetSocketGame(p1); err != pkg.ErrGameNotFound {
+			t.Errorf("expected error %v, got %v", pkg.ErrGameNotFound, err)
+		}
+		if _, err := manager.GetSocketGame(p2); err != pkg.ErrGameNotFound {
+			t.Errorf("expected error %v, got %v", pkg.ErrGameNotFound, err)
+		}
+	})
+
 	t.Run("round end", func(t *testing.T) {
 		manager := pkg.NewGameManager()
 
@@ -332,7 +373,14 @@ func TestGameManager(t *testing.T) {
 
 		time.Sleep(100 * time.Millisecond)
 
-		if _, err := manager.PlayerInfo(p1, players[1].ID.String()); err != nil {
+		var seat *pkg.Player
+		for _, player := range players {
+			if player.Owner() == p1.Session().ID() {
+				seat = player
+			}
+		}
+
+		if _, err := manager.PlayerInfo(p1, seat.ID); err != nil {
 			t.Fatalf("could not get player info: %v", err)
 		}
 
@@ -399,18 +447,22 @@ func TestGameManager(t *testing.T) {
 		game, _ := manager.GetSocketGame(p1)
 		players := game.TurnOrder()
 
-		if _, err := manager.PlayerInfo(socket, players[0].ID.String()); err != nil {
-			t.Error("should not be able to attach to an existing socket")
+		if _, err := manager.PlayerInfo(socket, players[0].ID); err != pkg.ErrNotSeatOwner {
+			t.Errorf("expected error %v, got %v", pkg.ErrNotSeatOwner, err)
 		}
 	})
 
 	t.Run("player info new socket", func(t *testing.T) {
 		manager := pkg.NewGameManager()
+		account := &pkg.Account{ID: "p2"}
 
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
 		socket := pkg.NewTestSocket()
 
+		p2.Session().Authenticate(account)
+		socket.Session().Authenticate(account)
+
 		manager.Create(nil, []pkg.Socket{p1, p2})
 		discardFood(t, p1, manager)
 		discardFood(t, p2, manager)
@@ -420,7 +472,7 @@ func TestGameManager(t *testing.T) {
 
 		game.Disconnect(p2)
 
-		if _, err := manager.PlayerInfo(socket, players[1].ID.String()); err != nil {
+		if _, err := manager.PlayerInfo(socket, players[1].ID); err != nil {
 			t.Fatalf("could not get player info: %v", err)
 		}
 
@@ -437,4 +489,271 @@ func TestGameManager(t *testing.T) {
 			t.Errorf("removed socket should not receive responses, got %v", res)
 		}
 	})
+	t.Run("resume", func(t *testing.T) {
+		manager := pkg.NewGameManager()
+
+		p1 := pkg.NewTestSocket()
+		p2 := pkg.NewTestSocket()
+		socket := pkg.NewTestSocket()
+
+		p2.Session().SetProtocol(resumable)
+		socket.Session().SetProtocol(resumable)
+
+		manager.Create(nil, []pkg.Socket{p1, p2})
+		discardFood(t, p1, manager)
+		discardFood(t, p2, manager)
+
+		turn, _ := p2.GetResponse()
+		assertResponse(t, p2, pkg.RoundStarted)
+		response := assertResponse(t, p2, pkg.GameStarted)
+
+		var started pkg.GameStartedPayload
+		pkg.ParsePayload(response.Payload, &started)
+
+		// legacy clients only get their ID
+		p1.GetResponse()
+		assertResponse(t, p1, pkg.RoundStarted)
+		legacy := assertResponse(t, p1, pkg.GameStarted)
+
+		if _, ok := legacy.Payload.(string); !ok {
+			t.Errorf("expected player ID, got %v", legacy.Payload)
+		}
+
+		game, _ := manager.GetSocketGame(p2)
+
+		if _, err := manager.Disconnect(p2); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		game.Broadcast(pkg.Response{Type: pkg.MatchFound})
+
+		if _, err := manager.Resume(socket, pkg.ResumePayload{Player: started.ID, Token: "invalid"}); err != pkg.ErrInvalidResumeToken {
+			t.Errorf("expected error %v, got %v", pkg.ErrInvalidResumeToken, err)
+		}
+
+		if _, err := manager.Resume(socket, pkg.ResumePayload{Player: started.ID, Token: started.Token, Seq: turn.Seq}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		assertResponse(t, socket, pkg.Resumed)
+		missed := assertResponse(t, socket, pkg.MatchFound)
+
+		if missed.Seq != turn.Seq+1 {
+			t.Errorf("expected seq %v, got %v", turn.Seq+1, missed.Seq)
+		}
+		if _, err := manager.GetSocketGame(socket); err != nil {
+			t.Errorf("expected seat to be resumed, got %v", err)
+		}
+		if _, err := manager.GetSocketGame(p2); err != pkg.ErrGameNotFound {
+			t.Errorf("expected error %v, got %v", pkg.ErrGameNotFound, err)
+		}
+	})
+
+	t.Run("resume and seq are negotiated", func(t *testing.T) {
+		manager := pkg.NewGameManager()
+
+		p1 := pkg.NewTestSocket()
+		p2 := pkg.NewTestSocket()
+		p2.Session().SetProtocol(pkg.Protocol{Version: pkg.PROTOCOL_VERSION})
+
+		manager.Create(nil, []pkg.Socket{p1, p2})
+		discardFood(t, p1, manager)
+		discardFood(t, p2, manager)
+
+		turn, _ := p2.GetResponse()
+		if turn.Seq != 0 {
+			t.Errorf("expected no seq, got %v", turn.Seq)
+		}
+		assertResponse(t, p2, pkg.RoundStarted)
+		response := assertResponse(t, p2, pkg.GameStarted)
+
+		var started pkg.GameStartedPayload
+		pkg.ParsePayload(response.Payload, &started)
+		manager.Disconnect(p2)
+
+		socket := pkg.NewTestSocket()
+		socket.Session().SetProtocol(pkg.Protocol{Version: pkg.PROTOCOL_VERSION})
+		if _, err := manager.Resume(socket, pkg.ResumePayload{Player: started.ID, Token: started.Token}); err != pkg.ErrNotNegotiated {
+			t.Errorf("expected error %v, got %v", pkg.ErrNotNegotiated, err)
+		}
+	})
+
+	t.Run("resume races broadcasts", func(t *testing.T) {
+		manager := pkg.NewGameManager()
+
+		p1 := pkg.NewTestSocket()
+		p2 := pkg.NewTestSocket()
+		p2.Session().SetProtocol(resumable)
+
+		manager.Create(nil, []pkg.Socket{p1, p2})
+		discardFood(t, p1, manager)
+		discardFood(t, p2, manager)
+
+		turn, _ := p2.GetResponse()
+		assertResponse(t, p2, pkg.RoundStarted)
+		response := assertResponse(t, p2, pkg.GameStarted)
+
+		var started pkg.GameStartedPayload
+		pkg.ParsePayload(response.Payload, &started)
+
+		game, _ := manager.GetSocketGame(p2)
+		var socket pkg.Socket = p2
+		last := turn.Seq
+
+		for i := 0; i < 500; i++ {
+			manager.Disconnect(socket)
+
+			client, pipe := pkg.NewPipe()
+			pipe.Session().SetProtocol(resumable)
+			socket = pipe
+			var broadcasts sync.WaitGroup
+			for j := 0; j < 4; j++ {
+				broadcasts.Add(1)
+				go func() {
+					defer broadcasts.Done()
+					for k := 0; k < 5; k++ {
+						game.Broadcast(pkg.Response{Type: pkg.RoundEnded})
+					}
+				}()
+			}
+
+			if _, err := manager.Resume(socket, pkg.ResumePayload{Player: started.ID, Token: started.Token, Seq: last}); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			broadcasts.Wait()
+
+			// every event once and in order, replayed or not
+			for target := last + 20; last < target; {
+				event, err := client.Receive(time.Second)
+				if err != nil {
+					t.Fatalf("expected seq %v, got %v", last+1, err)
+				}
+				if event.Seq == 0 {
+					continue
+				}
+				if event.Seq != last+1 {
+					t.Fatalf("expected seq %v, got %v", last+1, event.Seq)
+				}
+				last = event.Seq
+			}
+		}
+	})
+
+	t.Run("logs the seed of every game", func(t *testing.T) {
+		var logs bytes.Buffer
+		manager := pkg.NewGameManager()
+		manager.SetLogger(pkg.NewLogger(&logs, pkg.DefaultLogLevels()))
+
+		manager.Create(nil, []pkg.Socket{pkg.NewTestSocket(), pkg.NewTestSocket()})
+		games := manager.Games()
+		if len(games) != 1 {
+			t.Fatalf("expected %v game, got %v", 1, len(games))
+		}
+
+		seed := fmt.Sprintf(`"seed":%v`, games[0].Seed)
+		if !strings.Contains(logs.String(), seed) {
+			t.Errorf("expected %v logged, got %v", seed, logs.String())
+		}
+	})
+
+	t.Run("setup timeout ends the game", func(t *testing.T) {
+		rules := pkg.DefaultRules()
+		rules.SetupDuration = time.Millisecond
+		manager := pkg.NewGameManagerWithRules(rules)
+
+		p1 := pkg.NewTestSocket()
+		manager.Create(nil, []pkg.Socket{p1, pkg.NewTestSocket()})
+		time.Sleep(20 * time.Millisecond)
+
+		if games := manager.Games(); len(games) != 0 {
+			t.Errorf("Expected no games, got %v", games)
+		}
+		if _, err := manager.GetSocketGame(p1); err != pkg.ErrGameNotFound {
+			t.Errorf("Expected error %v, got %v", pkg.ErrGameNotFound, err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		if err := manager.Drain(ctx); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	t.Run("collects metrics", func(t *testing.T) {
+		rules := pkg.DefaultRules()
+		rules.SetupDuration = 20 * time.Millisecond
+		manager := pkg.NewGameManagerWithRules(rules)
+
+		manager.Create(nil, []pkg.Socket{pkg.NewTestSocket(), pkg.NewTestSocket()})
+
+		metrics := pkg.NewMetrics()
+		manager.CollectMetrics(metrics)
+
+		if games := metrics.Value("wingspan_games_active", "round", "0"); games != 1 {
+			t.Errorf("Expected a game on round 0, got %v", games)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		metrics = pkg.NewMetrics()
+		manager.CollectMetrics(metrics)
+
+		if games := metrics.Value("wingspan_games_active", "round", "0"); games != 0 {
+			t.Errorf("Expected the canceled game to be gone, got %v", games)
+		}
+		if canceled := metrics.Value("wingspan_games_canceled_total"); canceled != 1 {
+			t.Errorf("Expected a canceled game, got %v", canceled)
+		}
+	})
+
+	t.Run("drain", func(t *testing.T) {
+		manager := pkg.NewGameManager()
+		dir := t.TempDir()
+		manager.SetSnapshotDir(dir)
+
+		p1 := pkg.NewTestSocket()
+		p2 := pkg.NewTestSocket()
+
+		manager.Create(nil, []pkg.Socket{p1, p2})
+		discardFood(t, p1, manager)
+		discardFood(t, p2, manager)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if err := manager.Drain(ctx); err != context.DeadlineExceeded {
+			t.Errorf("expected error %v, got %v", context.DeadlineExceeded, err)
+		}
+
+		snapshots := manager.Snapshots()
+		if len(snapshots) != 1 {
+			t.Fatalf("expected %v snapshot, got %v", 1, len(snapshots))
+		}
+		if len(snapshots[0].Players) != 2 {
+			t.Errorf("expected %v players, got %v", 2, len(snapshots[0].Players))
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, snapshots[0].ID.String()+".json"))
+		if err != nil {
+			t.Fatalf("expected the snapshot to be written, got %v", err)
+		}
+		var written pkg.GameSnapshot
+		if err := json.Unmarshal(data, &written); err != nil {
+			t.Fatalf("could not decode snapshot: %v", err)
+		}
+		if written.ID != snapshots[0].ID || len(written.Players) != 2 {
+			t.Errorf("expected snapshot of game %v with %v players, got %v with %v", snapshots[0].ID, 2, written.ID, len(written.Players))
+		}
+
+		game, _ := manager.GetSocketGame(p1)
+		if err := game.StartTurn(); err != pkg.ErrGameStopped {
+			t.Errorf("expected error %v, got %v", pkg.ErrGameStopped, err)
+		}
+
+		p3 := pkg.NewTestSocket()
+		if _, err := manager.Create(nil, []pkg.Socket{p3}); err != pkg.ErrServerDraining {
+			t.Errorf("expected error %v, got %v", pkg.ErrServerDraining, err)
+		}
+		assertResponse(t, p3, pkg.GameCanceled)
+	})
 }
@@ -1,15 +1,29 @@
 package pkg_test
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"git.internal.com/wingspan/pkg"
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 )
 
+// Seeds every game so dice rolls don't decide whether a test passes
+const TEST_SEED = 4
+
 func TestGame(t *testing.T) {
+	newGame := func(sockets []pkg.Socket, turnDuration time.Duration) (*pkg.Game, error) {
+		rules := pkg.DefaultRules()
+		rules.TurnDuration = turnDuration
+		return pkg.NewGameWithSeed(sockets, rules, TEST_SEED)
+	}
+
 	discardFood := func(t testing.TB, player pkg.Socket, game *pkg.Game) {
 		t.Helper()
 
@@ -29,7 +43,7 @@ func TestGame(t *testing.T) {
 	}
 
 	t.Run("create without players", func(t *testing.T) {
-		_, err := pkg.NewGame([]pkg.Socket{}, time.Second)
+		_, err := newGame([]pkg.Socket{}, time.Second)
 
 		if err == nil {
 			t.Fatal("Expected error, got nothing")
@@ -41,7 +55,7 @@ func TestGame(t *testing.T) {
 
 	t.Run("create", func(t *testing.T) {
 		socket := pkg.NewTestSocket()
-		game, err := pkg.NewGame([]pkg.Socket{socket}, time.Second)
+		game, err := newGame([]pkg.Socket{socket}, time.Second)
 
 		if err != nil {
 			t.Errorf("Expected no error, got %v", err)
@@ -53,7 +67,7 @@ func TestGame(t *testing.T) {
 
 	t.Run("start", func(t *testing.T) {
 		socket := pkg.NewTestSocket()
-		game, _ := pkg.NewGame([]pkg.Socket{socket}, time.Second)
+		game, _ := newGame([]pkg.Socket{socket}, time.Second)
 
 		game.Start(time.Second)
 		response := assertResponse(t, socket, pkg.ChooseCards)
@@ -74,7 +88,7 @@ func TestGame(t *testing.T) {
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
 
-		game, _ := pkg.NewGame([]pkg.Socket{p1}, time.Second)
+		game, _ := newGame([]pkg.Socket{p1}, time.Second)
 		err := game.ChooseBirds(p2, []pkg.BirdID{0})
 
 		if err == nil {
@@ -87,7 +101,7 @@ func TestGame(t *testing.T) {
 
 	t.Run("choose invalid cards", func(t *testing.T) {
 		p1 := pkg.NewTestSocket()
-		game, _ := pkg.NewGame([]pkg.Socket{p1}, time.Second)
+		game, _ := newGame([]pkg.Socket{p1}, time.Second)
 
 		err := game.ChooseBirds(p1, []pkg.BirdID{9999})
 		if err == nil {
@@ -100,7 +114,7 @@ func TestGame(t *testing.T) {
 
 	t.Run("choose cards", func(t *testing.T) {
 		p1 := pkg.NewTestSocket()
-		game, _ := pkg.NewGame([]pkg.Socket{p1}, time.Second)
+		game, _ := newGame([]pkg.Socket{p1}, time.Second)
 
 		// keep just one
 		if err := game.ChooseBirds(p1, []pkg.BirdID{169}); err != nil {
@@ -116,10 +130,10 @@ func TestGame(t *testing.T) {
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
 
-		game, _ := pkg.NewGame([]pkg.Socket{p1, p2}, time.Second)
+		game, _ := newGame([]pkg.Socket{p1, p2}, time.Second)
 
 		game.Start(time.Millisecond)
-		time.Sleep(3 * time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
 
 		assertResponse(t, p1, pkg.GameCanceled)
 		assertResponse(t, p2, pkg.GameCanceled)
@@ -128,7 +142,7 @@ func TestGame(t *testing.T) {
 	t.Run("discard food no game", func(t *testing.T) {
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
-		game, _ := pkg.NewGame([]pkg.Socket{p1}, time.Second)
+		game, _ := newGame([]pkg.Socket{p1}, time.Second)
 		_, err := game.DiscardFood(p2, map[pkg.FoodType]int{pkg.Fish: 1})
 
 		if err == nil {
@@ -141,7 +155,7 @@ func TestGame(t *testing.T) {
 
 	t.Run("discard food", func(t *testing.T) {
 		p1 := pkg.NewTestSocket()
-		game, _ := pkg.NewGame([]pkg.Socket{p1}, time.Second)
+		game, _ := newGame([]pkg.Socket{p1}, time.Second)
 		game.Start(time.Second)
 
 		response := assertResponse(t, p1, pkg.ChooseCards)
@@ -168,8 +182,8 @@ func TestGame(t *testing.T) {
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
 
-		game, _ := pkg.NewGame([]pkg.Socket{p1, p2}, time.Second)
-		game.Start(2 * time.Millisecond)
+		game, _ := newGame([]pkg.Socket{p1, p2}, time.Second)
+		game.Start(20 * time.Millisecond)
 
 		response, _ := p1.GetResponse()
 		var payload pkg.ChooseResources
@@ -184,7 +198,7 @@ func TestGame(t *testing.T) {
 			t.Fatalf("expected no error, got %v", err)
 		}
 
-		time.Sleep(3 * time.Millisecond)
+		time.Sleep(100 * time.Millisecond)
 
 		assertResponse(t, p1, pkg.GameCanceled)
 		assertResponse(t, p2, pkg.GameCanceled)
@@ -198,7 +212,7 @@ func TestGame(t *testing.T) {
 			pkg.NewTestSocket(),
 		}
 
-		game, _ := pkg.NewGame(players, time.Minute)
+		game, _ := newGame(players, time.Minute)
 		game.Start(time.Minute)
 
 		// Discard food for both players
@@ -255,7 +269,7 @@ func TestGame(t *testing.T) {
 
 	t.Run("start turn no player ready", func(t *testing.T) {
 		p1 := pkg.NewTestSocket()
-		game, _ := pkg.NewGame([]pkg.Socket{p1}, time.Second)
+		game, _ := newGame([]pkg.Socket{p1}, time.Second)
 
 		if err := game.StartTurn(); err == nil {
 			t.Error("Expected error got nothing")
@@ -266,14 +280,15 @@ func TestGame(t *testing.T) {
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
 
-		game, _ := pkg.NewGame([]pkg.Socket{p1, p2}, 2*time.Millisecond)
+		// long enough to time out once but not twice
+		game, _ := newGame([]pkg.Socket{p1, p2}, 100*time.Millisecond)
 		game.Start(time.Second)
 
 		discardFood(t, p1, game)
 		discardFood(t, p2, game)
 
 		game.StartTurn()
-		time.Sleep(3 * time.Millisecond)
+		time.Sleep(150 * time.Millisecond)
 
 		assertResponse(t, p1, pkg.WaitTurn)
 		assertResponse(t, p2, pkg.StartTurn)
@@ -283,7 +298,7 @@ func TestGame(t *testing.T) {
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
 
-		game, _ := pkg.NewGame([]pkg.Socket{p1, p2}, time.Second)
+		game, _ := newGame([]pkg.Socket{p1, p2}, time.Second)
 		game.Start(time.Second)
 
 		discardFood(t, p1, game)
@@ -320,7 +335,7 @@ func TestGame(t *testing.T) {
 			pkg.NewTestSocket(),
 		}
 
-		game, _ := pkg.NewGame(players, time.Second)
+		game, _ := newGame(players, time.Second)
 		game.Start(time.Second)
 
 		for _, player := range players {
@@ -354,7 +369,7 @@ func TestGame(t *testing.T) {
 	t.Run("concurrency", func(t *testing.T) {
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
-		game, _ := pkg.NewGame([]pkg.Socket{p1, p2}, time.Second)
+		game, _ := newGame([]pkg.Socket{p1, p2}, time.Second)
 
 		game.Start(time.Millisecond)
 
@@ -393,11 +408,99 @@ func TestGame(t *testing.T) {
 		go game.PlayBird(p2, pkg.BirdID(1))
 	})
 
+	t.Run("everyone but the winner loses", func(t *testing.T) {
+		sockets := []pkg.Socket{pkg.NewTestSocket(), pkg.NewTestSocket(), pkg.NewTestSocket()}
+		game, _ := newGame(sockets, time.Second)
+
+		winner, losers := game.GetResult()
+		if winner == nil || len(losers) != 2 {
+			t.Fatalf("Expected a winner and 2 losers, got %v and %v", winner, len(losers))
+		}
+		for _, loser := range losers {
+			if loser == winner {
+				t.Error("Expected the winner not to be among the losers")
+			}
+		}
+	})
+
+	t.Run("kick tells the player before closing", func(t *testing.T) {
+		sockets := make(chan *pkg.Sockt, 1)
+		upgrader := new(websocket.Upgrader)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if c, err := upgrader.Upgrade(w, r, nil); err == nil {
+				sockets <- pkg.NewSocket(c, nil)
+			}
+		}))
+		defer server.Close()
+
+		client, _, err := websocket.DefaultDialer.Dial(strings.Replace(server.URL, "http", "ws", 1), nil)
+		if err != nil {
+			t.Fatalf("Could not connect: %v", err)
+		}
+		defer client.Close()
+
+		socket := <-sockets
+		game, _ := newGame([]pkg.Socket{socket, pkg.NewTestSocket()}, time.Second)
+		for _, player := range game.Summary().Players {
+			if player.Session != socket.Session().ID() {
+				continue
+			}
+			if _, err := game.Kick(player.ID); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+
+		client.SetReadDeadline(time.Now().Add(time.Second))
+
+		var response pkg.Response
+		if err := client.ReadJSON(&response); err != nil || response.Payload != pkg.ErrPlayerKicked.Error() {
+			t.Fatalf("Expected %v, got %v %v", pkg.ErrPlayerKicked, response.Payload, err)
+		}
+		_, _, err = client.ReadMessage()
+		if closeErr, ok := err.(*websocket.CloseError); !ok || closeErr.Text != pkg.ErrPlayerKicked.Error() {
+			t.Errorf("Expected close with reason %v, got %v", pkg.ErrPlayerKicked, err)
+		}
+	})
+
+	t.Run("same seed deals the same game", func(t *testing.T) {
+		deal := func(seed int64) pkg.GameSnapshot {
+			sockets := []pkg.Socket{pkg.NewTestSocket(), pkg.NewTestSocket()}
+			game, err := pkg.NewGameWithSeed(sockets, pkg.DefaultRules(), seed)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if game.Seed() != seed {
+				t.Errorf("Expected seed %v, got %v", seed, game.Seed())
+			}
+			return game.Snapshot()
+		}
+
+		// players are listed in no particular order
+		food := func(snapshot pkg.GameSnapshot) map[string]bool {
+			dealt := make(map[string]bool)
+			for _, player := range snapshot.Players {
+				dealt[fmt.Sprint(player.Food)] = true
+			}
+			return dealt
+		}
+
+		first, second := deal(7), deal(7)
+		if !reflect.DeepEqual(first.BirdFeeder, second.BirdFeeder) {
+			t.Errorf("Expected birdfeeder %v, got %v", first.BirdFeeder, second.BirdFeeder)
+		}
+		if !reflect.DeepEqual(food(first), food(second)) {
+			t.Errorf("Expected food dealt %v, got %v", food(first), food(second))
+		}
+		if first.Seed != 7 {
+			t.Errorf("Expected seed 7 in the snapshot, got %v", first.Seed)
+		}
+	})
+
 	t.Run("resets bird tray when round ends", func(t *testing.T) {
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
 
-		game, _ := pkg.NewGame([]pkg.Socket{p1, p2}, time.Second)
+		game, _ := newGame([]pkg.Socket{p1, p2}, time.Second)
 		game.Start(time.Second)
 
 		original := game.BirdTray()
@@ -418,7 +521,7 @@ func TestGame(t *testing.T) {
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
 
-		game, _ := pkg.NewGame([]pkg.Socket{p1, p2}, time.Second)
+		game, _ := newGame([]pkg.Socket{p1, p2}, time.Second)
 		game.Start(time.Second)
 
 		discardFood(t, p1, game)
@@ -453,7 +556,7 @@ func TestGame(t *testing.T) {
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
 
-		game, _ := pkg.NewGame([]pkg.Socket{p1, p2}, time.Second)
+		game, _ := newGame([]pkg.Socket{p1, p2}, time.Second)
 		game.Start(time.Second)
 
 		discardFood(t, p1, game)
@@ -503,7 +606,7 @@ func TestGame(t *testing.T) {
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
 
-		game, _ := pkg.NewGame([]pkg.Socket{p1, p2}, time.Second)
+		game, _ := newGame([]pkg.Socket{p1, p2}, time.Second)
 		game.Start(time.Second)
 
 		discardFood(t, p1, game)
@@ -563,7 +666,7 @@ func TestGame(t *testing.T) {
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
 
-		game, _ := pkg.NewGame([]pkg.Socket{p1, p2}, time.Second)
+		game, _ := newGame([]pkg.Socket{p1, p2}, time.Second)
 		game.Start(time.Second)
 
 		discardFood(t, p1, game)
@@ -610,7 +713,7 @@ func TestGame(t *testing.T) {
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
 
-		game, _ := pkg.NewGame([]pkg.Socket{p1, p2}, time.Second)
+		game, _ := newGame([]pkg.Socket{p1, p2}, time.Second)
 		game.Start(time.Second)
 
 		discardFood(t, p1, game)
@@ -641,7 +744,7 @@ func TestGame(t *testing.T) {
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
 
-		game, _ := pkg.NewGame([]pkg.Socket{p1, p2}, time.Second)
+		game, _ := newGame([]pkg.Socket{p1, p2}, time.Second)
 		game.Start(time.Second)
 
 		discardFood(t, p1, game)
@@ -672,7 +775,7 @@ func TestGame(t *testing.T) {
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
 
-		game, _ := pkg.NewGame([]pkg.Socket{p1, p2}, time.Second)
+		game, _ := newGame([]pkg.Socket{p1, p2}, time.Second)
 		game.Start(time.Second)
 
 		discardFood(t, p1, game)
@@ -730,7 +833,7 @@ func TestGame(t *testing.T) {
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
 
-		game, _ := pkg.NewGame([]pkg.Socket{p1, p2}, time.Second)
+		game, _ := newGame([]pkg.Socket{p1, p2}, time.Second)
 		game.Start(time.Second)
 
 		discardFood(t, p1, game)
@@ -746,7 +849,7 @@ func TestGame(t *testing.T) {
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
 
-		game, _ := pkg.NewGame([]pkg.Socket{p1, p2}, time.Second)
+		game, _ := newGame([]pkg.Socket{p1, p2}, time.Second)
 		game.Start(time.Second)
 
 		discardFood(t, p1, game)
@@ -767,7 +870,7 @@ func TestGame(t *testing.T) {
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
 
-		game, _ := pkg.NewGame([]pkg.Socket{p1, p2}, time.Second)
+		game, _ := newGame([]pkg.Socket{p1, p2}, time.Second)
 		game.Start(time.Second)
 
 		discardFood(t, p1, game)
@@ -800,7 +903,7 @@ func TestGame(t *testing.T) {
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
 
-		game, _ := pkg.NewGame([]pkg.Socket{p1, p2}, time.Second)
+		game, _ := newGame([]pkg.Socket{p1, p2}, time.Second)
 		game.Start(time.Second)
 
 		discardFood(t, p1, game)
@@ -0,0 +1,411 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SESSION_TIMEOUT = 5 * time.Minute
+	POLL_TIMEOUT    = 30 * time.Second
+	MAX_SESSIONS    = 1000
+)
+
+var (
+	ErrSessionNotFound = errors.New("Session not found")
+	ErrTooManySessions = errors.New("Too many sessions")
+)
+
+// Socket for clients talking through the HTTP gateway, responses
+// are kept until the client polls or streams them
+type HTTPSocket struct {
+	Token   string
+	mutex   sync.Mutex
+	size    int
+	policy  SlowConsumerPolicy
+	events  []Response
+	notify  chan struct{}
+	timer   *time.Timer
+	closed  bool
+	session *Session
+	// event streams attached, the session does not expire while
+	// there are any
+	streams int
+	// called once the queue overflows with DisconnectSlowConsumers
+	overflow func()
+	// calls are handled one at a time, like the messages
+	// of a websocket connection
+	calls sync.Mutex
+}
+
+func NewHTTPSocket() *HTTPSocket {
+	return NewHTTPSocketWithQueue(0, DropResponses)
+}
+
+// Keeps at most size responses, applying policy to those sent
+// while full. Zero keeps them without bounds
+func NewHTTPSocketWithQueue(size int, policy SlowConsumerPolicy) *HTTPSocket {
+	return &HTTPSocket{
+		Token:   uuid.NewString(),
+		size:    size,
+		policy:  policy,
+		events:  make([]Response, 0),
+		notify:  make(chan struct{}, 1),
+		session: NewSession(),
+	}
+}
+
+func (h *HTTPSocket) Session() *Session {
+	return h.session
+}
+
+func (h *HTTPSocket) Send(response Response) (int, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	if h.size > 0 && len(h.events) >= h.size {
+		switch h.policy {
+		case CoalesceResponses:
+			for i := len(h.events) - 1; i >= 0; i-- {
+				if h.events[i].Type == response.Type {
+					h.events[i] = response
+					return 1, nil
+				}
+			}
+			return 0, nil
+		case DisconnectSlowConsumers:
+			if h.overflow != nil {
+				go h.overflow()
+			}
+			return 0, ErrSlowConsumer
+		default:
+			return 0, nil
+		}
+	}
+
+	h.events = append(h.events, response)
+
+	select {
+	case h.notify <- struct{}{}:
+	default:
+	}
+
+	return 1, nil
+}
+
+// Writes a JSON encoded response
+func (h *HTTPSocket) Write(data []byte) (int, error) {
+	var response Response
+	if err := json.Unmarshal(data, &response); err != nil {
+		return 0, err
+	}
+	if _, err := h.Send(response); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Reads pending responses as a JSON array
+func (h *HTTPSocket) Read(data []byte) (int, error) {
+	encoding, err := json.Marshal(h.Events())
+	if err != nil {
+		return 0, err
+	}
+	return copy(data, encoding), io.EOF
+}
+
+func (h *HTTPSocket) Close() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if !h.closed {
+		h.closed = true
+		close(h.notify)
+
+		if h.timer != nil {
+			h.timer.Stop()
+		}
+	}
+
+	return nil
+}
+
+// Keeps the session from expiring while a stream is attached
+func (h *HTTPSocket) attach() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.streams++
+	h.timer.Stop()
+}
+
+// Expires the session after timeout once no stream is attached
+func (h *HTTPSocket) detach(timeout time.Duration) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.streams--
+	if h.streams == 0 && !h.closed {
+		h.timer.Reset(timeout)
+	}
+}
+
+// Postpones expiring unless a stream is keeping the session alive
+func (h *HTTPSocket) keepAlive(timeout time.Duration) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.streams == 0 && !h.closed {
+		h.timer.Reset(timeout)
+	}
+}
+
+// Removes and returns pending responses
+func (h *HTTPSocket) Events() []Response {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	events := h.events
+	h.events = make([]Response, 0)
+	return events
+}
+
+// Waits until there are responses pending or the timeout is reached
+func (h *HTTPSocket) Wait(timeout time.Duration) []Response {
+	if events := h.Events(); len(events) > 0 {
+		return events
+	}
+
+	select {
+	case <-h.notify:
+	case <-time.After(timeout):
+	}
+
+	return h.Events()
+}
+
+// Exposes registered services over plain HTTP:
+//
+//	POST   /rpc/session           creates a session, replies with its token
+//	DELETE /rpc/session           closes the session
+//	POST   /rpc/{Service}.{Method} dispatches the JSON body as params
+//	GET    /events                streams responses as Server-Sent Events,
+//	                              or long polls them as a JSON array
+//
+// The token goes in the Authorization header as a bearer token,
+// or in the token query parameter for event sources
+type Gateway struct {
+	server   *Server
+	timeout  time.Duration
+	limit    int
+	count    atomic.Int64
+	sessions *sync.Map
+}
+
+func NewGateway(server *Server, timeout time.Duration) *Gateway {
+	return &Gateway{
+		server:   server,
+		timeout:  timeout,
+		limit:    MAX_SESSIONS,
+		sessions: new(sync.Map),
+	}
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/rpc/session" && r.Method == http.MethodPost:
+		g.createSession(w)
+	case r.URL.Path == "/rpc/session" && r.Method == http.MethodDelete:
+		g.closeSession(w, r)
+	case strings.HasPrefix(r.URL.Path, "/rpc/") && r.Method == http.MethodPost:
+		g.call(w, r)
+	case r.URL.Path == "/events" && r.Method == http.MethodGet:
+		g.events(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (g *Gateway) createSession(w http.ResponseWriter) {
+	if g.server.draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, errorResponse("", ErrServerDraining))
+		return
+	}
+
+	if count := g.count.Add(1); g.limit > 0 && count > int64(g.limit) {
+		g.count.Add(-1)
+		writeJSON(w, http.StatusServiceUnavailable, errorResponse("", ErrTooManySessions))
+		return
+	}
+
+	options := g.server.socketOptions
+	session := NewHTTPSocketWithQueue(options.QueueSize, options.SlowConsumer)
+	session.timer = time.AfterFunc(g.timeout, func() {
+		g.expire(session)
+	})
+	session.overflow = func() {
+		g.server.log.Warn("Closing slow consumer", "session", session.session.ID())
+		g.expire(session)
+	}
+	g.sessions.Store(session.Token, session)
+
+	writeJSON(w, http.StatusCreated, map[string]string{"Token": session.Token})
+}
+
+func (g *Gateway) closeSession(w http.ResponseWriter, r *http.Request) {
+	session, err := g.session(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse("", err))
+		return
+	}
+
+	g.expire(session)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (g *Gateway) call(w http.ResponseWriter, r *http.Request) {
+	session, err := g.session(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse("", err))
+		return
+	}
+
+	if max := g.server.socketOptions.MaxMessageSize; max > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		status := http.StatusBadRequest
+		if tooLarge := new(http.MaxBytesError); errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeJSON(w, status, errorResponse("", err))
+		return
+	}
+
+	message := Message{
+		ID:     r.Header.Get("X-Request-ID"),
+		Method: strings.TrimPrefix(r.URL.Path, "/rpc/"),
+	}
+	if len(body) > 0 {
+		message.Params = json.RawMessage(body)
+	}
+
+	session.calls.Lock()
+	reply, err := g.server.Dispatch(session, message)
+	session.calls.Unlock()
+	if err != nil {
+		status := http.StatusBadRequest
+		switch err {
+		case ErrServiceNotFound, ErrMethodNotFound:
+			status = http.StatusNotFound
+		case ErrRateLimited:
+			status = http.StatusTooManyRequests
+		case ErrTooManyViolations:
+			status = http.StatusTooManyRequests
+			g.expire(session)
+		}
+		writeJSON(w, status, errorResponse(message.ID, err))
+		return
+	}
+
+	if reply != nil {
+		g.server.bus.Publish(reply.Method, reply.Params)
+	}
+
+	writeJSON(w, http.StatusOK, Response{ID: message.ID, Type: Ack})
+}
+
+func (g *Gateway) events(w http.ResponseWriter, r *http.Request) {
+	session, err := g.session(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse("", err))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok || r.Header.Get("Accept") != "text/event-stream" {
+		writeJSON(w, http.StatusOK, session.Wait(POLL_TIMEOUT))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	session.attach()
+	defer session.detach(g.timeout)
+
+	for {
+		for _, event := range session.Events() {
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+		flusher.Flush()
+
+		select {
+		case _, open := <-session.notify:
+			if !open {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Finds the session for the request token and keeps it alive
+func (g *Gateway) session(r *http.Request) (*HTTPSocket, error) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+
+	value, ok := g.sessions.Load(token)
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	session := value.(*HTTPSocket)
+	session.keepAlive(g.timeout)
+	return session, nil
+}
+
+func (g *Gateway) expire(session *HTTPSocket) {
+	if _, ok := g.sessions.LoadAndDelete(session.Token); ok {
+		g.count.Add(-1)
+		session.Close()
+		g.server.disconnect(session)
+	}
+}
+
+func (g *Gateway) expireAll() {
+	g.sessions.Range(func(_, value any) bool {
+		g.expire(value.(*HTTPSocket))
+		return true
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,337 @@
+package pkg_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"git.internal.com/wingspan/pkg"
+)
+
+func TestGateway(t *testing.T) {
+	createSession := func(t testing.TB, url string) string {
+		t.Helper()
+
+		res, err := http.Post(url+"/rpc/session", "application/json", nil)
+		if err != nil {
+			t.Fatalf("Could not create session: %v", err)
+		}
+		defer res.Body.Close()
+
+		var session struct{ Token string }
+		json.NewDecoder(res.Body).Decode(&session)
+
+		if session.Token == "" {
+			t.Fatal("Expected session token")
+		}
+		return session.Token
+	}
+
+	call := func(t testing.TB, url, token, method, body string) (int, pkg.Response) {
+		t.Helper()
+
+		req, _ := http.NewRequest(http.MethodPost, url+"/rpc/"+method, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Could not call %v: %v", method, err)
+		}
+		defer res.Body.Close()
+
+		var response pkg.Response
+		json.NewDecoder(res.Body).Decode(&response)
+		return res.StatusCode, response
+	}
+
+	poll := func(t testing.TB, url, token string) []pkg.Response {
+		t.Helper()
+
+		req, _ := http.NewRequest(http.MethodGet, url+"/events", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Could not poll events: %v", err)
+		}
+		defer res.Body.Close()
+
+		var events []pkg.Response
+		json.NewDecoder(res.Body).Decode(&events)
+		return events
+	}
+
+	t.Run("requires session", func(t *testing.T) {
+		server := pkg.NewServer()
+		server.Register("Queue", pkg.NewQueue(2))
+
+		gateway := httptest.NewServer(server.Handler())
+		defer gateway.Close()
+
+		status, response := call(t, gateway.URL, "invalid", "Queue.Add", "")
+		if status != 401 {
+			t.Errorf("Expected status %v, got %v", 401, status)
+		}
+		if response.Type != pkg.Error {
+			t.Errorf("Expected type %v, got %v", pkg.Error, response.Type)
+		}
+	})
+
+	t.Run("call and poll", func(t *testing.T) {
+		server := pkg.NewServer()
+		server.Register("Queue", pkg.NewQueue(2))
+
+		gateway := httptest.NewServer(server.Handler())
+		defer gateway.Close()
+
+		token := createSession(t, gateway.URL)
+
+		status, response := call(t, gateway.URL, token, "Queue.Add", "")
+		if status != 200 {
+			t.Errorf("Expected status %v, got %v", 200, status)
+		}
+		if response.Type != pkg.Ack {
+			t.Errorf("Expected type %v, got %v", pkg.Ack, response.Type)
+		}
+
+		events := poll(t, gateway.URL, token)
+		if len(events) != 1 || events[0].Type != pkg.WaitForMatch {
+			t.Errorf("Expected %v, got %v", pkg.WaitForMatch, events)
+		}
+
+		status, _ = call(t, gateway.URL, token, "Queue.Add", "")
+		if status != 400 {
+			t.Errorf("Expected status %v, got %v", 400, status)
+		}
+
+		status, _ = call(t, gateway.URL, token, "Queue.Missing", "")
+		if status != 404 {
+			t.Errorf("Expected status %v, got %v", 404, status)
+		}
+	})
+
+	t.Run("invalid params", func(t *testing.T) {
+		server := pkg.NewServer()
+		server.Register("Game", new(FakeGame))
+
+		gateway := httptest.NewServer(server.Handler())
+		defer gateway.Close()
+
+		token := createSession(t, gateway.URL)
+
+		status, response := call(t, gateway.URL, token, "Game.ChooseBirds", `["bird"]`)
+		if status != 400 {
+			t.Errorf("Expected status %v, got %v", 400, status)
+		}
+
+		var invalid pkg.ValidationError
+		pkg.ParsePayload(response.Payload, &invalid)
+		if invalid.Method != "Game.ChooseBirds" {
+			t.Errorf("Expected method %v, got %v", "Game.ChooseBirds", invalid.Method)
+		}
+	})
+
+	t.Run("server sent events", func(t *testing.T) {
+		server := pkg.NewServer()
+		server.Register("Queue", pkg.NewQueue(2))
+		server.Register("Matchmaker", pkg.NewMatchmaker(time.Second))
+
+		gateway := httptest.NewServer(server.Handler())
+		defer gateway.Close()
+
+		p1 := createSession(t, gateway.URL)
+		p2 := createSession(t, gateway.URL)
+
+		req, _ := http.NewRequest(http.MethodGet, gateway.URL+"/events?token="+p1, nil)
+		req.Header.Set("Accept", "text/event-stream")
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Could not stream events: %v", err)
+		}
+		defer res.Body.Close()
+
+		call(t, gateway.URL, p1, "Queue.Add", "")
+		call(t, gateway.URL, p2, "Queue.Add", "")
+
+		types := make([]string, 0)
+		scanner := bufio.NewScanner(res.Body)
+		for len(types) < 2 && scanner.Scan() {
+			if strings.HasPrefix(scanner.Text(), "event: ") {
+				types = append(types, strings.TrimPrefix(scanner.Text(), "event: "))
+			}
+		}
+
+		if len(types) != 2 || types[0] != pkg.WaitForMatch || types[1] != pkg.MatchFound {
+			t.Errorf("Expected %v and %v, got %v", pkg.WaitForMatch, pkg.MatchFound, types)
+		}
+	})
+
+	t.Run("streams keep the session alive", func(t *testing.T) {
+		server := pkg.NewServer()
+		queue := pkg.NewQueue(2)
+		server.Register("Queue", queue)
+
+		gateway := httptest.NewServer(pkg.NewGateway(server, 50*time.Millisecond))
+		defer gateway.Close()
+
+		token := createSession(t, gateway.URL)
+		call(t, gateway.URL, token, "Queue.Add", "")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, gateway.URL+"/events?token="+token, nil)
+		req.Header.Set("Accept", "text/event-stream")
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Could not stream events: %v", err)
+		}
+
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			io.Copy(io.Discard, res.Body)
+		}()
+
+		select {
+		case <-closed:
+			t.Fatal("Expected the stream to stay open")
+		case <-time.After(200 * time.Millisecond):
+		}
+		if queue.Len() != 1 {
+			t.Errorf("Expected the session to stay queued, got %v queued", queue.Len())
+		}
+
+		cancel()
+		<-closed
+		res.Body.Close()
+		time.Sleep(200 * time.Millisecond)
+
+		if status, _ := call(t, gateway.URL, token, "Queue.Remove", ""); status != 401 {
+			t.Errorf("Expected the session to expire once the stream ended, got status %v", status)
+		}
+	})
+
+	t.Run("close session", func(t *testing.T) {
+		server := pkg.NewServer()
+		server.Register("Queue", pkg.NewQueue(2))
+
+		gateway := httptest.NewServer(server.Handler())
+		defer gateway.Close()
+
+		token := createSession(t, gateway.URL)
+
+		req, _ := http.NewRequest(http.MethodDelete, gateway.URL+"/rpc/session", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Could not close session: %v", err)
+		}
+		res.Body.Close()
+
+		if status, _ := call(t, gateway.URL, token, "Queue.Add", ""); status != 401 {
+			t.Errorf("Expected status %v, got %v", 401, status)
+		}
+	})
+
+	t.Run("rate limits", func(t *testing.T) {
+		server := pkg.NewServer()
+		server.Register("Queue", pkg.NewQueue(5))
+		server.SetRateLimits(pkg.RateLimits{
+			Connection:      pkg.RateLimit{Rate: 0.001, Burst: 1},
+			DisconnectAfter: 2,
+		})
+
+		gateway := httptest.NewServer(server.Handler())
+		defer gateway.Close()
+
+		token := createSession(t, gateway.URL)
+
+		expected := []int{200, 429, 429, 401}
+		for i, expected := range expected {
+			if status, _ := call(t, gateway.URL, token, "Queue.Add", ""); status != expected {
+				t.Errorf("Call %v: expected status %v, got %v", i, expected, status)
+			}
+		}
+	})
+
+	t.Run("limits sessions", func(t *testing.T) {
+		server := pkg.NewServer()
+		server.SetMaxSessions(1)
+
+		gateway := httptest.NewServer(server.Handler())
+		defer gateway.Close()
+
+		token := createSession(t, gateway.URL)
+
+		res, err := http.Post(gateway.URL+"/rpc/session", "application/json", nil)
+		if err != nil {
+			t.Fatalf("Could not create session: %v", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != 503 {
+			t.Errorf("Expected status %v, got %v", 503, res.StatusCode)
+		}
+
+		req, _ := http.NewRequest(http.MethodDelete, gateway.URL+"/rpc/session", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Could not close session: %v", err)
+		}
+		res.Body.Close()
+
+		createSession(t, gateway.URL)
+	})
+
+	t.Run("bounds queued events", func(t *testing.T) {
+		serve := func(policy pkg.SlowConsumerPolicy) (*httptest.Server, string, string) {
+			server := pkg.NewServer()
+			server.Register("Queue", pkg.NewQueue(2))
+			server.Register("Matchmaker", pkg.NewMatchmaker(time.Second))
+
+			options := pkg.DefaultSocketOptions()
+			options.QueueSize = 1
+			options.SlowConsumer = policy
+			server.SetSocketOptions(options)
+
+			gateway := httptest.NewServer(server.Handler())
+			p1 := createSession(t, gateway.URL)
+			p2 := createSession(t, gateway.URL)
+
+			call(t, gateway.URL, p1, "Queue.Add", "")
+			call(t, gateway.URL, p2, "Queue.Add", "")
+			return gateway, p1, p2
+		}
+
+		gateway, p1, _ := serve(pkg.DropResponses)
+		defer gateway.Close()
+
+		events := poll(t, gateway.URL, p1)
+		if len(events) != 1 || events[0].Type != pkg.WaitForMatch {
+			t.Errorf("Expected only %v, got %v", pkg.WaitForMatch, events)
+		}
+
+		gateway, p1, _ = serve(pkg.DisconnectSlowConsumers)
+		defer gateway.Close()
+
+		deadline := time.Now().Add(time.Second)
+		for {
+			status, _ := call(t, gateway.URL, p1, "Queue.Remove", "")
+			if status == 401 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected slow session to be closed, got status %v", status)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+}
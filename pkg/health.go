@@ -0,0 +1,89 @@
+package pkg
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoServices = errors.New("No services registered")
+)
+
+// Implemented by services depending on something that may become
+// unavailable, e.g. storage. Checked on every readiness probe
+type HealthChecker interface {
+	CheckHealth() error
+}
+
+// Checks map each check to "ok" or the reason it failed
+type HealthReport struct {
+	Status  string
+	Uptime  float64
+	Sockets int
+	Queued  int
+	Games   int
+	Checks  map[string]string `json:",omitempty"`
+}
+
+// Liveness, answers as long as the process serves requests
+func (s *Server) serveHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.healthReport())
+}
+
+// Readiness, fails while draining, when only built in services are
+// registered or when a service implementing HealthChecker is unhealthy
+func (s *Server) serveReady(w http.ResponseWriter, r *http.Request) {
+	report := s.healthReport()
+	report.Checks = make(map[string]string)
+
+	check := func(name string, err error) {
+		report.Checks[name] = "ok"
+		if err != nil {
+			report.Checks[name] = err.Error()
+			report.Status = "unavailable"
+		}
+	}
+
+	var err error
+	if s.draining.Load() {
+		err = ErrServerDraining
+	}
+	check("accepting", err)
+
+	err = nil
+	if len(s.order) <= 1 {
+		err = ErrNoServices
+	}
+	check("services", err)
+
+	for _, name := range s.order {
+		if checker, ok := s.services[name].recv.(HealthChecker); ok {
+			check(strings.ToLower(name), checker.CheckHealth())
+		}
+	}
+
+	status := http.StatusOK
+	if report.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+func (s *Server) healthReport() HealthReport {
+	report := HealthReport{
+		Status:  "ok",
+		Uptime:  time.Since(s.started).Seconds(),
+		Sockets: s.connected(),
+	}
+
+	if queue, ok := findService[*Queue](s); ok {
+		report.Queued = queue.Len()
+	}
+	if manager, ok := findService[*GameManager](s); ok {
+		report.Games = manager.Active()
+	}
+
+	return report
+}
@@ -0,0 +1,125 @@
+package pkg_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.internal.com/wingspan/pkg"
+)
+
+func TestHealth(t *testing.T) {
+	probe := func(t testing.TB, server *pkg.Server, path string) (int, pkg.HealthReport) {
+		t.Helper()
+
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+		var report pkg.HealthReport
+		if err := json.NewDecoder(recorder.Body).Decode(&report); err != nil {
+			t.Fatalf("Failed decoding report: %v", err)
+		}
+		return recorder.Code, report
+	}
+
+	t.Run("live with stats", func(t *testing.T) {
+		server := pkg.NewServer()
+		queue := pkg.NewQueue(2)
+		server.Register("Queue", queue)
+		server.Register("Game", pkg.NewGameManager())
+
+		queue.Add(pkg.NewTestSocket(), nil)
+
+		status, report := probe(t, server, "/healthz")
+		if status != http.StatusOK || report.Status != "ok" {
+			t.Errorf("Expected status %v ok, got %v %v", http.StatusOK, status, report.Status)
+		}
+		if report.Queued != 1 || report.Games != 0 || report.Sockets != 0 {
+			t.Errorf("Expected 1 queued player and nothing else, got %+v", report)
+		}
+		if report.Uptime <= 0 {
+			t.Errorf("Expected positive uptime, got %v", report.Uptime)
+		}
+	})
+
+	t.Run("ready", func(t *testing.T) {
+		server := pkg.NewServer()
+		server.Register("Queue", pkg.NewQueue(2))
+
+		status, report := probe(t, server, "/readyz")
+		if status != http.StatusOK {
+			t.Errorf("Expected status %v, got %v with %v", http.StatusOK, status, report.Checks)
+		}
+		for _, check := range []string{"accepting", "services"} {
+			if report.Checks[check] != "ok" {
+				t.Errorf("Expected check %v ok, got %q", check, report.Checks[check])
+			}
+		}
+	})
+
+	t.Run("not ready without services", func(t *testing.T) {
+		status, report := probe(t, pkg.NewServer(), "/readyz")
+		if status != http.StatusServiceUnavailable || report.Checks["services"] != pkg.ErrNoServices.Error() {
+			t.Errorf("Expected status %v for services, got %v with %v", http.StatusServiceUnavailable, status, report.Checks)
+		}
+	})
+
+	t.Run("not ready while draining", func(t *testing.T) {
+		server := pkg.NewServer()
+		server.SetLogger(pkg.DiscardLogger())
+		server.Register("Queue", pkg.NewQueue(2))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+
+		status, report := probe(t, server, "/readyz")
+		if status != http.StatusServiceUnavailable || report.Checks["accepting"] != pkg.ErrServerDraining.Error() {
+			t.Errorf("Expected status %v while draining, got %v with %v", http.StatusServiceUnavailable, status, report.Checks)
+		}
+
+		if status, _ := probe(t, server, "/healthz"); status != http.StatusOK {
+			t.Errorf("Expected to stay live while draining, got status %v", status)
+		}
+	})
+
+	t.Run("ready with guests only", func(t *testing.T) {
+		server := pkg.NewServer()
+		server.Register("Auth", pkg.NewAuth(nil, time.Hour))
+
+		if status, report := probe(t, server, "/readyz"); status != http.StatusOK || report.Checks["auth"] != "ok" {
+			t.Errorf("Expected status %v, got %v with %v", http.StatusOK, status, report.Checks)
+		}
+	})
+
+	t.Run("not ready without storage", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "accounts")
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+
+		store, err := pkg.NewAccountStore(filepath.Join(dir, "accounts.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		server := pkg.NewServer()
+		server.Register("Auth", pkg.NewAuth(store, time.Hour))
+
+		if status, report := probe(t, server, "/readyz"); status != http.StatusOK || report.Checks["auth"] != "ok" {
+			t.Fatalf("Expected status %v, got %v with %v", http.StatusOK, status, report.Checks)
+		}
+
+		os.RemoveAll(dir)
+
+		status, report := probe(t, server, "/readyz")
+		if status != http.StatusServiceUnavailable || report.Checks["auth"] == "ok" {
+			t.Errorf("Expected status %v for auth, got %v with %v", http.StatusServiceUnavailable, status, report.Checks)
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+var (
+	ErrInternal = errors.New("Internal server error")
+)
+
+// Dispatches a message sent through a socket
+type Handler func(socket Socket, message Message) (*Message, error)
+
+// Wraps every dispatch, interceptors may inspect or change the
+// message, short circuit by not calling next or inspect its results
+type Interceptor func(next Handler) Handler
+
+// Wraps handler so the first interceptor is the outermost
+func Chain(handler Handler, interceptors ...Interceptor) Handler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		handler = interceptors[i](handler)
+	}
+	return handler
+}
+
+// Turns panics into ErrInternal so a bad message does not
+// bring the connection down. Servers already recover on their own
+func Recover(next Handler) Handler {
+	return RecoverWithLogger(DiscardLogger())(next)
+}
+
+// Recover logging every panic along with its stack
+func RecoverWithLogger(logger *Logger) Interceptor {
+	return func(next Handler) Handler {
+		return func(socket Socket, message Message) (reply *Message, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Error("Handler panicked", "method", message.Method, "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+					reply, err = nil, ErrInternal
+				}
+			}()
+			return next(socket, message)
+		}
+	}
+}
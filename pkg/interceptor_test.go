@@ -0,0 +1,100 @@
+package pkg_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"git.internal.com/wingspan/pkg"
+)
+
+type PanicService struct{}
+
+func (p *PanicService) Explode(socket pkg.Socket) (*pkg.Message, error) {
+	panic("boom")
+}
+
+func TestInterceptor(t *testing.T) {
+	t.Run("chain order", func(t *testing.T) {
+		calls := []string{}
+		trace := func(name string) pkg.Interceptor {
+			return func(next pkg.Handler) pkg.Handler {
+				return func(socket pkg.Socket, message pkg.Message) (*pkg.Message, error) {
+					calls = append(calls, name+" "+message.Method)
+					return next(socket, message)
+				}
+			}
+		}
+
+		server := pkg.NewServer()
+		server.Register("Queue", pkg.NewQueue(1))
+		server.Register("Matchmaker", new(FakeMatchmaker))
+		server.Use(trace("first"), trace("second"))
+
+		reply, err := server.Dispatch(pkg.NewTestSocket(), pkg.Message{Method: "Queue.Add"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		server.Dispatch(nil, *reply)
+
+		expected := []string{
+			"first Queue.Add",
+			"second Queue.Add",
+			"first Matchmaker.CreateMatch",
+			"second Matchmaker.CreateMatch",
+		}
+		if !reflect.DeepEqual(calls, expected) {
+			t.Errorf("Expected %v, got %v", expected, calls)
+		}
+	})
+
+	t.Run("short circuit", func(t *testing.T) {
+		game := new(FakeGame)
+		server := pkg.NewServer()
+		server.Register("Game", game)
+		server.Use(func(next pkg.Handler) pkg.Handler {
+			return func(socket pkg.Socket, message pkg.Message) (*pkg.Message, error) {
+				return nil, pkg.ErrMethodNotFound
+			}
+		})
+
+		_, err := server.Dispatch(nil, pkg.Message{
+			Method: "Game.ChooseBirds",
+			Params: []pkg.BirdID{1},
+		})
+
+		if err != pkg.ErrMethodNotFound {
+			t.Errorf("Expected error %v, got %v", pkg.ErrMethodNotFound, err)
+		}
+		if game.birds != nil {
+			t.Error("Expected message not to reach the service")
+		}
+	})
+
+	t.Run("recover", func(t *testing.T) {
+		server := pkg.NewServer()
+		server.Register("Panic", new(PanicService))
+		server.Use(pkg.Recover)
+
+		if _, err := server.Dispatch(nil, pkg.Message{Method: "Panic.Explode"}); err != pkg.ErrInternal {
+			t.Errorf("Expected error %v, got %v", pkg.ErrInternal, err)
+		}
+	})
+
+	t.Run("recovers and logs by default", func(t *testing.T) {
+		var logs bytes.Buffer
+		server := pkg.NewServer()
+		server.SetLogger(pkg.NewLogger(&logs, pkg.LogLevels{Default: pkg.LogError}))
+		server.Register("Panic", new(PanicService))
+
+		if _, err := server.Dispatch(nil, pkg.Message{Method: "Panic.Explode"}); err != pkg.ErrInternal {
+			t.Errorf("Expected error %v, got %v", pkg.ErrInternal, err)
+		}
+		for _, expected := range []string{`"level":"error"`, `"panic":"boom"`, "Explode"} {
+			if !strings.Contains(logs.String(), expected) {
+				t.Errorf("Expected %v logged, got %v", expected, logs.String())
+			}
+		}
+	})
+}
@@ -0,0 +1,222 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+	// Logs nothing
+	LogOff
+)
+
+var logLevels = map[LogLevel]string{
+	LogDebug: "debug",
+	LogInfo:  "info",
+	LogWarn:  "warn",
+	LogError: "error",
+	LogOff:   "off",
+}
+
+func (l LogLevel) String() string {
+	return logLevels[l]
+}
+
+// Parses debug, info, warn, error or off, so levels can be flags
+func (l *LogLevel) Set(value string) error {
+	for level, name := range logLevels {
+		if name == value {
+			*l = level
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown log level %q, expected debug, info, warn, error or off", value)
+}
+
+// Minimum level logged, Subsystems override Default by
+// subsystem name, e.g. "game" or "queue"
+type LogLevels struct {
+	Default    LogLevel
+	Subsystems map[string]LogLevel
+}
+
+func DefaultLogLevels() LogLevels {
+	return LogLevels{Default: LogInfo}
+}
+
+func (l LogLevels) Level(subsystem string) LogLevel {
+	if level, ok := l.Subsystems[subsystem]; ok {
+		return level
+	}
+	return l.Default
+}
+
+// Services implementing it get a logger for their subsystem when
+// registered, named after the service in lower case
+type LoggerSetter interface {
+	SetLogger(*Logger)
+}
+
+// Writes one JSON object per line. Fields are given as
+// alternating keys and values, e.g. "game", game.ID
+type Logger struct {
+	sink      *logSink
+	subsystem string
+	level     LogLevel
+	fields    []any
+}
+
+// Shared by every logger derived from the same one
+type logSink struct {
+	mutex  sync.Mutex
+	out    io.Writer
+	levels LogLevels
+}
+
+func NewLogger(out io.Writer, levels LogLevels) *Logger {
+	return &Logger{
+		sink:  &logSink{out: out, levels: levels},
+		level: levels.Default,
+	}
+}
+
+func DiscardLogger() *Logger {
+	return NewLogger(io.Discard, LogLevels{Default: LogOff})
+}
+
+// Logger for a subsystem, at the level configured for it
+func (l *Logger) Subsystem(name string) *Logger {
+	return &Logger{
+		sink:      l.sink,
+		subsystem: name,
+		level:     l.sink.levels.Level(name),
+		fields:    l.fields,
+	}
+}
+
+// Logger adding fields to every line
+func (l *Logger) With(fields ...any) *Logger {
+	return &Logger{
+		sink:      l.sink,
+		subsystem: l.subsystem,
+		level:     l.level,
+		fields:    append(l.fields[:len(l.fields):len(l.fields)], fields...),
+	}
+}
+
+func (l *Logger) Enabled(level LogLevel) bool {
+	return level >= l.level && level < LogOff
+}
+
+func (l *Logger) Debug(message string, fields ...any) {
+	l.log(LogDebug, message, fields)
+}
+
+func (l *Logger) Info(message string, fields ...any) {
+	l.log(LogInfo, message, fields)
+}
+
+func (l *Logger) Warn(message string, fields ...any) {
+	l.log(LogWarn, message, fields)
+}
+
+func (l *Logger) Error(message string, fields ...any) {
+	l.log(LogError, message, fields)
+}
+
+func (l *Logger) log(level LogLevel, message string, fields []any) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	var line bytes.Buffer
+	line.WriteString(`{"time":`)
+	writeLogValue(&line, time.Now().UTC().Format(time.RFC3339Nano))
+	line.WriteString(`,"level":`)
+	writeLogValue(&line, level.String())
+	if l.subsystem != "" {
+		line.WriteString(`,"subsystem":`)
+		writeLogValue(&line, l.subsystem)
+	}
+	line.WriteString(`,"msg":`)
+	writeLogValue(&line, message)
+
+	for _, fields := range [][]any{l.fields, fields} {
+		for i := 0; i < len(fields); i += 2 {
+			key := fmt.Sprint(fields[i])
+			var value any = "!MISSING"
+			if i+1 < len(fields) {
+				value = fields[i+1]
+			}
+
+			line.WriteByte(',')
+			writeLogValue(&line, key)
+			line.WriteByte(':')
+			writeLogValue(&line, value)
+		}
+	}
+	line.WriteString("}\n")
+
+	l.sink.mutex.Lock()
+	defer l.sink.mutex.Unlock()
+
+	l.sink.out.Write(line.Bytes())
+}
+
+func writeLogValue(line *bytes.Buffer, value any) {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case time.Duration:
+		value = v.String()
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	line.Write(encoded)
+}
+
+// Session IDs of the sockets, to log who is involved
+func sessionIDs(sockets []Socket) []string {
+	ids := make([]string, 0, len(sockets))
+	for _, socket := range sockets {
+		if socket != nil {
+			ids = append(ids, socket.Session().ID())
+		}
+	}
+	return ids
+}
+
+func parseLogLevels(value string) (map[string]LogLevel, error) {
+	levels := make(map[string]LogLevel)
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		subsystem, name, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected subsystem=level, got %v", entry)
+		}
+
+		var level LogLevel
+		if err := level.Set(name); err != nil {
+			return nil, err
+		}
+		levels[subsystem] = level
+	}
+	return levels, nil
+}
@@ -0,0 +1,124 @@
+package pkg_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"git.internal.com/wingspan/pkg"
+)
+
+// Loggers write from timers, reads must not race with them
+type logBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) Lines(t testing.TB) []map[string]any {
+	t.Helper()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	lines := make([]map[string]any, 0)
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Expected JSON, got %q: %v", line, err)
+		}
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestLogger(t *testing.T) {
+	t.Run("writes fields as JSON", func(t *testing.T) {
+		out := new(logBuffer)
+		logger := pkg.NewLogger(out, pkg.DefaultLogLevels()).Subsystem("game").With("game", "g1")
+		logger.Info("Turn started", "round", 2, "error", errors.New("boom"), "took", time.Second)
+
+		lines := out.Lines(t)
+		if len(lines) != 1 {
+			t.Fatalf("Expected a line, got %v", lines)
+		}
+
+		expected := map[string]any{
+			"level":     "info",
+			"subsystem": "game",
+			"msg":       "Turn started",
+			"game":      "g1",
+			"round":     float64(2),
+			"error":     "boom",
+			"took":      "1s",
+		}
+		for key, value := range expected {
+			if lines[0][key] != value {
+				t.Errorf("Expected %v to be %v, got %v", key, value, lines[0][key])
+			}
+		}
+	})
+
+	t.Run("levels per subsystem", func(t *testing.T) {
+		out := new(logBuffer)
+		logger := pkg.NewLogger(out, pkg.LogLevels{
+			Default:    pkg.LogWarn,
+			Subsystems: map[string]pkg.LogLevel{"game": pkg.LogDebug},
+		})
+
+		logger.Subsystem("queue").Info("Player queued")
+		logger.Subsystem("queue").Warn("Queue drained")
+		logger.Subsystem("game").Debug("Player seated")
+
+		lines := out.Lines(t)
+		if len(lines) != 2 || lines[0]["msg"] != "Queue drained" || lines[1]["msg"] != "Player seated" {
+			t.Errorf("Unexpected lines %v", lines)
+		}
+	})
+
+	t.Run("with does not share fields", func(t *testing.T) {
+		out := new(logBuffer)
+		base := pkg.NewLogger(out, pkg.DefaultLogLevels()).With("a", 1)
+		base.With("b", 2).Info("first")
+		base.With("c", 3).Info("second")
+
+		lines := out.Lines(t)
+		if _, ok := lines[1]["b"]; ok {
+			t.Errorf("Expected no b on the second line, got %v", lines[1])
+		}
+	})
+
+	t.Run("logs game transitions", func(t *testing.T) {
+		out := new(logBuffer)
+		rules := pkg.DefaultRules()
+		rules.SetupDuration = time.Millisecond
+
+		manager := pkg.NewGameManagerWithRules(rules)
+		manager.SetLogger(pkg.NewLogger(out, pkg.DefaultLogLevels()).Subsystem("game"))
+		manager.Create(nil, []pkg.Socket{pkg.NewTestSocket(), pkg.NewTestSocket()})
+		time.Sleep(20 * time.Millisecond)
+
+		messages := []string{}
+		for _, line := range out.Lines(t) {
+			if line["game"] == nil {
+				t.Errorf("Expected the game ID on %v", line)
+			}
+			messages = append(messages, line["msg"].(string))
+		}
+		if strings.Join(messages, ", ") != "Game created, Game canceled" {
+			t.Errorf("Unexpected messages %v", messages)
+		}
+	})
+}
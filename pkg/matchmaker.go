@@ -1,9 +1,13 @@
 package pkg
 
 import (
+	"context"
 	"errors"
+	"math"
 	"sync"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 var (
@@ -12,7 +16,9 @@ var (
 	ErrPlayerNotFound = errors.New("Player not present in any matches")
 )
 
+// Players are keyed by session ID
 type Match struct {
+	ID        uuid.UUID
 	players   *sync.Map
 	confirmed *RingBuffer[Socket]
 }
@@ -20,10 +26,11 @@ type Match struct {
 func NewMatch(players []Socket) *Match {
 	sockets := new(sync.Map)
 	for _, socket := range players {
-		sockets.Store(socket, true)
+		sockets.Store(socket.Session().ID(), socket)
 	}
 
 	return &Match{
+		ID:        uuid.New(),
 		players:   sockets,
 		confirmed: NewRingBuffer[Socket](len(players)),
 	}
@@ -38,14 +45,18 @@ func (m *Match) Confirmed() int {
 }
 
 func (m *Match) Accept(socket Socket) error {
-	if _, ok := m.players.Load(socket); !ok {
+	id := socket.Session().ID()
+	if _, ok := m.players.Load(id); !ok {
 		return ErrPlayerNotFound
 	}
 
+	// the player may have reconnected since the match was found
+	m.players.Store(id, socket)
+
 	m.confirmed.Push(socket)
 	response := Response{Type: WaitOtherPlayers}
 
-	if _, err := socket.Send(response); err != nil {
+	if _, err := reply(socket, response); err != nil {
 		return err
 	}
 
@@ -56,6 +67,8 @@ type Matchmaker struct {
 	timeout time.Duration
 	matches *sync.Map
 	timers  *sync.Map
+	bus     *EventBus
+	logger  *Logger
 }
 
 func NewMatchmaker(timeout time.Duration) *Matchmaker {
@@ -63,11 +76,16 @@ func NewMatchmaker(timeout time.Duration) *Matchmaker {
 		timeout: timeout,
 		matches: new(sync.Map),
 		timers:  new(sync.Map),
+		logger:  DiscardLogger(),
 	}
 }
 
+func (m *Matchmaker) SetLogger(logger *Logger) {
+	m.logger = logger
+}
+
 func (m *Matchmaker) Accept(socket Socket) (*Message, error) {
-	value, ok := m.matches.Load(socket)
+	value, ok := m.matches.Load(socket.Session().ID())
 	if !ok {
 		return nil, ErrMatchNotFound
 	}
@@ -76,13 +94,19 @@ func (m *Matchmaker) Accept(socket Socket) (*Message, error) {
 	if err := match.Accept(socket); err != nil {
 		return nil, err
 	}
+	m.logger.Debug("Match accepted", "match", match.ID, "session", socket.Session().ID(), "conn", socket.Session().ConnectionID())
 
 	if match.Ready() {
-		m.matches.Delete(socket)
-
-		// Stop and removes match timer
-		timer, _ := m.timers.LoadAndDelete(match)
-		timer.(*time.Timer).Stop()
+		m.logger.Info("Match ready", "match", match.ID)
+
+		// declined meanwhile by a timeout, a cancel or a drain
+		if !m.claim(match) {
+			return nil, ErrMatchNotFound
+		}
+		match.players.Range(func(key, _ any) bool {
+			m.matches.Delete(key)
+			return true
+		})
 
 		return &Message{
 			Method: "Game.Create",
@@ -94,25 +118,19 @@ func (m *Matchmaker) Accept(socket Socket) (*Message, error) {
 }
 
 func (m *Matchmaker) Decline(socket Socket) (*Message, error) {
-	value, ok := m.matches.Load(socket)
+	value, ok := m.matches.Load(socket.Session().ID())
 	if !ok {
 		return nil, ErrMatchNotFound
 	}
 
 	match := value.(*Match)
-	if err := m.declineMatch(match); err != nil {
-		return nil, err
+	if !m.claim(match) {
+		return nil, ErrMatchNotFound
 	}
 
-	// Stop and removes match timer
-	timer, _ := m.timers.LoadAndDelete(match)
-	timer.(*time.Timer).Stop()
-
-	if match.Confirmed() > 0 {
-		return &Message{
-			Method: "Queue.Add",
-			Params: match.confirmed.Values(),
-		}, nil
+	m.logger.Info("Match declined", "match", match.ID, "session", socket.Session().ID(), "conn", socket.Session().ConnectionID())
+	if err := m.declineMatch(match); err != nil {
+		return nil, err
 	}
 
 	return nil, nil
@@ -125,7 +143,7 @@ func (m *Matchmaker) CreateMatch(socket Socket, players []Socket) (*Message, err
 
 	match := NewMatch(players)
 	for _, player := range players {
-		m.matches.Store(player, match)
+		m.matches.Store(player.Session().ID(), match)
 
 		player.Send(Response{
 			Type:    MatchFound,
@@ -133,24 +151,127 @@ func (m *Matchmaker) CreateMatch(socket Socket, players []Socket) (*Message, err
 		})
 	}
 
-	// Decline automatically after timeout
-	timer := time.AfterFunc(m.timeout, func() {
-		m.declineMatch(match)
-	})
+	m.logger.Info("Match found", "match", match.ID, "sessions", sessionIDs(players))
 
-	// Store match timer
+	// Decline automatically after timeout, the timer is stored
+	// before it is armed so it can always be claimed
+	timer := time.AfterFunc(math.MaxInt64, func() {
+		if m.claim(match) {
+			m.logger.Info("Match timed out", "match", match.ID, "confirmed", match.Confirmed())
+			m.declineMatch(match)
+		}
+	})
 	m.timers.Store(match, timer)
+	timer.Reset(m.timeout)
 
 	return nil, nil
 }
 
+// Removes the match timer. Whoever does gets to start or decline the
+// match, everyone else lost the race against them
+func (m *Matchmaker) claim(match *Match) bool {
+	timer, ok := m.timers.LoadAndDelete(match)
+	if ok {
+		timer.(*time.Timer).Stop()
+	}
+	return ok
+}
+
 func (m *Matchmaker) declineMatch(match *Match) error {
-	match.players.Range(func(key, _ any) bool {
-		player := key.(Socket)
-		m.matches.Delete(player)
+	match.players.Range(func(key, value any) bool {
+		player := value.(Socket)
+		m.matches.Delete(key)
 		player.Send(Response{Type: MatchDeclined})
 		return true
 	})
 
+	// Players who accepted go back to the queue
+	if match.Confirmed() > 0 {
+		m.bus.Publish("Queue.Add", match.confirmed.Values())
+	}
+
 	return nil
 }
+
+type MatchSummary struct {
+	ID        uuid.UUID
+	Sessions  []string
+	Confirmed int
+}
+
+// Matches waiting for their players to accept
+func (m *Matchmaker) Matches() []MatchSummary {
+	summaries := make([]MatchSummary, 0)
+	m.timers.Range(func(key, _ any) bool {
+		match := key.(*Match)
+		summary := MatchSummary{
+			ID:        match.ID,
+			Sessions:  make([]string, 0),
+			Confirmed: match.Confirmed(),
+		}
+		match.players.Range(func(id, _ any) bool {
+			summary.Sessions = append(summary.Sessions, id.(string))
+			return true
+		})
+		summaries = append(summaries, summary)
+		return true
+	})
+	return summaries
+}
+
+// Declines the match as if it had timed out
+func (m *Matchmaker) Cancel(id uuid.UUID) error {
+	var match *Match
+	m.timers.Range(func(key, value any) bool {
+		if key.(*Match).ID == id {
+			match = key.(*Match)
+			return false
+		}
+		return true
+	})
+
+	if match == nil {
+		return ErrMatchNotFound
+	}
+
+	if !m.claim(match) {
+		return ErrMatchNotFound
+	}
+
+	m.logger.Warn("Match canceled", "match", match.ID, "confirmed", match.Confirmed())
+	return m.declineMatch(match)
+}
+
+// Matches waiting for their players to accept
+func (m *Matchmaker) Pending() int {
+	pending := 0
+	m.timers.Range(func(_, _ any) bool {
+		pending++
+		return true
+	})
+	return pending
+}
+
+func (m *Matchmaker) CollectMetrics(metrics *Metrics) {
+	metrics.Gauge("wingspan_matches_pending", "Matches waiting for their players to accept")
+	metrics.Set("wingspan_matches_pending", float64(m.Pending()))
+}
+
+// Stops pending match timers and declines their matches
+func (m *Matchmaker) Drain(ctx context.Context) error {
+	m.timers.Range(func(key, _ any) bool {
+		if m.claim(key.(*Match)) {
+			m.declineMatch(key.(*Match))
+		}
+		return true
+	})
+	return nil
+}
+
+func (m *Matchmaker) Subscribe(bus *EventBus) {
+	m.bus = bus
+}
+
+func (m *Matchmaker) InternalMethods() []string {
+	return []string{"CreateMatch"}
+}
@@ -8,6 +8,18 @@ import (
 	"git.internal.com/wingspan/pkg"
 )
 
+func subscribeRequeue(matchmaker *pkg.Matchmaker) chan []pkg.Socket {
+	bus := pkg.NewEventBus()
+	requeued := make(chan []pkg.Socket, 1)
+
+	bus.Subscribe("Queue.Add", func(event pkg.Event) {
+		requeued <- event.Payload.([]pkg.Socket)
+	})
+
+	matchmaker.Subscribe(bus)
+	return requeued
+}
+
 func TestMatchmaker(t *testing.T) {
 	t.Run("match found", func(t *testing.T) {
 		matchmaker := pkg.NewMatchmaker(time.Second)
@@ -71,6 +83,28 @@ func TestMatchmaker(t *testing.T) {
 		}
 	})
 
+	t.Run("started match is no longer pending", func(t *testing.T) {
+		matchmaker := pkg.NewMatchmaker(time.Second)
+
+		p1 := pkg.NewTestSocket()
+		p2 := pkg.NewTestSocket()
+
+		matchmaker.CreateMatch(nil, []pkg.Socket{p1, p2})
+		if pending := matchmaker.Pending(); pending != 1 {
+			t.Fatalf("Expected %v pending match, got %v", 1, pending)
+		}
+
+		matchmaker.Accept(p1)
+		matchmaker.Accept(p2)
+
+		if pending := matchmaker.Pending(); pending != 0 {
+			t.Errorf("Expected no pending matches, got %v", pending)
+		}
+		if _, err := matchmaker.Decline(p1); err != pkg.ErrMatchNotFound {
+			t.Errorf("Expected error %v, got %v", pkg.ErrMatchNotFound, err)
+		}
+	})
+
 	t.Run("deny match", func(t *testing.T) {
 		matchmaker := pkg.NewMatchmaker(time.Second)
 
@@ -161,6 +195,7 @@ func TestMatchmaker(t *testing.T) {
 
 	t.Run("confirmed are requeued", func(t *testing.T) {
 		matchmaker := pkg.NewMatchmaker(time.Second)
+		requeued := subscribeRequeue(matchmaker)
 
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
@@ -168,17 +203,39 @@ func TestMatchmaker(t *testing.T) {
 		matchmaker.CreateMatch(nil, []pkg.Socket{p1, p2})
 		matchmaker.Accept(p2)
 		reply, _ := matchmaker.Decline(p1)
-		if reply == nil {
-			t.Fatal("expected reply")
+		if reply != nil {
+			t.Errorf("expected no reply, got %v", reply)
 		}
-		if reply.Method != "Queue.Add" {
-			t.Errorf("Expected method %v, got %v", "Queue.Add", reply.Method)
+
+		select {
+		case confirmed := <-requeued:
+			expected := []pkg.Socket{p2, nil}
+			if !reflect.DeepEqual(confirmed, expected) {
+				t.Errorf("Expected %v, got %v", expected, confirmed)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected confirmed players to be requeued")
 		}
+	})
 
-		expected := []pkg.Socket{p2, nil}
-		confirmed := reply.Params.([]pkg.Socket)
-		if !reflect.DeepEqual(confirmed, expected) {
-			t.Errorf("Expected %v, got %v", expected, confirmed)
+	t.Run("confirmed are requeued after timeout", func(t *testing.T) {
+		matchmaker := pkg.NewMatchmaker(time.Millisecond)
+		requeued := subscribeRequeue(matchmaker)
+
+		p1 := pkg.NewTestSocket()
+		p2 := pkg.NewTestSocket()
+
+		matchmaker.CreateMatch(nil, []pkg.Socket{p1, p2})
+		matchmaker.Accept(p1)
+
+		select {
+		case confirmed := <-requeued:
+			expected := []pkg.Socket{p1, nil}
+			if !reflect.DeepEqual(confirmed, expected) {
+				t.Errorf("Expected %v, got %v", expected, confirmed)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected confirmed players to be requeued")
 		}
 	})
 
@@ -191,7 +248,7 @@ func TestMatchmaker(t *testing.T) {
 		}
 
 		matchmaker.CreateMatch(nil, players)
-		time.Sleep(2 * time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
 
 		for _, player := range players {
 			response, err := player.(*pkg.TestSocket).GetResponse()
@@ -235,6 +292,39 @@ func TestMatchmaker(t *testing.T) {
 		go matchmaker.Decline(p2)
 	})
 
+	t.Run("decline races cancel", func(t *testing.T) {
+		for i := 0; i < 50; i++ {
+			matchmaker := pkg.NewMatchmaker(time.Second)
+			subscribeRequeue(matchmaker)
+
+			p1 := pkg.NewTestSocket()
+			p2 := pkg.NewTestSocket()
+			matchmaker.CreateMatch(nil, []pkg.Socket{p1, p2})
+			id := matchmaker.Matches()[0].ID
+
+			start := make(chan struct{})
+			errs := make(chan error, 2)
+			go func() {
+				<-start
+				_, err := matchmaker.Decline(p1)
+				errs <- err
+			}()
+			go func() {
+				<-start
+				errs <- matchmaker.Cancel(id)
+			}()
+			close(start)
+
+			first, second := <-errs, <-errs
+			if (first == nil) == (second == nil) {
+				t.Fatalf("Expected exactly one to decline the match, got %v and %v", first, second)
+			}
+			if matchmaker.Pending() != 0 {
+				t.Fatalf("Expected no pending matches, got %v", matchmaker.Pending())
+			}
+		}
+	})
+
 	t.Run("match concurrency", func(t *testing.T) {
 		p1 := pkg.NewTestSocket()
 		p2 := pkg.NewTestSocket()
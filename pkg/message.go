@@ -13,6 +13,7 @@ var (
 
 const (
 	Error            = "error"
+	Ack              = "ack"
 	MatchFound       = "match_found"
 	WaitForMatch     = "wait_for_match"
 	WaitOtherPlayers = "wait_other_players"
@@ -35,16 +36,70 @@ const (
 	ChooseFood       = "choose_food"
 	ChooseBirds      = "choose_birds"
 	PlayerInfo       = "player_info"
+	Description      = "description"
+	Maintenance      = "maintenance"
+	Authenticated    = "authenticated"
+	Resumed          = "resumed"
+	Welcome          = "welcome"
+	Unsupported      = "unsupported_version"
 )
 
+// Responses answering a message carry the message's ID, those are
+// the ack or error and replies handlers send back to the caller, e.g.
+// player_info. Events leave it empty. Game events are numbered by Seq
+// so they can be replayed when resuming
 type Response struct {
+	ID      string `json:",omitempty" msgpack:",omitempty"`
+	Seq     uint64 `json:",omitempty" msgpack:",omitempty"`
 	Type    string
 	Payload any
 }
 
+// ID is optional and chosen by the client to correlate replies
 type Message struct {
+	ID     string `json:",omitempty"`
 	Method string
 	Params any
+
+	// set on follow up messages, which may reach internal methods
+	internal bool
+}
+
+// Keeps params raw so they can be decoded straight into
+// the parameter type of the method being dispatched
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var message struct {
+		ID     string
+		Method string
+		Params json.RawMessage
+	}
+	if err := json.Unmarshal(data, &message); err != nil {
+		return err
+	}
+
+	m.ID = message.ID
+	m.Method = message.Method
+	m.Params = nil
+
+	if len(message.Params) > 0 && string(message.Params) != "null" {
+		m.Params = message.Params
+	}
+
+	return nil
+}
+
+// Seed lets the game be replayed
+type GameStartedPayload struct {
+	ID    uuid.UUID
+	Token string
+	Seed  int64
+}
+
+// Seq is the last event the client received
+type ResumePayload struct {
+	Player uuid.UUID
+	Token  string
+	Seq    uint64
 }
 
 type StartTurnPayload struct {
@@ -82,6 +137,12 @@ type AvailableResources struct {
 	Food    []FoodType
 }
 
+type PayBirdCostPayload struct {
+	BirdID BirdID
+	Food   []FoodType
+	Eggs   map[BirdID]int
+}
+
 type GainFood struct {
 	Amount    int
 	Available map[FoodType]int
@@ -0,0 +1,231 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Upper bounds in seconds of dispatch latency buckets
+var LATENCY_BUCKETS = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+const (
+	counterMetric   = "counter"
+	gaugeMetric     = "gauge"
+	histogramMetric = "histogram"
+)
+
+// Services implementing it report their state on every scrape,
+// into metrics that are discarded once written out
+type MetricsCollector interface {
+	CollectMetrics(*Metrics)
+}
+
+// Metrics in the Prometheus text format. Labels are given as
+// alternating names and values, e.g. "method", "Queue.Add"
+type Metrics struct {
+	mutex    sync.Mutex
+	families map[string]*metricFamily
+}
+
+type metricFamily struct {
+	kind    string
+	help    string
+	buckets []float64
+	series  map[string]*metricSeries
+}
+
+type metricSeries struct {
+	value  float64
+	counts []uint64
+	count  uint64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		families: make(map[string]*metricFamily),
+	}
+}
+
+func (m *Metrics) Counter(name, help string) {
+	m.family(name, counterMetric).help = help
+}
+
+func (m *Metrics) Gauge(name, help string) {
+	m.family(name, gaugeMetric).help = help
+}
+
+func (m *Metrics) Histogram(name, help string, buckets []float64) {
+	family := m.family(name, histogramMetric)
+	family.help = help
+	family.buckets = buckets
+}
+
+func (m *Metrics) family(name, kind string) *metricFamily {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	family, ok := m.families[name]
+	if !ok {
+		family = &metricFamily{
+			kind:    kind,
+			buckets: LATENCY_BUCKETS,
+			series:  make(map[string]*metricSeries),
+		}
+		m.families[name] = family
+	}
+	return family
+}
+
+func (m *Metrics) series(name, kind string, labels []string) (*metricFamily, *metricSeries) {
+	family := m.family(name, kind)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := formatLabels(labels)
+	series, ok := family.series[key]
+	if !ok {
+		series = &metricSeries{}
+		if kind == histogramMetric {
+			series.counts = make([]uint64, len(family.buckets))
+		}
+		family.series[key] = series
+	}
+	return family, series
+}
+
+func (m *Metrics) Add(name string, value float64, labels ...string) {
+	_, series := m.series(name, counterMetric, labels)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	series.value += value
+}
+
+func (m *Metrics) Set(name string, value float64, labels ...string) {
+	_, series := m.series(name, gaugeMetric, labels)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	series.value = value
+}
+
+func (m *Metrics) Observe(name string, value float64, labels ...string) {
+	family, series := m.series(name, histogramMetric, labels)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	series.value += value
+	series.count++
+	for i, bound := range family.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+}
+
+// Value of a counter or gauge, or the count of a histogram
+func (m *Metrics) Value(name string, labels ...string) float64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	family, ok := m.families[name]
+	if !ok {
+		return 0
+	}
+	series, ok := family.series[formatLabels(labels)]
+	if !ok {
+		return 0
+	}
+	if family.kind == histogramMetric {
+		return float64(series.count)
+	}
+	return series.value
+}
+
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	names := make([]string, 0, len(m.families))
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out strings.Builder
+	for _, name := range names {
+		family := m.families[name]
+		if family.help != "" {
+			fmt.Fprintf(&out, "# HELP %v %v\n", name, family.help)
+		}
+		fmt.Fprintf(&out, "# TYPE %v %v\n", name, family.kind)
+
+		keys := make([]string, 0, len(family.series))
+		for key := range family.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			series := family.series[key]
+			if family.kind != histogramMetric {
+				fmt.Fprintf(&out, "%v%v %v\n", name, key, formatValue(series.value))
+				continue
+			}
+
+			for i, bound := range family.buckets {
+				fmt.Fprintf(&out, "%v_bucket%v %v\n", name, withLabel(key, "le", formatValue(bound)), series.counts[i])
+			}
+			fmt.Fprintf(&out, "%v_bucket%v %v\n", name, withLabel(key, "le", "+Inf"), series.count)
+			fmt.Fprintf(&out, "%v_sum%v %v\n", name, key, formatValue(series.value))
+			fmt.Fprintf(&out, "%v_count%v %v\n", name, key, series.count)
+		}
+	}
+
+	n, err := io.WriteString(w, out.String())
+	return int64(n), err
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+func formatLabels(labels []string) string {
+	if len(labels) < 2 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%v="%v"`, labels[i], labelEscaper.Replace(labels[i+1])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func withLabel(key, name, value string) string {
+	label := fmt.Sprintf(`%v="%v"`, name, value)
+	if key == "" {
+		return "{" + label + "}"
+	}
+	return key[:len(key)-1] + "," + label + "}"
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,73 @@
+package pkg_test
+
+import (
+	"strings"
+	"testing"
+
+	"git.internal.com/wingspan/pkg"
+)
+
+func TestMetrics(t *testing.T) {
+	write := func(t testing.TB, metrics *pkg.Metrics) string {
+		t.Helper()
+
+		var out strings.Builder
+		if _, err := metrics.WriteTo(&out); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+
+	assertLines := func(t testing.TB, out string, lines ...string) {
+		t.Helper()
+		for _, line := range lines {
+			if !strings.Contains(out, line+"\n") {
+				t.Errorf("Expected %q in:\n%v", line, out)
+			}
+		}
+	}
+
+	t.Run("counters and gauges", func(t *testing.T) {
+		metrics := pkg.NewMetrics()
+		metrics.Counter("calls_total", "Calls made")
+		metrics.Add("calls_total", 1, "method", "Queue.Add")
+		metrics.Add("calls_total", 2, "method", "Queue.Add")
+		metrics.Set("players", 3)
+		metrics.Set("players", 4)
+
+		assertLines(t, write(t, metrics),
+			"# HELP calls_total Calls made",
+			"# TYPE calls_total counter",
+			`calls_total{method="Queue.Add"} 3`,
+			"# TYPE players gauge",
+			"players 4",
+		)
+		if value := metrics.Value("calls_total", "method", "Queue.Add"); value != 3 {
+			t.Errorf("Expected 3, got %v", value)
+		}
+	})
+
+	t.Run("histograms", func(t *testing.T) {
+		metrics := pkg.NewMetrics()
+		metrics.Histogram("latency", "", []float64{0.1, 1})
+		for _, value := range []float64{0.05, 0.5, 2} {
+			metrics.Observe("latency", value, "method", "Game.EndTurn")
+		}
+
+		assertLines(t, write(t, metrics),
+			"# TYPE latency histogram",
+			`latency_bucket{method="Game.EndTurn",le="0.1"} 1`,
+			`latency_bucket{method="Game.EndTurn",le="1"} 2`,
+			`latency_bucket{method="Game.EndTurn",le="+Inf"} 3`,
+			`latency_sum{method="Game.EndTurn"} 2.55`,
+			`latency_count{method="Game.EndTurn"} 3`,
+		)
+	})
+
+	t.Run("escapes labels", func(t *testing.T) {
+		metrics := pkg.NewMetrics()
+		metrics.Add("errors_total", 1, "error", "bad \"value\"\n")
+
+		assertLines(t, write(t, metrics), `errors_total{error="bad \"value\"\n"} 1`)
+	})
+}
@@ -0,0 +1,206 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var (
+	ErrSlowConsumer = errors.New("Client is not keeping up with responses")
+)
+
+// What to do with responses sent while a socket's queue is full
+type SlowConsumerPolicy int
+
+const (
+	// Discards the response
+	DropResponses SlowConsumerPolicy = iota
+	// Replaces the last queued response of the same type,
+	// discarding the response when there is none
+	CoalesceResponses
+	// Closes the connection, the client may resume once reconnected
+	DisconnectSlowConsumers
+)
+
+var slowConsumerPolicies = map[SlowConsumerPolicy]string{
+	DropResponses:           "drop",
+	CoalesceResponses:       "coalesce",
+	DisconnectSlowConsumers: "disconnect",
+}
+
+func (p SlowConsumerPolicy) String() string {
+	return slowConsumerPolicies[p]
+}
+
+// Parses drop, coalesce or disconnect, so policies can be flags
+func (p *SlowConsumerPolicy) Set(value string) error {
+	for policy, name := range slowConsumerPolicies {
+		if name == value {
+			*p = policy
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown policy %q, expected drop, coalesce or disconnect", value)
+}
+
+type SocketStats struct {
+	// Responses waiting to be written
+	Queued int
+	// Most responses ever waiting at once
+	MaxQueued int
+	Dropped   uint64
+	Coalesced uint64
+	// Messages received that could not be decoded
+	Invalid uint64
+}
+
+type frame struct {
+	kind    string
+	control bool
+	mtype   int
+	data    []byte
+}
+
+// Bounded queue of frames waiting for the socket's writer
+type outbox struct {
+	mutex  sync.Mutex
+	size   int
+	policy SlowConsumerPolicy
+	frames []frame
+	notify chan struct{}
+	closed bool
+	// no more frames are accepted, those queued are still written
+	draining bool
+	stats    SocketStats
+}
+
+func newOutbox(size int, policy SlowConsumerPolicy) *outbox {
+	return &outbox{
+		size:   size,
+		policy: policy,
+		frames: make([]frame, 0),
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// Queues f applying the slow consumer policy when full. Control
+// frames are always queued since they are few and end the connection
+func (o *outbox) push(f frame) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.closed || o.draining {
+		return io.ErrClosedPipe
+	}
+
+	if o.size > 0 && len(o.frames) >= o.size && !f.control {
+		switch o.policy {
+		case CoalesceResponses:
+			for i := len(o.frames) - 1; i >= 0; i-- {
+				if !o.frames[i].control && o.frames[i].kind == f.kind {
+					o.frames[i] = f
+					o.stats.Coalesced++
+					return nil
+				}
+			}
+			o.stats.Dropped++
+			return nil
+		case DisconnectSlowConsumers:
+			o.stats.Dropped++
+			return ErrSlowConsumer
+		default:
+			o.stats.Dropped++
+			return nil
+		}
+	}
+
+	o.frames = append(o.frames, f)
+	if len(o.frames) > o.stats.MaxQueued {
+		o.stats.MaxQueued = len(o.frames)
+	}
+
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Waits for the next frame, false once the outbox is closed
+// or drained
+func (o *outbox) pop() (frame, bool) {
+	for {
+		o.mutex.Lock()
+		if o.closed {
+			o.mutex.Unlock()
+			return frame{}, false
+		}
+		if len(o.frames) > 0 {
+			f := o.frames[0]
+			o.frames = o.frames[1:]
+			o.mutex.Unlock()
+			return f, true
+		}
+		if o.draining {
+			o.mutex.Unlock()
+			return frame{}, false
+		}
+		o.mutex.Unlock()
+
+		<-o.notify
+	}
+}
+
+// Stops accepting frames, the writer gets the ones queued and last
+// before the outbox reports it is done. Returns false when it was
+// already closed or draining
+func (o *outbox) drain(last frame) bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.closed || o.draining {
+		return false
+	}
+
+	o.draining = true
+	o.frames = append(o.frames, last)
+
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+// Whether frames are still accepted
+func (o *outbox) open() bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	return !o.closed && !o.draining
+}
+
+// Aborts, frames still queued are never written
+func (o *outbox) close() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if !o.closed {
+		o.closed = true
+		o.frames = nil
+		close(o.notify)
+	}
+}
+
+func (o *outbox) Stats() SocketStats {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	stats := o.stats
+	stats.Queued = len(o.frames)
+	return stats
+}
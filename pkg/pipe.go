@@ -0,0 +1,268 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const PIPE_TIMEOUT = time.Second
+
+var (
+	ErrPipeClosed     = errors.New("Pipe closed")
+	ErrReceiveTimeout = errors.New("Timed out waiting for a response")
+)
+
+// Returned by Expect when the next response is of another type
+type UnexpectedResponseError struct {
+	Expected string
+	Response Response
+}
+
+func (e *UnexpectedResponseError) Error() string {
+	return fmt.Sprintf("Expected response %v, got %v: %v", e.Expected, e.Response.Type, e.Response.Payload)
+}
+
+// Unbounded FIFO with a single consumer
+type mailbox[T any] struct {
+	mutex  sync.Mutex
+	items  []T
+	notify chan struct{}
+	done   chan struct{}
+	closed bool
+}
+
+func newMailbox[T any]() *mailbox[T] {
+	return &mailbox[T]{
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+func (m *mailbox[T]) put(item T) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return ErrPipeClosed
+	}
+	m.items = append(m.items, item)
+
+	select {
+	case m.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Waits for the next item until the timeout, zero waits forever.
+// Items put before closing are still taken
+func (m *mailbox[T]) take(timeout time.Duration) (T, error) {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		m.mutex.Lock()
+		if len(m.items) > 0 {
+			item := m.items[0]
+			m.items = m.items[1:]
+			m.mutex.Unlock()
+			return item, nil
+		}
+		closed := m.closed
+		m.mutex.Unlock()
+
+		var none T
+		if closed {
+			return none, ErrPipeClosed
+		}
+
+		select {
+		case <-m.notify:
+		case <-m.done:
+		case <-expired:
+			return none, ErrReceiveTimeout
+		}
+	}
+}
+
+func (m *mailbox[T]) close() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.closed {
+		m.closed = true
+		close(m.done)
+	}
+}
+
+// Connects a client to a server in memory, e.g. for tests or to embed
+// the server. Delivery is ordered and unbounded both ways, and messages
+// go through JSON like they would over a connection
+func NewPipe() (*PipeClient, *PipeSocket) {
+	messages := newMailbox[Message]()
+	responses := newMailbox[Response]()
+
+	client := &PipeClient{
+		Timeout:   PIPE_TIMEOUT,
+		messages:  messages,
+		responses: responses,
+	}
+	socket := &PipeSocket{
+		session:   NewSession(),
+		messages:  messages,
+		responses: responses,
+	}
+	return client, socket
+}
+
+// Server end of a pipe, served by Server.ServeSocket
+type PipeSocket struct {
+	session   *Session
+	messages  *mailbox[Message]
+	responses *mailbox[Response]
+}
+
+func (p *PipeSocket) Session() *Session {
+	return p.session
+}
+
+// Payloads are encoded right away, later changes to
+// the values sent don't reach the client
+func (p *PipeSocket) Send(response Response) (int, error) {
+	data, err := json.Marshal(response.Payload)
+	if err != nil {
+		return 0, err
+	}
+	response.Payload = json.RawMessage(data)
+
+	if err := p.responses.put(response); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Writes a JSON encoded response
+func (p *PipeSocket) Write(data []byte) (int, error) {
+	var response Response
+	if err := json.Unmarshal(data, &response); err != nil {
+		return 0, err
+	}
+	if _, err := p.Send(response); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Reads the next message JSON encoded
+func (p *PipeSocket) Read(data []byte) (int, error) {
+	message, err := p.Receive()
+	if err != nil {
+		return 0, err
+	}
+
+	encoding, err := json.Marshal(message)
+	if err != nil {
+		return 0, err
+	}
+	return copy(data, encoding), io.EOF
+}
+
+// Waits for the next message from the client
+func (p *PipeSocket) Receive() (Message, error) {
+	return p.messages.take(0)
+}
+
+// Closes both ends, responses already sent can still be received
+func (p *PipeSocket) Close() error {
+	p.messages.close()
+	p.responses.close()
+	return nil
+}
+
+// Client end of a pipe. Expectations wait up to Timeout,
+// forever when zero
+type PipeClient struct {
+	Timeout   time.Duration
+	messages  *mailbox[Message]
+	responses *mailbox[Response]
+}
+
+func (c *PipeClient) Send(message Message) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	// decoded the way sockets do, params are left raw
+	var decoded Message
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	return c.messages.put(decoded)
+}
+
+func (c *PipeClient) Call(method string, params any) error {
+	return c.Send(Message{Method: method, Params: params})
+}
+
+// Waits for the next response until the timeout, zero waits forever
+func (c *PipeClient) Receive(timeout time.Duration) (Response, error) {
+	return c.responses.take(timeout)
+}
+
+// Takes the next response, failing unless it is of type kind
+func (c *PipeClient) Expect(kind string) (Response, error) {
+	response, err := c.Receive(c.Timeout)
+	if err != nil {
+		return response, err
+	}
+	if response.Type != kind {
+		return response, &UnexpectedResponseError{Expected: kind, Response: response}
+	}
+	return response, nil
+}
+
+// Expects a response of type kind and decodes its payload into dest
+func (c *PipeClient) ExpectPayload(kind string, dest any) error {
+	response, err := c.Expect(kind)
+	if err != nil {
+		return err
+	}
+	return ParsePayload(response.Payload, dest)
+}
+
+// Skips responses until one of type kind arrives
+func (c *PipeClient) SkipUntil(kind string) (Response, error) {
+	var deadline time.Time
+	if c.Timeout > 0 {
+		deadline = time.Now().Add(c.Timeout)
+	}
+
+	for {
+		var timeout time.Duration
+		if !deadline.IsZero() {
+			if timeout = time.Until(deadline); timeout <= 0 {
+				return Response{}, ErrReceiveTimeout
+			}
+		}
+
+		response, err := c.Receive(timeout)
+		if err != nil || response.Type == kind {
+			return response, err
+		}
+	}
+}
+
+func (c *PipeClient) Close() error {
+	c.messages.close()
+	c.responses.close()
+	return nil
+}
@@ -0,0 +1,127 @@
+package pkg_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"git.internal.com/wingspan/pkg"
+)
+
+func TestPipe(t *testing.T) {
+	t.Run("delivers in order without bounds", func(t *testing.T) {
+		client, socket := pkg.NewPipe()
+
+		for i := 1; i <= 1000; i++ {
+			if _, err := socket.Send(pkg.Response{Seq: uint64(i), Type: pkg.Ack}); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+
+		for i := 1; i <= 1000; i++ {
+			response, err := client.Expect(pkg.Ack)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if response.Seq != uint64(i) {
+				t.Fatalf("Expected response %v, got %v", i, response.Seq)
+			}
+		}
+	})
+
+	t.Run("params arrive raw", func(t *testing.T) {
+		client, socket := pkg.NewPipe()
+
+		client.Send(pkg.Message{ID: "1", Method: "Game.PlayCard", Params: 169})
+
+		message, err := socket.Receive()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if message.ID != "1" || message.Method != "Game.PlayCard" {
+			t.Errorf("Expected message 1 to Game.PlayCard, got %+v", message)
+		}
+		if params, ok := message.Params.(json.RawMessage); !ok || string(params) != "169" {
+			t.Errorf("Expected raw params 169, got %#v", message.Params)
+		}
+	})
+
+	t.Run("payloads are copied", func(t *testing.T) {
+		client, socket := pkg.NewPipe()
+
+		food := map[pkg.FoodType]int{pkg.Fish: 1}
+		socket.Send(pkg.Response{Type: pkg.FoodUpdated, Payload: food})
+		food[pkg.Fish] = 2
+
+		var received map[pkg.FoodType]int
+		if err := client.ExpectPayload(pkg.FoodUpdated, &received); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if received[pkg.Fish] != 1 {
+			t.Errorf("Expected 1 fish, got %v", received[pkg.Fish])
+		}
+	})
+
+	t.Run("times out", func(t *testing.T) {
+		client, _ := pkg.NewPipe()
+		client.Timeout = 10 * time.Millisecond
+
+		if _, err := client.Expect(pkg.Ack); err != pkg.ErrReceiveTimeout {
+			t.Errorf("Expected error %v, got %v", pkg.ErrReceiveTimeout, err)
+		}
+		if _, err := client.SkipUntil(pkg.Ack); err != pkg.ErrReceiveTimeout {
+			t.Errorf("Expected error %v, got %v", pkg.ErrReceiveTimeout, err)
+		}
+	})
+
+	t.Run("unexpected response", func(t *testing.T) {
+		client, socket := pkg.NewPipe()
+		socket.Send(pkg.Response{Type: pkg.WaitForMatch})
+
+		_, err := client.Expect(pkg.MatchFound)
+
+		var unexpected *pkg.UnexpectedResponseError
+		if !errors.As(err, &unexpected) || unexpected.Response.Type != pkg.WaitForMatch {
+			t.Errorf("Expected unexpected %v response, got %v", pkg.WaitForMatch, err)
+		}
+	})
+
+	t.Run("skips until", func(t *testing.T) {
+		client, socket := pkg.NewPipe()
+		socket.Send(pkg.Response{Type: pkg.WaitForMatch})
+		socket.Send(pkg.Response{Type: pkg.MatchFound})
+
+		if _, err := client.SkipUntil(pkg.MatchFound); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		client, socket := pkg.NewPipe()
+		socket.Send(pkg.Response{Type: pkg.Maintenance})
+
+		done := make(chan error)
+		go func() {
+			_, err := socket.Receive()
+			done <- err
+		}()
+
+		client.Close()
+
+		if err := <-done; err != pkg.ErrPipeClosed {
+			t.Errorf("Expected error %v, got %v", pkg.ErrPipeClosed, err)
+		}
+		if _, err := socket.Send(pkg.Response{Type: pkg.Ack}); err != pkg.ErrPipeClosed {
+			t.Errorf("Expected error %v, got %v", pkg.ErrPipeClosed, err)
+		}
+
+		// responses sent before closing are still delivered
+		if _, err := client.Expect(pkg.Maintenance); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		if _, err := client.Expect(pkg.Ack); err != pkg.ErrPipeClosed {
+			t.Errorf("Expected error %v, got %v", pkg.ErrPipeClosed, err)
+		}
+	})
+}
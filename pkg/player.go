@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"math/rand"
 	"sync"
 
 	"github.com/google/uuid"
@@ -52,22 +53,160 @@ func (h *BirdHand) Birds() []*Bird {
 
 type Player struct {
 	ID     uuid.UUID
+	owner  string
+	token  string
 	socket Socket
+	kicked bool
+	conn   sync.RWMutex
+	events *EventLog
 	state  State
 	mutex  sync.Mutex
 	food   *sync.Map
 	birds  *BirdHand
 	board  *Board
+	rand   *rand.Rand
 }
 
 func NewPlayer(socket Socket) *Player {
+	return NewPlayerWithRand(socket, nil)
+}
+
+// Powers the player uses roll with rng, games pass their own
+func NewPlayerWithRand(socket Socket, rng *rand.Rand) *Player {
+	var owner string
+	if socket != nil {
+		owner = socket.Session().ID()
+	}
+
+	// resume tokens only fail to generate if the system's
+	// randomness does, the seat just can't be resumed then
+	token, _ := newToken()
+
 	return &Player{
 		ID:     uuid.New(),
+		owner:  owner,
+		token:  token,
 		socket: socket,
+		events: NewEventLog(EVENT_LOG_SIZE),
 		board:  NewBoard(),
 		food:   new(sync.Map),
 		birds:  NewBirdHand(),
+		rand:   rng,
+	}
+}
+
+// Session ID of the player the seat belongs to
+func (p *Player) Owner() string {
+	p.conn.RLock()
+	defer p.conn.RUnlock()
+
+	return p.owner
+}
+
+// Whether an operator took the seat away from its owner
+func (p *Player) Kicked() bool {
+	p.conn.RLock()
+	defer p.conn.RUnlock()
+
+	return p.kicked
+}
+
+// Randomness of the player's game, powers cast
+// outside of a game roll with the default one
+func (p *Player) random() *rand.Rand {
+	if p == nil || p.rand == nil {
+		return defaultRand
+	}
+	return p.rand
+}
+
+func (p *Player) resumeToken() string {
+	p.conn.RLock()
+	defer p.conn.RUnlock()
+
+	return p.token
+}
+
+// Records the response so it can be replayed on resume,
+// it is only sent while the player is connected
+func (p *Player) Send(response Response) (int, error) {
+	// held while sending so events go out in the order they are
+	// numbered, and a resume can't slip in between
+	p.conn.Lock()
+	defer p.conn.Unlock()
+
+	response = p.events.Append(response)
+	if p.socket == nil {
+		return 0, nil
 	}
+	return p.socket.Send(stamped(p.socket, response))
+}
+
+// Events keep their sequence number only for
+// clients that asked for them
+func stamped(socket Socket, response Response) Response {
+	if !socket.Session().Protocol().Has(CapabilitySeq) {
+		response.Seq = 0
+	}
+	return response
+}
+
+// Protocol of the player's connection, the latest
+// version while the player is disconnected
+func (p *Player) Protocol() Protocol {
+	if socket := p.connection(); socket != nil {
+		return socket.Session().Protocol()
+	}
+	return Protocol{Version: PROTOCOL_VERSION}
+}
+
+func (p *Player) connection() Socket {
+	p.conn.RLock()
+	defer p.conn.RUnlock()
+
+	return p.socket
+}
+
+// Sets the socket events go to, nil while disconnected
+func (p *Player) attach(socket Socket) {
+	p.conn.Lock()
+	defer p.conn.Unlock()
+
+	p.socket = socket
+	if socket != nil {
+		p.owner = socket.Session().ID()
+	}
+}
+
+// Attaches socket after replaying the events it missed since seq,
+// nothing is sent to the player until it is done
+func (p *Player) resume(socket Socket, seq uint64) (complete bool, err error) {
+	p.conn.Lock()
+	defer p.conn.Unlock()
+
+	p.socket = socket
+	p.owner = socket.Session().ID()
+
+	events, complete := p.events.Since(seq)
+	for _, event := range events {
+		if _, err := socket.Send(stamped(socket, event)); err != nil {
+			return false, err
+		}
+	}
+	return complete, nil
+}
+
+// Detaches the seat for good, the token is replaced by one nobody
+// holds so it can't be resumed. Returns the socket it was attached to
+func (p *Player) kick() Socket {
+	p.conn.Lock()
+	defer p.conn.Unlock()
+
+	socket := p.socket
+	p.socket = nil
+	p.kicked = true
+	p.token, _ = newToken()
+	return socket
 }
 
 func (p *Player) Draw(deck Deck, qty int) error {
@@ -162,7 +301,7 @@ func (p *Player) PlayBird(birdId BirdID) error {
 	}
 
 	if len(payload.Food) > 0 || payload.EggCost != 0 {
-		p.socket.Send(Response{
+		p.Send(Response{
 			Type:    PayBirdCost,
 			Payload: payload,
 		})
@@ -1,7 +1,5 @@
 package pkg
 
-import "math/rand"
-
 type Power interface {
 	Execute(*Bird, *Player) error
 }
@@ -198,8 +196,9 @@ func NewFishingPower(qty int, food FoodType) *FishingPower {
 	}
 }
 
+// Rolls with the player's game randomness
 func (p *FishingPower) Execute(bird *Bird, player *Player) error {
-	random := rand.Intn(FOOD_TYPE_COUNT)
+	random := player.random().Intn(FOOD_TYPE_COUNT)
 	if FoodType(random) == p.Food {
 		bird.CacheFood(p.Qty)
 	}
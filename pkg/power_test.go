@@ -9,7 +9,7 @@ import (
 
 func TestGainFoodPower(t *testing.T) {
 	t.Run("gain one food from feeder", func(t *testing.T) {
-		feeder := pkg.NewBirdfeeder(20)
+		feeder := pkg.NewBirdfeederWithRand(20, pkg.NewRand(TEST_SEED))
 		player := pkg.NewPlayer(pkg.NewTestSocket())
 
 		power := pkg.NewGainFood(1, pkg.Fish, feeder)
@@ -29,7 +29,7 @@ func TestGainFoodPower(t *testing.T) {
 	})
 
 	t.Run("gain all food from feeder", func(t *testing.T) {
-		feeder := pkg.NewBirdfeeder(10)
+		feeder := pkg.NewBirdfeederWithRand(10, pkg.NewRand(TEST_SEED))
 		player := pkg.NewPlayer(pkg.NewTestSocket())
 
 		power := pkg.NewGainFood(-1, pkg.Fish, feeder)
@@ -71,7 +71,7 @@ func TestGainFoodPower(t *testing.T) {
 	})
 
 	t.Run("gain any food from feeder", func(t *testing.T) {
-		feeder := pkg.NewBirdfeeder(10)
+		feeder := pkg.NewBirdfeederWithRand(10, pkg.NewRand(TEST_SEED))
 		power := pkg.NewGainFood(1, -1, feeder)
 
 		socket := pkg.NewTestSocket()
@@ -125,7 +125,7 @@ func TestCacheFoodPower(t *testing.T) {
 
 	t.Run("cache food from birdfeeder", func(t *testing.T) {
 		bird := &pkg.Bird{}
-		feeder := pkg.NewBirdfeeder(50)
+		feeder := pkg.NewBirdfeederWithRand(50, pkg.NewRand(TEST_SEED))
 		power := pkg.NewCacheFoodPower(pkg.Rodent, 2, feeder)
 
 		if err := power.Execute(bird, nil); err != nil {
@@ -297,11 +297,17 @@ func TestTuckPower(t *testing.T) {
 }
 
 func TestFishingPower(t *testing.T) {
+	// a die rolled with the same seed as the player's tells what they roll
+	roll := func() pkg.FoodType {
+		return pkg.FoodType(pkg.NewRand(TEST_SEED).Intn(pkg.FOOD_TYPE_COUNT))
+	}
+
 	t.Run("unsuccessfull", func(t *testing.T) {
 		bird := &pkg.Bird{}
-		power := pkg.NewFishingPower(1, pkg.Seed)
+		player := pkg.NewPlayerWithRand(nil, pkg.NewRand(TEST_SEED))
+		power := pkg.NewFishingPower(1, (roll()+1)%pkg.FOOD_TYPE_COUNT)
 
-		if err := power.Execute(bird, nil); err != nil {
+		if err := power.Execute(bird, player); err != nil {
 			t.Fatalf("could not hunt: %v", err)
 		}
 		if bird.CachedFood != 0 {
@@ -311,9 +317,10 @@ func TestFishingPower(t *testing.T) {
 
 	t.Run("successfull", func(t *testing.T) {
 		bird := &pkg.Bird{}
-		power := pkg.NewFishingPower(1, pkg.Rodent)
+		player := pkg.NewPlayerWithRand(nil, pkg.NewRand(TEST_SEED))
+		power := pkg.NewFishingPower(1, roll())
 
-		if err := power.Execute(bird, nil); err != nil {
+		if err := power.Execute(bird, player); err != nil {
 			t.Fatalf("could not hunt: %v", err)
 		}
 		if bird.CachedFood != 1 {
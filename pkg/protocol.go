@@ -0,0 +1,99 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Protocol versions the server speaks. Clients that never say hello
+// are assumed to speak LEGACY_PROTOCOL_VERSION
+//
+//	1: game_started carries the player ID
+//	2: game_started carries the player ID and its resume token
+const (
+	LEGACY_PROTOCOL_VERSION = 1
+	MIN_PROTOCOL_VERSION    = 1
+	PROTOCOL_VERSION        = 2
+
+	// First version whose game_started carries the resume token
+	RESUME_PROTOCOL_VERSION = 2
+)
+
+// Optional features clients may ask for in their hello
+const (
+	// Resuming seats and replaying missed events
+	CapabilityResume = "resume"
+	// Sequence numbers on game events
+	CapabilitySeq = "seq"
+)
+
+var ServerCapabilities = []string{CapabilityResume, CapabilitySeq}
+
+var (
+	ErrUnsupportedVersion = errors.New("Unsupported protocol version")
+	ErrNotNegotiated      = errors.New("Capability was not negotiated")
+)
+
+// Sent by clients first thing after connecting. MinVersion
+// defaults to Version when the client speaks a single one
+type HelloPayload struct {
+	Version      int
+	MinVersion   int `json:",omitempty"`
+	Capabilities []string
+	Client       string `json:",omitempty"`
+}
+
+type WelcomePayload struct {
+	Version      int
+	Capabilities []string
+}
+
+type UnsupportedVersionPayload struct {
+	MinVersion int
+	MaxVersion int
+	Reason     string
+}
+
+// What was negotiated with a client
+type Protocol struct {
+	Version      int
+	Capabilities map[string]bool
+}
+
+func (p Protocol) Has(capability string) bool {
+	return p.Capabilities[capability]
+}
+
+// Picks the highest version both sides speak along with
+// the capabilities both sides support
+func Negotiate(hello HelloPayload) (Protocol, error) {
+	min := hello.MinVersion
+	if min == 0 {
+		min = hello.Version
+	}
+
+	version := hello.Version
+	if version > PROTOCOL_VERSION {
+		version = PROTOCOL_VERSION
+	}
+
+	if version < MIN_PROTOCOL_VERSION || version < min {
+		return Protocol{}, fmt.Errorf("%w: client speaks %v to %v, server speaks %v to %v",
+			ErrUnsupportedVersion, min, hello.Version, MIN_PROTOCOL_VERSION, PROTOCOL_VERSION)
+	}
+
+	protocol := Protocol{
+		Version:      version,
+		Capabilities: make(map[string]bool),
+	}
+
+	for _, requested := range hello.Capabilities {
+		for _, supported := range ServerCapabilities {
+			if requested == supported {
+				protocol.Capabilities[requested] = true
+			}
+		}
+	}
+
+	return protocol, nil
+}
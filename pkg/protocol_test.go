@@ -0,0 +1,52 @@
+package pkg_test
+
+import (
+	"errors"
+	"testing"
+
+	"git.internal.com/wingspan/pkg"
+)
+
+func TestNegotiate(t *testing.T) {
+	t.Run("picks highest common version", func(t *testing.T) {
+		protocol, err := pkg.Negotiate(pkg.HelloPayload{Version: pkg.PROTOCOL_VERSION + 3, MinVersion: 1})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if protocol.Version != pkg.PROTOCOL_VERSION {
+			t.Errorf("Expected %v, got %v", pkg.PROTOCOL_VERSION, protocol.Version)
+		}
+
+		protocol, _ = pkg.Negotiate(pkg.HelloPayload{Version: 1})
+		if protocol.Version != 1 {
+			t.Errorf("Expected %v, got %v", 1, protocol.Version)
+		}
+	})
+
+	t.Run("rejects unsupported versions", func(t *testing.T) {
+		hellos := []pkg.HelloPayload{
+			{Version: pkg.PROTOCOL_VERSION + 1},
+			{Version: 0},
+		}
+
+		for _, hello := range hellos {
+			if _, err := pkg.Negotiate(hello); !errors.Is(err, pkg.ErrUnsupportedVersion) {
+				t.Errorf("Expected error %v, got %v", pkg.ErrUnsupportedVersion, err)
+			}
+		}
+	})
+
+	t.Run("capabilities", func(t *testing.T) {
+		protocol, _ := pkg.Negotiate(pkg.HelloPayload{
+			Version:      pkg.PROTOCOL_VERSION,
+			Capabilities: []string{pkg.CapabilityResume, "telepathy"},
+		})
+
+		if !protocol.Has(pkg.CapabilityResume) {
+			t.Errorf("Expected %v", pkg.CapabilityResume)
+		}
+		if protocol.Has("telepathy") || protocol.Has(pkg.CapabilitySeq) {
+			t.Errorf("Expected only requested and supported capabilities, got %v", protocol.Capabilities)
+		}
+	})
+}
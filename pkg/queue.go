@@ -2,6 +2,7 @@ package pkg
 
 import (
 	"container/list"
+	"context"
 	"errors"
 	"sync"
 )
@@ -9,13 +10,17 @@ import (
 var (
 	ErrAlreadyInQueue  = errors.New("Socket already enqueued")
 	ErrSocketNotQueued = errors.New("Socket not enqueued")
+	ErrQueueClosed     = errors.New("Queue is closed")
+	ErrQueueCleared    = errors.New("Queue was cleared, join it again")
 )
 
 type Queue struct {
 	maxPlayers int
+	closed     bool
 	mutex      *sync.Mutex
 	players    *list.List
-	sockets    map[Socket]*list.Element
+	sockets    map[string]*list.Element
+	logger     *Logger
 }
 
 func NewQueue(maxPlayers int) *Queue {
@@ -23,7 +28,8 @@ func NewQueue(maxPlayers int) *Queue {
 		maxPlayers: maxPlayers,
 		mutex:      new(sync.Mutex),
 		players:    list.New(),
-		sockets:    make(map[Socket]*list.Element),
+		sockets:    make(map[string]*list.Element),
+		logger:     DiscardLogger(),
 	}
 }
 
@@ -31,6 +37,10 @@ func (q *Queue) Add(socket Socket, sockets []Socket) (*Message, error) {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
+	if q.closed {
+		return nil, ErrQueueClosed
+	}
+
 	if len(sockets) == 0 {
 		sockets = append(sockets, socket)
 	}
@@ -39,12 +49,19 @@ func (q *Queue) Add(socket Socket, sockets []Socket) (*Message, error) {
 		if player == nil {
 			continue
 		}
-		if _, ok := q.sockets[player]; !ok {
-			q.sockets[player] = q.players.PushBack(player)
-
-			if _, err := player.Send(Response{Type: WaitForMatch}); err != nil {
+		id := player.Session().ID()
+		if _, ok := q.sockets[id]; !ok {
+			q.sockets[id] = q.players.PushBack(player)
+
+			// only the caller is answered, others are queued on their behalf
+			response := Response{Type: WaitForMatch}
+			if player == socket {
+				response.ID = socket.Session().Request()
+			}
+			if _, err := player.Send(response); err != nil {
 				return nil, err
 			}
+			q.logger.Debug("Player queued", "session", id, "conn", player.Session().ConnectionID(), "queued", q.players.Len())
 		} else {
 			return nil, ErrAlreadyInQueue
 		}
@@ -56,9 +73,11 @@ func (q *Queue) Add(socket Socket, sockets []Socket) (*Message, error) {
 		for i := 0; i < q.maxPlayers; i++ {
 			player := q.players.Remove(q.players.Front()).(Socket)
 			players = append(players, player)
-			delete(q.sockets, player)
+			delete(q.sockets, player.Session().ID())
 		}
 
+		q.logger.Info("Players matched", "sessions", sessionIDs(players), "queued", q.players.Len())
+
 		return &Message{
 			Method: "Matchmaker.CreateMatch",
 			Params: players,
@@ -72,12 +91,100 @@ func (q *Queue) Remove(socket Socket) (*Message, error) {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
-	if _, ok := q.sockets[socket]; !ok {
+	id := socket.Session().ID()
+	if _, ok := q.sockets[id]; !ok {
 		return nil, ErrSocketNotQueued
 	}
 
-	q.players.Remove(q.sockets[socket])
-	delete(q.sockets, socket)
+	q.players.Remove(q.sockets[id])
+	delete(q.sockets, id)
+	q.logger.Debug("Player left the queue", "session", id, "conn", socket.Session().ConnectionID())
 
 	return nil, nil
 }
+
+// Takes the socket out of the queue when it was waiting, unless the
+// session is queued from another connection
+func (q *Queue) Disconnect(socket Socket) (*Message, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	id := socket.Session().ID()
+	element, ok := q.sockets[id]
+	if !ok || element.Value.(Socket) != socket {
+		return nil, nil
+	}
+
+	q.players.Remove(element)
+	delete(q.sockets, id)
+	q.logger.Debug("Player left the queue", "session", id, "conn", socket.Session().ConnectionID(), "reason", "disconnected")
+
+	return nil, nil
+}
+
+func (q *Queue) InternalMethods() []string {
+	return []string{"Disconnect"}
+}
+
+func (q *Queue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.players.Len()
+}
+
+// Session IDs of the players waiting, longest waiting first
+func (q *Queue) Sessions() []string {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	sessions := make([]string, 0, q.players.Len())
+	for e := q.players.Front(); e != nil; e = e.Next() {
+		sessions = append(sessions, e.Value.(Socket).Session().ID())
+	}
+	return sessions
+}
+
+// Removes every player waiting, who are told so they can join again.
+// Returns how many were removed
+func (q *Queue) Clear() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	removed := q.players.Len()
+	for e := q.players.Front(); e != nil; e = e.Next() {
+		e.Value.(Socket).Send(errorResponse("", ErrQueueCleared))
+	}
+
+	q.players.Init()
+	q.sockets = make(map[string]*list.Element)
+	q.logger.Warn("Queue cleared", "dropped", removed)
+
+	return removed
+}
+
+func (q *Queue) SetLogger(logger *Logger) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.logger = logger
+}
+
+func (q *Queue) CollectMetrics(metrics *Metrics) {
+	metrics.Gauge("wingspan_queue_players", "Players waiting for a match")
+	metrics.Set("wingspan_queue_players", float64(q.Len()))
+}
+
+// Stops accepting players and empties the queue
+func (q *Queue) Drain(ctx context.Context) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.logger.Info("Queue drained", "dropped", q.players.Len())
+
+	q.closed = true
+	q.players.Init()
+	q.sockets = make(map[string]*list.Element)
+
+	return nil
+}
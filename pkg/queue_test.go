@@ -1,6 +1,7 @@
 package pkg_test
 
 import (
+	"context"
 	"testing"
 
 	"git.internal.com/wingspan/pkg"
@@ -44,6 +45,25 @@ func TestQueue(t *testing.T) {
 		}
 	})
 
+	t.Run("cannot enqueue same account twice", func(t *testing.T) {
+		queue := pkg.NewQueue(5)
+		account := &pkg.Account{ID: "player"}
+
+		first := pkg.NewTestSocket()
+		second := pkg.NewTestSocket()
+
+		first.Session().Authenticate(account)
+		second.Session().Authenticate(account)
+
+		queue.Add(first, nil)
+		if _, err := queue.Add(second, nil); err != pkg.ErrAlreadyInQueue {
+			t.Errorf("Expected error %v, got %v", pkg.ErrAlreadyInQueue, err)
+		}
+		if _, err := queue.Remove(second); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
 	t.Run("dequeue", func(t *testing.T) {
 		queue := pkg.NewQueue(5)
 		socket := pkg.NewTestSocket()
@@ -67,6 +87,46 @@ func TestQueue(t *testing.T) {
 		}
 	})
 
+	t.Run("leaves on disconnect", func(t *testing.T) {
+		queue := pkg.NewQueue(5)
+		server := pkg.NewServer()
+		server.Register("Queue", queue)
+
+		client, socket := pkg.NewPipe()
+		served := make(chan error)
+		go func() { served <- server.ServeSocket(socket) }()
+
+		client.Call("Queue.Add", nil)
+		if _, err := client.Expect(pkg.WaitForMatch); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		client.Close()
+		<-served
+
+		if queue.Len() != 0 {
+			t.Errorf("Expected empty queue, got %v", queue.Len())
+		}
+	})
+
+	t.Run("disconnect keeps other connections of the session", func(t *testing.T) {
+		queue := pkg.NewQueue(5)
+		account := &pkg.Account{ID: "player"}
+
+		first := pkg.NewTestSocket()
+		second := pkg.NewTestSocket()
+
+		first.Session().Authenticate(account)
+		second.Session().Authenticate(account)
+
+		queue.Add(first, nil)
+		queue.Disconnect(second)
+
+		if queue.Len() != 1 {
+			t.Errorf("Expected %v queued, got %v", 1, queue.Len())
+		}
+	})
+
 	t.Run("match found", func(t *testing.T) {
 		queue := pkg.NewQueue(2)
 
@@ -129,4 +189,18 @@ func TestQueue(t *testing.T) {
 		go queue.Add(pkg.NewTestSocket(), nil)
 		go queue.Remove(pkg.NewTestSocket())
 	})
+	t.Run("drain", func(t *testing.T) {
+		queue := pkg.NewQueue(2)
+		socket := pkg.NewTestSocket()
+
+		queue.Add(socket, nil)
+		queue.Drain(context.Background())
+
+		if _, err := queue.Remove(socket); err != pkg.ErrSocketNotQueued {
+			t.Errorf("Expected error %v, got %v", pkg.ErrSocketNotQueued, err)
+		}
+		if _, err := queue.Add(socket, nil); err != pkg.ErrQueueClosed {
+			t.Errorf("Expected error %v, got %v", pkg.ErrQueueClosed, err)
+		}
+	})
 }
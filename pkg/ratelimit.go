@@ -0,0 +1,182 @@
+package pkg
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Violations older than this are forgiven
+const VIOLATION_WINDOW = time.Minute
+
+var (
+	ErrRateLimited       = errors.New("Too many messages, slow down")
+	ErrTooManyViolations = errors.New("Too many messages, disconnecting")
+)
+
+// Token bucket refilled at Rate messages per second holding up to
+// Burst of them. A zero Rate means no limit
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+type RateLimits struct {
+	// Applies to every message of a connection
+	Connection RateLimit
+	// Methods limited on top of the connection, e.g. "Game.GainFood"
+	Methods map[string]RateLimit
+	// Violations within VIOLATION_WINDOW before every message of the
+	// connection is delayed by Throttle, and before it is disconnected.
+	// Zero never escalates
+	ThrottleAfter   int
+	DisconnectAfter int
+	Throttle        time.Duration
+}
+
+func DefaultRateLimits() RateLimits {
+	return RateLimits{
+		Connection: RateLimit{Rate: 20, Burst: 40},
+		Methods: map[string]RateLimit{
+			"Auth.Login":    {Rate: 0.2, Burst: 5},
+			"Auth.Register": {Rate: 0.2, Burst: 5},
+			"Queue.Add":     {Rate: 1, Burst: 3},
+		},
+		ThrottleAfter:   10,
+		DisconnectAfter: 50,
+		Throttle:        500 * time.Millisecond,
+	}
+}
+
+type RateLimitStats struct {
+	// Messages rejected
+	Limited uint64
+	// Messages delayed
+	Throttled uint64
+	// Connections dropped
+	Disconnected uint64
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *bucket) take(limit RateLimit, now time.Time) bool {
+	if limit.Rate <= 0 {
+		return true
+	}
+
+	if b.last.IsZero() {
+		b.tokens = float64(limit.Burst)
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * limit.Rate
+		if b.tokens > float64(limit.Burst) {
+			b.tokens = float64(limit.Burst)
+		}
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+type limiterState struct {
+	mutex         sync.Mutex
+	connection    bucket
+	methods       map[string]*bucket
+	violations    int
+	lastViolation time.Time
+}
+
+// Limits how fast each connection may send messages, escalating from
+// rejecting messages to throttling and then disconnecting connections
+// that keep going over the limits
+type RateLimiter struct {
+	limits       RateLimits
+	sockets      *sync.Map
+	limited      atomic.Uint64
+	throttled    atomic.Uint64
+	disconnected atomic.Uint64
+}
+
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	return &RateLimiter{
+		limits:  limits,
+		sockets: new(sync.Map),
+	}
+}
+
+// Checks method against the socket's buckets, returning
+// the violations so far when it goes over a limit
+func (r *RateLimiter) allow(socket Socket, method string) (bool, int) {
+	value, _ := r.sockets.LoadOrStore(socket, &limiterState{methods: make(map[string]*bucket)})
+	state := value.(*limiterState)
+
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(state.lastViolation) > VIOLATION_WINDOW {
+		state.violations = 0
+	}
+
+	allowed := state.connection.take(r.limits.Connection, now)
+	if limit, ok := r.limits.Methods[method]; ok && allowed {
+		if state.methods[method] == nil {
+			state.methods[method] = new(bucket)
+		}
+		allowed = state.methods[method].take(limit, now)
+	}
+
+	if !allowed {
+		state.violations++
+		state.lastViolation = now
+	}
+
+	return allowed, state.violations
+}
+
+func (r *RateLimiter) Intercept(next Handler) Handler {
+	return func(socket Socket, message Message) (*Message, error) {
+		if socket == nil || message.internal {
+			return next(socket, message)
+		}
+
+		allowed, violations := r.allow(socket, message.Method)
+
+		if !allowed && r.limits.DisconnectAfter > 0 && violations >= r.limits.DisconnectAfter {
+			r.disconnected.Add(1)
+			return nil, ErrTooManyViolations
+		}
+
+		if r.limits.ThrottleAfter > 0 && violations >= r.limits.ThrottleAfter {
+			r.throttled.Add(1)
+			time.Sleep(r.limits.Throttle)
+		}
+
+		if !allowed {
+			r.limited.Add(1)
+			return nil, ErrRateLimited
+		}
+
+		return next(socket, message)
+	}
+}
+
+// Drops the state kept for a socket that is gone
+func (r *RateLimiter) Forget(socket Socket) {
+	r.sockets.Delete(socket)
+}
+
+func (r *RateLimiter) Stats() RateLimitStats {
+	return RateLimitStats{
+		Limited:      r.limited.Load(),
+		Throttled:    r.throttled.Load(),
+		Disconnected: r.disconnected.Load(),
+	}
+}
@@ -0,0 +1,102 @@
+package pkg_test
+
+import (
+	"testing"
+	"time"
+
+	"git.internal.com/wingspan/pkg"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limit := func(limits pkg.RateLimits) (*pkg.RateLimiter, pkg.Handler) {
+		limiter := pkg.NewRateLimiter(limits)
+		handler := pkg.Chain(func(socket pkg.Socket, message pkg.Message) (*pkg.Message, error) {
+			return nil, nil
+		}, limiter.Intercept)
+		return limiter, handler
+	}
+
+	t.Run("allows bursts", func(t *testing.T) {
+		limiter, handler := limit(pkg.RateLimits{Connection: pkg.RateLimit{Rate: 1, Burst: 2}})
+		socket := pkg.NewTestSocket()
+
+		for i := 0; i < 2; i++ {
+			if _, err := handler(socket, pkg.Message{Method: "Game.GainFood"}); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+		if _, err := handler(socket, pkg.Message{Method: "Game.GainFood"}); err != pkg.ErrRateLimited {
+			t.Errorf("Expected error %v, got %v", pkg.ErrRateLimited, err)
+		}
+
+		if _, err := handler(pkg.NewTestSocket(), pkg.Message{Method: "Game.GainFood"}); err != nil {
+			t.Errorf("Expected other connections to be unaffected, got %v", err)
+		}
+		if limiter.Stats().Limited != 1 {
+			t.Errorf("Expected %v limited, got %v", 1, limiter.Stats().Limited)
+		}
+	})
+
+	t.Run("refills", func(t *testing.T) {
+		_, handler := limit(pkg.RateLimits{Connection: pkg.RateLimit{Rate: 100, Burst: 1}})
+		socket := pkg.NewTestSocket()
+
+		handler(socket, pkg.Message{Method: "Queue.Add"})
+		time.Sleep(20 * time.Millisecond)
+
+		if _, err := handler(socket, pkg.Message{Method: "Queue.Add"}); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	t.Run("limits methods", func(t *testing.T) {
+		_, handler := limit(pkg.RateLimits{
+			Methods: map[string]pkg.RateLimit{"Queue.Add": {Rate: 1, Burst: 1}},
+		})
+		socket := pkg.NewTestSocket()
+
+		handler(socket, pkg.Message{Method: "Queue.Add"})
+
+		if _, err := handler(socket, pkg.Message{Method: "Queue.Add"}); err != pkg.ErrRateLimited {
+			t.Errorf("Expected error %v, got %v", pkg.ErrRateLimited, err)
+		}
+		if _, err := handler(socket, pkg.Message{Method: "Queue.Remove"}); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	t.Run("escalates", func(t *testing.T) {
+		limiter, handler := limit(pkg.RateLimits{
+			Connection:      pkg.RateLimit{Rate: 0.001, Burst: 1},
+			ThrottleAfter:   2,
+			DisconnectAfter: 4,
+			Throttle:        10 * time.Millisecond,
+		})
+		socket := pkg.NewTestSocket()
+
+		expected := []error{nil, pkg.ErrRateLimited, pkg.ErrRateLimited, pkg.ErrRateLimited, pkg.ErrTooManyViolations}
+		for i, expected := range expected {
+			if _, err := handler(socket, pkg.Message{Method: "Game.GainFood"}); err != expected {
+				t.Errorf("Message %v: expected error %v, got %v", i, expected, err)
+			}
+		}
+
+		stats := limiter.Stats()
+		if stats.Throttled != 2 || stats.Disconnected != 1 {
+			t.Errorf("Expected 2 throttled and 1 disconnected, got %+v", stats)
+		}
+
+		limiter.Forget(socket)
+		if _, err := handler(socket, pkg.Message{Method: "Game.GainFood"}); err != nil {
+			t.Errorf("Expected forgotten socket to start over, got %v", err)
+		}
+	})
+
+	t.Run("skips follow ups", func(t *testing.T) {
+		_, handler := limit(pkg.RateLimits{Connection: pkg.RateLimit{Rate: 0.001, Burst: 0}})
+
+		if _, err := handler(nil, pkg.Message{Method: "Game.Create"}); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+}
@@ -1,10 +1,17 @@
 package pkg
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -14,54 +21,410 @@ var (
 	ErrMethodNotFound     = errors.New("Method not found")
 	ErrNilServiceProvided = errors.New("Cannot register nil service")
 	ErrNoMethodsAvailable = errors.New("There are no methods exported for this service")
+	ErrServiceRegistered  = errors.New("A service is already registered under this name")
 )
 
+// Returned when message params cannot be decoded
+// into the parameter type of the method called
+type ValidationError struct {
+	Method string
+	Field  string
+	Reason string
+}
+
+func NewValidationError(err error) *ValidationError {
+	invalid := &ValidationError{
+		Field:  "Params",
+		Reason: err.Error(),
+	}
+
+	if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+		if typeErr.Field != "" {
+			invalid.Field = typeErr.Field
+		}
+		invalid.Reason = fmt.Sprintf("expected %v, got %v", typeErr.Type, typeErr.Value)
+	}
+
+	return invalid
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("Invalid %v on %v: %v", e.Field, e.Method, e.Reason)
+}
+
+// Services implementing it are drained in registration
+// order when the server shuts down gracefully
+type Drainer interface {
+	Drain(ctx context.Context) error
+}
+
 type Service struct {
-	recv    any
-	methods map[string]reflect.Method
+	recv     any
+	methods  map[string]reflect.Method
+	internal map[string]bool
 }
 
 type Server struct {
-	server   *http.Server
-	upgrader *websocket.Upgrader
-	services map[string]*Service
+	server        *http.Server
+	upgrader      *websocket.Upgrader
+	services      map[string]*Service
+	interceptors  []Interceptor
+	bus           *EventBus
+	codecs        []Codec
+	gateway       *Gateway
+	admin         *Admin
+	order         []string
+	origins       map[string]bool
+	sockets       *sync.Map
+	socketOptions SocketOptions
+	limiter       *RateLimiter
+	metrics       *Metrics
+	logger        *Logger
+	log           *Logger
+	draining      atomic.Bool
+	started       time.Time
 }
 
+// Servers log nothing until given a logger with SetLogger
 func NewServer() *Server {
-	return &Server{
-		server:   new(http.Server),
-		upgrader: new(websocket.Upgrader),
-		services: make(map[string]*Service),
+	server := &Server{
+		server:        new(http.Server),
+		upgrader:      new(websocket.Upgrader),
+		services:      make(map[string]*Service),
+		bus:           NewEventBus(),
+		sockets:       new(sync.Map),
+		socketOptions: DefaultSocketOptions(),
+		metrics:       NewMetrics(),
+		started:       time.Now(),
 	}
+	server.SetLogger(DiscardLogger())
+	server.metrics.Histogram("wingspan_dispatch_duration_seconds", "Time taken to dispatch a message by method", LATENCY_BUCKETS)
+	server.metrics.Counter("wingspan_dispatch_errors_total", "Dispatches that failed by method and error")
+	server.upgrader.CheckOrigin = server.checkOrigin
+	server.gateway = NewGateway(server, SESSION_TIMEOUT)
+	server.AddCodec(JSONCodec, MsgpackCodec)
+	server.Register("System", &System{server: server})
+	return server
+}
+
+// Hands every registered service a logger for its subsystem,
+// services registered later get one as well. Must be called
+// before listening
+func (s *Server) SetLogger(logger *Logger) {
+	s.logger = logger
+	s.log = logger.Subsystem("server")
+
+	for _, name := range s.order {
+		if setter, ok := s.services[name].recv.(LoggerSetter); ok {
+			setter.SetLogger(logger.Subsystem(strings.ToLower(name)))
+		}
+	}
+}
+
+// Serves the admin API to requests bearing token,
+// an empty token disables it. Must be called before listening
+func (s *Server) SetAdminToken(token string) {
+	s.admin = nil
+	if token != "" {
+		s.admin = NewAdmin(s, token)
+	}
+}
+
+// Heartbeat and timeouts of websocket connections accepted from now on
+func (s *Server) SetSocketOptions(options SocketOptions) {
+	s.socketOptions = options
+}
+
+// Sessions the HTTP gateway keeps at once, zero is unbounded.
+// Must be called before listening
+func (s *Server) SetMaxSessions(max int) {
+	s.gateway.limit = max
+}
+
+// Limits messages of every websocket connection and gateway session,
+// before any interceptor runs. Must be called before listening
+func (s *Server) SetRateLimits(limits RateLimits) {
+	s.limiter = NewRateLimiter(limits)
+}
+
+// Nil unless rate limits were set
+func (s *Server) RateLimiter() *RateLimiter {
+	return s.limiter
+}
+
+// Outbound queues of every websocket connection, summed up
+// except for MaxQueued which is the largest among them
+func (s *Server) SocketStats() SocketStats {
+	var total SocketStats
+	s.sockets.Range(func(key, _ any) bool {
+		socket, ok := key.(*Sockt)
+		if !ok {
+			return true
+		}
+
+		stats := socket.Stats()
+		total.Queued += stats.Queued
+		total.Dropped += stats.Dropped
+		total.Coalesced += stats.Coalesced
+		total.Invalid += stats.Invalid
+		if stats.MaxQueued > total.MaxQueued {
+			total.MaxQueued = stats.MaxQueued
+		}
+		return true
+	})
+	return total
+}
+
+// Adds codecs clients may pick through the websocket subprotocol,
+// JSON is used when the client requests none
+func (s *Server) AddCodec(codecs ...Codec) {
+	for _, codec := range codecs {
+		s.codecs = append(s.codecs, codec)
+		s.upgrader.Subprotocols = append(s.upgrader.Subprotocols, codec.Name())
+	}
+}
+
+func (s *Server) codec(name string) Codec {
+	for _, codec := range s.codecs {
+		if codec.Name() == name {
+			return codec
+		}
+	}
+	return JSONCodec
 }
 
 func (s *Server) Close() {
 	s.server.Close()
+	s.bus.Close()
+}
+
+// Stops accepting connections and queue entries, warns connected
+// clients, drains services and closes connections. Games still running
+// when ctx is done are snapshotted and stopped
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.draining.Store(true)
+
+	var timeLeft float64
+	if deadline, ok := ctx.Deadline(); ok {
+		timeLeft = time.Until(deadline).Seconds()
+	}
+	s.broadcast(Response{Type: Maintenance, Payload: timeLeft})
+
+	var err error
+	for _, name := range s.order {
+		drainer, ok := s.services[name].recv.(Drainer)
+		if !ok {
+			continue
+		}
+		if drainErr := drainer.Drain(ctx); drainErr != nil && err == nil {
+			err = drainErr
+		}
+	}
+
+	s.gateway.expireAll()
+	s.sockets.Range(func(key, _ any) bool {
+		if socket, ok := key.(*Sockt); ok {
+			socket.Shutdown("Server shutting down")
+		} else {
+			key.(Socket).Close()
+		}
+		return true
+	})
+
+	// waits for clients to acknowledge the close frame
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+wait:
+	for s.connected() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			break wait
+		}
+	}
+
+	s.sockets.Range(func(key, _ any) bool {
+		if socket, ok := key.(*Sockt); ok {
+			socket.conn.Close()
+		}
+		return true
+	})
+
+	s.server.Shutdown(ctx)
+	s.bus.Close()
+
+	return err
+}
+
+func (s *Server) broadcast(response Response) {
+	s.sockets.Range(func(key, _ any) bool {
+		key.(Socket).Send(response)
+		return true
+	})
+	s.gateway.sessions.Range(func(_, value any) bool {
+		value.(Socket).Send(response)
+		return true
+	})
+}
+
+func (s *Server) connected() int {
+	total := 0
+	s.sockets.Range(func(_, _ any) bool {
+		total++
+		return true
+	})
+	return total
+}
+
+// Dispatch latency and errors, services report the rest on scrape
+func (s *Server) Metrics() *Metrics {
+	return s.metrics
 }
 
-func (s *Server) Listen(addr string) {
+// Writes the server's metrics followed by those of every
+// service implementing MetricsCollector
+func (s *Server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	scrape := NewMetrics()
+	scrape.Gauge("wingspan_sockets_connected", "Open websocket connections")
+	scrape.Set("wingspan_sockets_connected", float64(s.connected()))
+
+	for _, name := range s.order {
+		if collector, ok := s.services[name].recv.(MetricsCollector); ok {
+			collector.CollectMetrics(scrape)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.metrics.WriteTo(w)
+	scrape.WriteTo(w)
+}
+
+func (s *Server) Bus() *EventBus {
+	return s.bus
+}
+
+func (s *Server) Listen(addr string) error {
+	s.server.Addr = addr
+	s.server.Handler = s.Handler()
+	return s.server.ListenAndServe()
+}
+
+// Serves over TLS, picking up renewed certificates without restarting
+func (s *Server) ListenTLS(addr, certFile, keyFile string) error {
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	reloader.SetLogger(s.logger.Subsystem("tls"))
+
 	s.server.Addr = addr
-	s.server.Handler = http.HandlerFunc(s.Serve)
-	s.server.ListenAndServe()
+	s.server.Handler = s.Handler()
+	s.server.TLSConfig = &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	return s.server.ListenAndServeTLS("", "")
+}
+
+// Restricts websocket connections to the given origins, e.g.
+// https://example.com. Every origin is allowed when none is given
+func (s *Server) AllowOrigins(origins ...string) {
+	s.origins = make(map[string]bool)
+	for _, origin := range origins {
+		s.origins[strings.TrimSuffix(origin, "/")] = true
+	}
 }
 
-func (s *Server) handleMessage(socket *Sockt, message Message) {
+func (s *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(s.origins) == 0 || origin == "" || s.origins["*"] || s.origins[origin] {
+		return true
+	}
+
+	s.log.Warn("Rejected connection", "remote", r.RemoteAddr, "origin", origin)
+	return false
+}
+
+// Serves the HTTP gateway next to the websocket endpoint
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/rpc/", s.gateway)
+	mux.Handle("/events", s.gateway)
+	mux.HandleFunc("/metrics", s.serveMetrics)
+	mux.HandleFunc("/healthz", s.serveHealth)
+	mux.HandleFunc("/readyz", s.serveReady)
+	if s.admin != nil {
+		mux.Handle("/admin/", s.admin)
+	}
+	mux.HandleFunc("/", s.Serve)
+	return mux
+}
+
+func (s *Server) handleMessage(socket Socket, message Message) {
 	reply, err := s.Dispatch(socket, message)
+
+	// follow ups run on the bus, detached from the socket that triggered them
+	if err == nil && reply != nil {
+		s.bus.Publish(reply.Method, reply.Params)
+	}
+
+	// events dispatched from the bus have nobody to answer to
+	if socket == nil {
+		return
+	}
+
 	if err != nil {
+		socket.Send(errorResponse(message.ID, err))
+		if err == ErrTooManyViolations {
+			closeWithReason(socket, err.Error())
+		}
+		return
+	}
+
+	if message.ID != "" {
 		socket.Send(Response{
-			Type:    Error,
-			Payload: err.Error(),
+			ID:   message.ID,
+			Type: Ack,
 		})
-		return
 	}
-	if reply != nil {
-		s.handleMessage(socket, *reply)
+}
+
+// Answers the message the socket's connection is handling,
+// carrying its ID like the ack does
+func reply(socket Socket, response Response) (int, error) {
+	response.ID = socket.Session().Request()
+	return socket.Send(response)
+}
+
+func errorResponse(id string, err error) Response {
+	var payload any = err.Error()
+	if invalid, ok := err.(*ValidationError); ok {
+		payload = invalid
+	}
+
+	return Response{
+		ID:      id,
+		Type:    Error,
+		Payload: payload,
 	}
 }
 
+// Dispatches events published on topics named after a service method
+func (s *Server) handleEvent(event Event) {
+	s.handleMessage(nil, Message{
+		Method:   event.Topic,
+		Params:   event.Payload,
+		internal: true,
+	})
+}
+
 func (s *Server) Serve(w http.ResponseWriter, r *http.Request) {
-	s.upgrader.CheckOrigin = func(r *http.Request) bool {
-		return true
+	if s.draining.Load() {
+		http.Error(w, ErrServerDraining.Error(), http.StatusServiceUnavailable)
+		return
 	}
 
 	c, err := s.upgrader.Upgrade(w, r, nil)
@@ -69,15 +432,52 @@ func (s *Server) Serve(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	socket := NewSocket(c)
+	options := s.socketOptions
+	options.Logger = s.logger.Subsystem("socket")
+	socket := NewSocketWithOptions(c, s.codec(c.Subprotocol()), options)
+
+	s.sockets.Store(socket, true)
+	defer s.sockets.Delete(socket)
 
 	for message := range socket.Incoming {
 		s.handleMessage(socket, message)
 	}
 
+	s.disconnect(socket)
+}
+
+// Serves the server end of a pipe until either end is closed,
+// the way websocket connections are served but without HTTP
+func (s *Server) ServeSocket(socket *PipeSocket) error {
+	if s.draining.Load() {
+		socket.Close()
+		return ErrServerDraining
+	}
+
+	s.sockets.Store(socket, true)
+	defer s.sockets.Delete(socket)
+
+	for {
+		message, err := socket.Receive()
+		if err != nil {
+			break
+		}
+		s.handleMessage(socket, message)
+	}
+
+	s.disconnect(socket)
+	return nil
+}
+
+// Lets every service know the socket is gone
+func (s *Server) disconnect(socket Socket) {
+	if s.limiter != nil {
+		s.limiter.Forget(socket)
+	}
+
 	for _, service := range s.services {
 		method, ok := service.methods["Disconnect"]
-		if ok {
+		if ok && method.Type.NumIn() == 2 && reflect.TypeOf(socket).AssignableTo(method.Type.In(1)) {
 			method.Func.Call([]reflect.Value{
 				reflect.ValueOf(service.recv),
 				reflect.ValueOf(socket),
@@ -86,8 +486,82 @@ func (s *Server) Serve(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *Server) Dispatch(socket *Sockt, message Message) (*Message, error) {
+// Errors are labelled by the sentinel they wrap so details
+// such as versions or field names don't add label values
+func errorLabel(err error) string {
+	if _, ok := err.(*ValidationError); ok {
+		return "invalid params"
+	}
+	for errors.Unwrap(err) != nil {
+		err = errors.Unwrap(err)
+	}
+	return err.Error()
+}
+
+// Adds interceptors wrapping every dispatch, including follow up
+// messages coming from the bus. Must be called before listening
+func (s *Server) Use(interceptors ...Interceptor) {
+	s.interceptors = append(s.interceptors, interceptors...)
+}
+
+func (s *Server) Dispatch(socket Socket, message Message) (*Message, error) {
+	interceptors := s.interceptors
+	if s.limiter != nil {
+		interceptors = append([]Interceptor{s.limiter.Intercept}, interceptors...)
+	}
+	interceptors = append([]Interceptor{s.measure, RecoverWithLogger(s.log)}, interceptors...)
+
+	if socket != nil {
+		socket.Session().setRequest(message.ID)
+		defer socket.Session().setRequest("")
+	}
+	return Chain(s.dispatch, interceptors...)(socket, message)
+}
+
+// Records how long each dispatch took and why it failed.
+// Methods that do not exist share a label to bound cardinality
+func (s *Server) measure(next Handler) Handler {
+	return func(socket Socket, message Message) (*Message, error) {
+		start := time.Now()
+		reply, err := next(socket, message)
+
+		method := "unknown"
+		if name, call, ok := strings.Cut(message.Method, "."); ok {
+			if service, ok := s.services[name]; ok {
+				if _, ok := service.methods[call]; ok {
+					method = message.Method
+				}
+			}
+		}
+
+		elapsed := time.Since(start)
+		s.metrics.Observe("wingspan_dispatch_duration_seconds", elapsed.Seconds(), "method", method)
+		if err != nil {
+			s.metrics.Add("wingspan_dispatch_errors_total", 1, "method", method, "error", errorLabel(err))
+		}
+
+		if s.log.Enabled(LogDebug) || (err != nil && s.log.Enabled(LogInfo)) {
+			fields := []any{"method", message.Method, "duration", elapsed}
+			if socket != nil {
+				fields = append(fields, "conn", socket.Session().ConnectionID(), "session", socket.Session().ID())
+			}
+			if err != nil {
+				s.log.Info("Dispatch failed", append(fields, "error", err)...)
+			} else {
+				s.log.Debug("Dispatched", fields...)
+			}
+		}
+
+		return reply, err
+	}
+}
+
+func (s *Server) dispatch(socket Socket, message Message) (*Message, error) {
 	parts := strings.Split(message.Method, ".")
+	if len(parts) != 2 {
+		return nil, ErrMethodNotFound
+	}
+
 	service, ok := s.services[parts[0]]
 	if !ok {
 		return nil, ErrServiceNotFound
@@ -95,23 +569,37 @@ func (s *Server) Dispatch(socket *Sockt, message Message) (*Message, error) {
 
 	methods := service.methods
 	method, ok := methods[parts[1]]
-	if !ok {
+	if !ok || (service.internal[parts[1]] && !message.internal) {
 		return nil, ErrMethodNotFound
 	}
 
+	receiver := reflect.Zero(method.Type.In(1))
+	if socket != nil {
+		receiver = reflect.ValueOf(socket)
+		if !receiver.Type().AssignableTo(method.Type.In(1)) {
+			return nil, ErrMethodNotFound
+		}
+	}
+
 	params := []reflect.Value{
 		reflect.ValueOf(service.recv),
-		reflect.ValueOf(socket),
+		receiver,
 	}
 
-	if message.Params != nil {
-		params = append(params, reflect.ValueOf(message.Params))
-	}
+	for i := len(params); i < method.Type.NumIn(); i++ {
+		var payload any
+		// only the first parameter is bound to the message params
+		if i == 2 {
+			payload = message.Params
+		}
+
+		value, err := bindParam(payload, method.Type.In(i))
+		if err != nil {
+			err.Method = message.Method
+			return nil, err
+		}
 
-	inputCount := method.Type.NumIn()
-	for i := 0; i < inputCount-len(params); i++ {
-		value := reflect.New(method.Type.In(len(params) + i))
-		params = append(params, value.Elem())
+		params = append(params, value)
 	}
 
 	var err error
@@ -125,16 +613,47 @@ func (s *Server) Dispatch(socket *Sockt, message Message) (*Message, error) {
 	return reply, err
 }
 
+// Decodes params into a value of the given type
+func bindParam(params any, t reflect.Type) (reflect.Value, *ValidationError) {
+	value := reflect.New(t)
+
+	switch params := params.(type) {
+	case nil:
+		return value.Elem(), nil
+	case json.RawMessage:
+		if err := json.Unmarshal(params, value.Interface()); err != nil {
+			return value, NewValidationError(err)
+		}
+		return value.Elem(), nil
+	}
+
+	// internal messages usually carry values of the right type already
+	if reflect.TypeOf(params).AssignableTo(t) {
+		return reflect.ValueOf(params), nil
+	}
+
+	if err := ParsePayload(params, value.Interface()); err != nil {
+		return value, NewValidationError(err)
+	}
+
+	return value.Elem(), nil
+}
+
+// Services are registered once per name, their methods stay
+// subscribed to the bus for as long as the server runs
 func (s *Server) Register(name string, service any) error {
 	t := reflect.TypeOf(service)
 	if t == nil {
 		return ErrNilServiceProvided
 	}
+	if _, ok := s.services[name]; ok {
+		return ErrServiceRegistered
+	}
 
 	methods := make(map[string]reflect.Method)
 	for i := 0; i < t.NumMethod(); i++ {
 		m := t.Method(i)
-		if m.IsExported() {
+		if m.IsExported() && isHandler(m.Type) {
 			methods[m.Name] = m
 		}
 	}
@@ -143,10 +662,50 @@ func (s *Server) Register(name string, service any) error {
 		return ErrNoMethodsAvailable
 	}
 
+	internal := make(map[string]bool)
+	if svc, ok := service.(InternalService); ok {
+		for _, name := range svc.InternalMethods() {
+			internal[name] = true
+		}
+	}
+
+	s.order = append(s.order, name)
 	s.services[name] = &Service{
-		recv:    service,
-		methods: methods,
+		recv:     service,
+		methods:  methods,
+		internal: internal,
+	}
+
+	for method := range methods {
+		s.bus.Subscribe(name+"."+method, s.handleEvent)
+	}
+
+	if subscriber, ok := service.(EventSubscriber); ok {
+		subscriber.Subscribe(s.bus)
+	}
+
+	if setter, ok := service.(LoggerSetter); ok {
+		setter.SetLogger(s.logger.Subsystem(strings.ToLower(name)))
 	}
 
 	return nil
 }
+
+var (
+	socketType  = reflect.TypeOf((*Socket)(nil)).Elem()
+	messageType = reflect.TypeOf((*Message)(nil))
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Only methods shaped like func(Socket, [params]) (*Message, error)
+// can be dispatched, anything else is a helper
+func isHandler(method reflect.Type) bool {
+	if method.NumIn() < 2 || method.NumIn() > 3 || method.NumOut() != 2 {
+		return false
+	}
+	socket := method.In(1)
+	if socket != socketType && !socket.Implements(socketType) {
+		return false
+	}
+	return method.Out(0) == messageType && method.Out(1) == errorType
+}
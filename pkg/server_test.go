@@ -1,6 +1,12 @@
 package pkg_test
 
 import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -20,6 +26,21 @@ func (f *FakeMatchmaker) CreateMatch(socket *pkg.Sockt, players []pkg.Socket) (*
 	return nil, nil
 }
 
+type FakeGame struct {
+	birds []pkg.BirdID
+	cost  pkg.PayBirdCostPayload
+}
+
+func (f *FakeGame) ChooseBirds(socket pkg.Socket, birds []pkg.BirdID) (*pkg.Message, error) {
+	f.birds = birds
+	return nil, nil
+}
+
+func (f *FakeGame) PayBirdCost(socket pkg.Socket, payload pkg.PayBirdCostPayload) (*pkg.Message, error) {
+	f.cost = payload
+	return nil, nil
+}
+
 func TestServer(t *testing.T) {
 	t.Run("send message", func(t *testing.T) {
 		server := pkg.NewServer()
@@ -49,6 +70,21 @@ func TestServer(t *testing.T) {
 		}
 	})
 
+	t.Run("rejects registering a name twice", func(t *testing.T) {
+		server := pkg.NewServer()
+		game := new(FakeGame)
+
+		server.Register("Game", game)
+		if err := server.Register("Game", new(FakeGame)); err != pkg.ErrServiceRegistered {
+			t.Errorf("Expected error %v, got %v", pkg.ErrServiceRegistered, err)
+		}
+
+		server.Dispatch(nil, pkg.Message{Method: "Game.ChooseBirds", Params: []pkg.BirdID{1}})
+		if !reflect.DeepEqual(game.birds, []pkg.BirdID{1}) {
+			t.Errorf("Expected the first service to keep handling, got %v", game.birds)
+		}
+	})
+
 	t.Run("reply", func(t *testing.T) {
 		server := pkg.NewServer()
 		defer server.Close()
@@ -76,4 +112,434 @@ func TestServer(t *testing.T) {
 			t.Errorf("Expected type %v, got %v", "fake_match_created", response.Type)
 		}
 	})
+	t.Run("acks messages with id", func(t *testing.T) {
+		server := pkg.NewServer()
+		defer server.Close()
+
+		server.Register("Queue", pkg.NewQueue(2))
+
+		go server.Listen("0.0.0.0:8080")
+		time.Sleep(time.Millisecond)
+
+		conn, _, err := websocket.DefaultDialer.Dial("ws://0.0.0.0:8080", nil)
+		if err != nil {
+			t.Fatalf("Could not connect to server: %v", err)
+		}
+
+		conn.WriteJSON(pkg.Message{ID: "1", Method: "Queue.Add"})
+
+		var response pkg.Response
+		conn.ReadJSON(&response)
+		if response.Type != pkg.WaitForMatch {
+			t.Errorf("Expected type %v, got %v", pkg.WaitForMatch, response.Type)
+		}
+		if response.ID != "1" {
+			t.Errorf("Expected id %v on the reply, got %v", "1", response.ID)
+		}
+
+		response = pkg.Response{}
+		conn.ReadJSON(&response)
+		if response.Type != pkg.Ack {
+			t.Errorf("Expected type %v, got %v", pkg.Ack, response.Type)
+		}
+		if response.ID != "1" {
+			t.Errorf("Expected id %v, got %v", "1", response.ID)
+		}
+	})
+
+	t.Run("errors carry message id", func(t *testing.T) {
+		server := pkg.NewServer()
+		defer server.Close()
+
+		server.Register("Queue", pkg.NewQueue(2))
+
+		go server.Listen("0.0.0.0:8080")
+		time.Sleep(time.Millisecond)
+
+		conn, _, err := websocket.DefaultDialer.Dial("ws://0.0.0.0:8080", nil)
+		if err != nil {
+			t.Fatalf("Could not connect to server: %v", err)
+		}
+
+		conn.WriteJSON(pkg.Message{ID: "abc", Method: "Queue.Remove"})
+
+		var response pkg.Response
+		conn.ReadJSON(&response)
+		if response.Type != pkg.Error {
+			t.Errorf("Expected type %v, got %v", pkg.Error, response.Type)
+		}
+		if response.ID != "abc" {
+			t.Errorf("Expected id %v, got %v", "abc", response.ID)
+		}
+	})
+	t.Run("binds params", func(t *testing.T) {
+		game := new(FakeGame)
+		server := pkg.NewServer()
+		server.Register("Game", game)
+
+		var message pkg.Message
+		json.Unmarshal([]byte(`{"Method":"Game.PayBirdCost","Params":{"BirdID":5,"Food":[1,3],"Eggs":{"2":1}}}`), &message)
+
+		if _, err := server.Dispatch(pkg.NewTestSocket(), message); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		expected := pkg.PayBirdCostPayload{
+			BirdID: 5,
+			Food:   []pkg.FoodType{pkg.Seed, pkg.Fish},
+			Eggs:   map[pkg.BirdID]int{2: 1},
+		}
+		if !reflect.DeepEqual(game.cost, expected) {
+			t.Errorf("Expected %v, got %v", expected, game.cost)
+		}
+	})
+
+	t.Run("binds internal params", func(t *testing.T) {
+		game := new(FakeGame)
+		server := pkg.NewServer()
+		server.Register("Game", game)
+
+		server.Dispatch(nil, pkg.Message{
+			Method: "Game.ChooseBirds",
+			Params: []pkg.BirdID{1, 2},
+		})
+
+		if !reflect.DeepEqual(game.birds, []pkg.BirdID{1, 2}) {
+			t.Errorf("Expected %v, got %v", []pkg.BirdID{1, 2}, game.birds)
+		}
+	})
+
+	t.Run("validates params", func(t *testing.T) {
+		server := pkg.NewServer()
+		server.Register("Game", new(FakeGame))
+
+		var message pkg.Message
+		json.Unmarshal([]byte(`{"Method":"Game.PayBirdCost","Params":{"BirdID":"bird"}}`), &message)
+
+		_, err := server.Dispatch(pkg.NewTestSocket(), message)
+		invalid, ok := err.(*pkg.ValidationError)
+		if !ok {
+			t.Fatalf("Expected validation error, got %v", err)
+		}
+		if invalid.Field != "BirdID" {
+			t.Errorf("Expected field %v, got %v", "BirdID", invalid.Field)
+		}
+		if invalid.Method != "Game.PayBirdCost" {
+			t.Errorf("Expected method %v, got %v", "Game.PayBirdCost", invalid.Method)
+		}
+	})
+	t.Run("follow ups reach every player", func(t *testing.T) {
+		server := pkg.NewServer()
+		defer server.Close()
+
+		server.Register("Queue", pkg.NewQueue(2))
+		server.Register("Matchmaker", pkg.NewMatchmaker(time.Second))
+
+		go server.Listen("0.0.0.0:8080")
+		time.Sleep(time.Millisecond)
+
+		p1, _, _ := websocket.DefaultDialer.Dial("ws://0.0.0.0:8080", nil)
+		p2, _, _ := websocket.DefaultDialer.Dial("ws://0.0.0.0:8080", nil)
+
+		p1.WriteJSON(pkg.Message{Method: "Queue.Add"})
+		p1.ReadJSON(nil)
+
+		p2.WriteJSON(pkg.Message{Method: "Queue.Add"})
+		p2.ReadJSON(nil)
+
+		for _, player := range []*websocket.Conn{p1, p2} {
+			var response pkg.Response
+			if err := player.ReadJSON(&response); err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if response.Type != pkg.MatchFound {
+				t.Errorf("Expected type %v, got %v", pkg.MatchFound, response.Type)
+			}
+		}
+	})
+	t.Run("negotiates codec", func(t *testing.T) {
+		server := pkg.NewServer()
+		defer server.Close()
+
+		server.Register("Queue", pkg.NewQueue(2))
+
+		go server.Listen("0.0.0.0:8080")
+		time.Sleep(time.Millisecond)
+
+		dialer := websocket.Dialer{Subprotocols: []string{"msgpack"}}
+		conn, _, err := dialer.Dial("ws://0.0.0.0:8080", nil)
+		if err != nil {
+			t.Fatalf("Could not connect to server: %v", err)
+		}
+		if conn.Subprotocol() != "msgpack" {
+			t.Fatalf("Expected subprotocol %v, got %v", "msgpack", conn.Subprotocol())
+		}
+
+		data, _ := pkg.MsgpackCodec.Marshal(pkg.Message{Method: "Queue.Add"})
+		conn.WriteMessage(websocket.BinaryMessage, data)
+
+		frameType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if frameType != websocket.BinaryMessage {
+			t.Errorf("Expected binary frame, got %v", frameType)
+		}
+
+		var response pkg.Response
+		if err := pkg.MsgpackCodec.Unmarshal(data, &response); err != nil {
+			t.Fatalf("Could not decode response: %v", err)
+		}
+		if response.Type != pkg.WaitForMatch {
+			t.Errorf("Expected type %v, got %v", pkg.WaitForMatch, response.Type)
+		}
+	})
+	t.Run("graceful shutdown", func(t *testing.T) {
+		server := pkg.NewServer()
+		defer server.Close()
+
+		server.Register("Queue", pkg.NewQueue(2))
+		server.Register("Matchmaker", pkg.NewMatchmaker(time.Second))
+		server.Register("Game", pkg.NewGameManager())
+
+		go server.Listen("0.0.0.0:8080")
+		time.Sleep(time.Millisecond)
+
+		conn, _, err := websocket.DefaultDialer.Dial("ws://0.0.0.0:8080", nil)
+		if err != nil {
+			t.Fatalf("Could not connect to server: %v", err)
+		}
+
+		conn.WriteJSON(pkg.Message{Method: "Queue.Add"})
+		conn.ReadJSON(nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		done := make(chan error)
+		go func() {
+			done <- server.Shutdown(ctx)
+		}()
+
+		var response pkg.Response
+		if err := conn.ReadJSON(&response); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if response.Type != pkg.Maintenance {
+			t.Errorf("Expected type %v, got %v", pkg.Maintenance, response.Type)
+		}
+
+		err = conn.ReadJSON(&response)
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Errorf("Expected going away close, got %v", err)
+		}
+
+		if err := <-done; err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+
+		if _, _, err := websocket.DefaultDialer.Dial("ws://0.0.0.0:8080", nil); err == nil {
+			t.Error("Expected new connections to be refused")
+		}
+	})
+	t.Run("plays a game in memory", func(t *testing.T) {
+		rules := pkg.DefaultRules()
+		rules.MaxRounds = 1
+		rules.MaxTurns = 1
+
+		server := pkg.NewServer()
+		defer server.Close()
+
+		server.SetLogger(pkg.DiscardLogger())
+		server.Register("Queue", pkg.NewQueue(2))
+		server.Register("Matchmaker", pkg.NewMatchmaker(time.Second))
+		server.Register("Game", pkg.NewGameManagerWithRules(rules))
+
+		expect := func(t testing.TB, client *pkg.PipeClient, kind string) pkg.Response {
+			t.Helper()
+			response, err := client.Expect(kind)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return response
+		}
+
+		clients := make([]*pkg.PipeClient, 0)
+		for i := 0; i < 2; i++ {
+			client, socket := pkg.NewPipe()
+			defer client.Close()
+			go server.ServeSocket(socket)
+
+			client.Call("Queue.Add", nil)
+			expect(t, client, pkg.WaitForMatch)
+			clients = append(clients, client)
+		}
+
+		for _, client := range clients {
+			expect(t, client, pkg.MatchFound)
+			client.Call("Matchmaker.Accept", nil)
+			expect(t, client, pkg.WaitOtherPlayers)
+		}
+
+		for _, client := range clients {
+			var payload pkg.ChooseResources
+			if err := client.ExpectPayload(pkg.ChooseCards, &payload); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			for food := range payload.Food {
+				client.Call("Game.DiscardFood", map[pkg.FoodType]int{food: 0})
+				break
+			}
+		}
+
+		// the first player to move ends their turn, then the other
+		// ends the last turn of the game
+		var current, waiting *pkg.PipeClient
+		for _, client := range clients {
+			// whoever discarded first waited for the other
+			if _, err := client.SkipUntil(pkg.GameStarted); err != nil {
+				t.Fatal(err)
+			}
+			expect(t, client, pkg.RoundStarted)
+
+			response, err := client.Receive(time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.Type == pkg.StartTurn {
+				current = client
+			} else {
+				waiting = client
+			}
+		}
+		if current == nil || waiting == nil {
+			t.Fatal("Expected one player to start and the other to wait")
+		}
+
+		current.Call("Game.EndTurn", nil)
+		expect(t, waiting, pkg.StartTurn)
+		waiting.Call("Game.EndTurn", nil)
+
+		results := make(map[string]int)
+		for _, client := range clients {
+			response, err := client.SkipUntil(pkg.GameOver)
+			if err != nil {
+				t.Fatalf("Expected game over, got %v", err)
+			}
+
+			var result string
+			pkg.ParsePayload(response.Payload, &result)
+			results[result]++
+		}
+
+		if results["You win"] != 1 || results["You lost"] != 1 {
+			t.Errorf("Expected a winner and a loser, got %v", results)
+		}
+	})
+
+	t.Run("tells clients why they are disconnected", func(t *testing.T) {
+		server := pkg.NewServer()
+		server.Register("Queue", pkg.NewQueue(2))
+		server.SetRateLimits(pkg.RateLimits{
+			Connection:      pkg.RateLimit{Rate: 0.001, Burst: 1},
+			DisconnectAfter: 1,
+		})
+
+		http := httptest.NewServer(server.Handler())
+		defer http.Close()
+
+		conn, _, err := websocket.DefaultDialer.Dial(strings.Replace(http.URL, "http", "ws", 1), nil)
+		if err != nil {
+			t.Fatalf("Could not connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		conn.WriteJSON(pkg.Message{Method: "Queue.Add"})
+		conn.WriteJSON(pkg.Message{Method: "Queue.Add"})
+
+		for _, expected := range []string{pkg.WaitForMatch, pkg.Error} {
+			var response pkg.Response
+			if err := conn.ReadJSON(&response); err != nil {
+				t.Fatalf("Expected %v, got %v", expected, err)
+			}
+			if response.Type != expected {
+				t.Fatalf("Expected %v, got %v", expected, response.Type)
+			}
+			if expected == pkg.Error && response.Payload != pkg.ErrTooManyViolations.Error() {
+				t.Errorf("Expected payload %v, got %v", pkg.ErrTooManyViolations, response.Payload)
+			}
+		}
+
+		_, _, err = conn.ReadMessage()
+		closeErr, ok := err.(*websocket.CloseError)
+		if !ok || closeErr.Code != websocket.ClosePolicyViolation || closeErr.Text != pkg.ErrTooManyViolations.Error() {
+			t.Errorf("Expected policy violation close, got %v", err)
+		}
+	})
+
+	t.Run("exposes metrics", func(t *testing.T) {
+		server := pkg.NewServer()
+		server.Register("Queue", pkg.NewQueue(2))
+
+		socket := pkg.NewTestSocket()
+		server.Dispatch(socket, pkg.Message{Method: "Queue.Add"})
+		server.Dispatch(socket, pkg.Message{Method: "Queue.Add"})
+		server.Dispatch(socket, pkg.Message{Method: "Queue.Missing"})
+		server.Dispatch(socket, pkg.Message{Method: "System.Hello", Params: pkg.HelloPayload{Version: -1}})
+		server.Dispatch(socket, pkg.Message{Method: "System.Hello", Params: pkg.HelloPayload{Version: -2}})
+
+		http := httptest.NewServer(server.Handler())
+		defer http.Close()
+
+		response, err := http.Client().Get(http.URL + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+
+		body, _ := io.ReadAll(response.Body)
+		for _, line := range []string{
+			`wingspan_dispatch_duration_seconds_count{method="Queue.Add"} 2`,
+			`wingspan_dispatch_errors_total{method="Queue.Add",error="` + pkg.ErrAlreadyInQueue.Error() + `"} 1`,
+			`wingspan_dispatch_errors_total{method="unknown",error="Method not found"} 1`,
+			`wingspan_dispatch_errors_total{method="System.Hello",error="` + pkg.ErrUnsupportedVersion.Error() + `"} 2`,
+			"wingspan_queue_players 1",
+			"wingspan_sockets_connected 0",
+		} {
+			if !strings.Contains(string(body), line+"\n") {
+				t.Errorf("Expected %q in:\n%s", line, body)
+			}
+		}
+	})
+
+	t.Run("origin allowlist", func(t *testing.T) {
+		server := pkg.NewServer()
+		server.AllowOrigins("https://wingspan.example")
+
+		http := httptest.NewServer(server.Handler())
+		defer http.Close()
+
+		url := strings.Replace(http.URL, "http", "ws", 1)
+
+		allowed := map[string]bool{
+			"https://wingspan.example": true,
+			"https://evil.example":     false,
+			"":                         true,
+		}
+
+		for origin, expected := range allowed {
+			header := make(map[string][]string)
+			if origin != "" {
+				header["Origin"] = []string{origin}
+			}
+
+			conn, _, err := websocket.DefaultDialer.Dial(url, header)
+			if (err == nil) != expected {
+				t.Errorf("Origin %q: expected allowed %v, got error %v", origin, expected, err)
+			}
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	})
 }
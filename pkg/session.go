@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Identity behind a connection. Services key their state by the
+// session ID so it survives the connection that created it
+type Session struct {
+	mutex    sync.RWMutex
+	id       string
+	account  *Account
+	protocol Protocol
+	// ID of the message being handled, a connection
+	// handles its messages one at a time
+	request string
+}
+
+func NewSession() *Session {
+	return &Session{
+		id:       uuid.NewString(),
+		protocol: Protocol{Version: LEGACY_PROTOCOL_VERSION},
+	}
+}
+
+// The account ID once authenticated, an ID unique to the
+// connection otherwise
+func (s *Session) ID() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.account != nil {
+		return s.account.ID
+	}
+	return s.id
+}
+
+// Unique to the connection, unlike ID it does not
+// change once authenticated
+func (s *Session) ConnectionID() string {
+	return s.id
+}
+
+func (s *Session) Account() *Account {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.account
+}
+
+func (s *Session) Authenticated() bool {
+	return s.Account() != nil
+}
+
+func (s *Session) Authenticate(account *Account) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.account != nil {
+		return ErrAlreadyAuthenticated
+	}
+
+	s.account = account
+	return nil
+}
+
+// Negotiated through System.Hello, legacy until then
+func (s *Session) Protocol() Protocol {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.protocol
+}
+
+func (s *Session) SetProtocol(protocol Protocol) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.protocol = protocol
+}
+
+// ID of the message the connection is handling, for handlers
+// to stamp on the responses they answer it with
+func (s *Session) Request() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.request
+}
+
+func (s *Session) setRequest(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.request = id
+}
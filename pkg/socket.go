@@ -3,78 +3,342 @@ package pkg
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
-	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+const CLOSE_TIMEOUT = 5 * time.Second
+
 type Socket interface {
 	io.ReadWriteCloser
 	// Helper to send responses instead of handling io
 	Send(response Response) (int, error)
+	// Identity of whoever is on the other end
+	Session() *Session
+}
+
+// Implemented by sockets that can tell the client why they are
+// closed, after delivering the responses already sent
+type GracefulCloser interface {
+	CloseWithReason(reason string) error
+}
+
+// Closes gracefully when the socket supports it
+func closeWithReason(socket Socket, reason string) error {
+	if closer, ok := socket.(GracefulCloser); ok {
+		return closer.CloseWithReason(reason)
+	}
+	return socket.Close()
+}
+
+type SocketOptions struct {
+	// How often pings are sent, zero disables heartbeats
+	PingInterval time.Duration
+	// How long the connection may stay silent, pongs included,
+	// before it is considered dead. Zero waits forever
+	ReadTimeout time.Duration
+	// How long a write may block before the connection is
+	// considered dead. Zero waits forever
+	WriteTimeout time.Duration
+	// Responses waiting to be written, or polled from a gateway
+	// session, before SlowConsumer applies. Zero queues without bounds
+	QueueSize    int
+	SlowConsumer SlowConsumerPolicy
+	// Largest message accepted in bytes, bigger ones close
+	// the connection. Zero accepts any size
+	MaxMessageSize int64
+	// Undecodable messages tolerated before the connection
+	// is closed. Zero tolerates any amount
+	MaxInvalid int
+	// Where the socket logs, nowhere when nil
+	Logger *Logger `json:"-"`
+}
+
+func DefaultSocketOptions() SocketOptions {
+	return SocketOptions{
+		PingInterval: 25 * time.Second,
+		ReadTimeout:  60 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		QueueSize:    64,
+		SlowConsumer: DisconnectSlowConsumers,
+
+		MaxMessageSize: 64 << 10,
+		MaxInvalid:     10,
+	}
 }
 
 type Sockt struct {
 	conn     *websocket.Conn
+	codec    Codec
+	session  *Session
+	options  SocketOptions
+	logger   *Logger
+	latency  atomic.Int64
+	invalid  atomic.Uint64
+	outbox   *outbox
+	done     chan struct{}
+	closing  sync.Once
 	Incoming chan Message
-	Outgoing chan Response
 }
 
-func NewSocket(conn *websocket.Conn) *Sockt {
+// Defaults to JSON when no codec is given
+func NewSocket(conn *websocket.Conn, codec Codec) *Sockt {
+	return NewSocketWithOptions(conn, codec, DefaultSocketOptions())
+}
+
+func NewSocketWithOptions(conn *websocket.Conn, codec Codec, options SocketOptions) *Sockt {
+	if codec == nil {
+		codec = JSONCodec
+	}
+
+	logger := options.Logger
+	if logger == nil {
+		logger = DiscardLogger()
+	}
+
+	session := NewSession()
 	socket := &Sockt{
 		conn:     conn,
+		codec:    codec,
+		session:  session,
+		options:  options,
+		logger:   logger.With("conn", session.ConnectionID()),
+		outbox:   newOutbox(options.QueueSize, options.SlowConsumer),
+		done:     make(chan struct{}),
 		Incoming: make(chan Message),
-		Outgoing: make(chan Response),
 	}
 
+	socket.extendDeadline()
+	conn.SetPongHandler(socket.pong)
+
+	if options.MaxMessageSize > 0 {
+		conn.SetReadLimit(options.MaxMessageSize)
+	}
+
+	if options.PingInterval > 0 {
+		go socket.heartbeat()
+	}
+
+	go socket.write()
+
 	go func() {
+		defer close(socket.Incoming)
 		defer socket.Close()
+
 		for {
-			data, err := io.ReadAll(socket)
-			if err != nil {
-				break
+			message, err := socket.receive()
+			if err != nil && err != errDecode {
+				socket.logger.Debug("Connection closed", "error", err)
+				return
+			}
+
+			// keeps reading until the client acknowledges the close
+			if !socket.outbox.open() {
+				continue
 			}
-			var message Message
-			if err := json.Unmarshal(data, &message); err != nil {
-				log.Printf("Could not decode message: %v", message)
+
+			if err == errDecode {
+				if !socket.rejectInvalid() {
+					socket.logger.Warn("Closing after too many invalid messages", "invalid", socket.invalid.Load())
+					socket.CloseWithReason("Too many invalid messages")
+				}
 				continue
 			}
-			socket.Incoming <- message
+
+			select {
+			case socket.Incoming <- message:
+			case <-socket.done:
+				return
+			}
 		}
 	}()
 
 	return socket
 }
 
+func (s *Sockt) Codec() Codec {
+	return s.codec
+}
+
+func (s *Sockt) Session() *Session {
+	return s.session
+}
+
+// Round trip of the last heartbeat, zero until a pong arrives
+func (s *Sockt) Latency() time.Duration {
+	return time.Duration(s.latency.Load())
+}
+
+func (s *Sockt) Stats() SocketStats {
+	stats := s.outbox.Stats()
+	stats.Invalid = s.invalid.Load()
+	return stats
+}
+
+// Tells the client its message was not understood,
+// false once it sent more invalid messages than tolerated
+func (s *Sockt) rejectInvalid() bool {
+	invalid := s.invalid.Add(1)
+	s.Send(Response{Type: Error, Payload: errDecode.Error()})
+
+	max := s.options.MaxInvalid
+	return max == 0 || invalid <= uint64(max)
+}
+
+// Queues the response for the socket's writer, so callers never block
+// on a slow client. A full queue applies the slow consumer policy
 func (s *Sockt) Send(response Response) (int, error) {
-	data, err := json.Marshal(response)
+	data, err := s.codec.Marshal(response)
 	if err != nil {
 		return 0, err
 	}
-	return s.Write(data)
+
+	err = s.outbox.push(frame{kind: response.Type, mtype: s.codec.FrameType(), data: data})
+	if err == ErrSlowConsumer {
+		// the read loop notices and closes the socket
+		s.logger.Warn("Closing slow consumer", "session", s.session.ID())
+		s.conn.Close()
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
 }
 
+// Safe to call from any goroutine, Incoming is closed
+// once the read loop notices
 func (s *Sockt) Close() error {
-	close(s.Incoming)
-	close(s.Outgoing)
+	s.closing.Do(func() {
+		close(s.done)
+		s.outbox.close()
+	})
 	return s.conn.Close()
 }
 
+// Closes after writing the responses already queued and a close frame
+// telling the client why. The connection is dropped if the client does
+// not acknowledge it within WriteTimeout, or CLOSE_TIMEOUT without one
+func (s *Sockt) CloseWithReason(reason string) error {
+	message := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason)
+	if !s.outbox.drain(frame{control: true, mtype: websocket.CloseMessage, data: message}) {
+		return io.ErrClosedPipe
+	}
+
+	timeout := s.options.WriteTimeout
+	if timeout == 0 {
+		timeout = CLOSE_TIMEOUT
+	}
+
+	go func() {
+		select {
+		case <-s.done:
+		case <-time.After(timeout):
+			s.Close()
+		}
+	}()
+
+	return nil
+}
+
+// The only goroutine writing data frames to the connection
+func (s *Sockt) write() {
+	for {
+		f, ok := s.outbox.pop()
+		if !ok {
+			return
+		}
+
+		var err error
+		if f.control {
+			err = s.conn.WriteControl(f.mtype, f.data, s.writeDeadline())
+		} else {
+			s.conn.SetWriteDeadline(s.writeDeadline())
+			err = s.conn.WriteMessage(f.mtype, f.data)
+		}
+
+		if err != nil {
+			s.conn.Close()
+			return
+		}
+	}
+}
+
+// Pings the client until the socket closes. A ping that cannot be
+// written closes the connection, which ends the read loop
+func (s *Sockt) heartbeat() {
+	ticker := time.NewTicker(s.options.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			payload := []byte(strconv.FormatInt(now.UnixNano(), 10))
+			if err := s.conn.WriteControl(websocket.PingMessage, payload, s.writeDeadline()); err != nil {
+				s.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// Pongs echo the ping's send time, which gives the round trip
+func (s *Sockt) pong(data string) error {
+	if sent, err := strconv.ParseInt(data, 10, 64); err == nil {
+		s.latency.Store(int64(time.Since(time.Unix(0, sent))))
+	}
+	s.extendDeadline()
+	return nil
+}
+
+func (s *Sockt) extendDeadline() {
+	if s.options.ReadTimeout > 0 {
+		s.conn.SetReadDeadline(time.Now().Add(s.options.ReadTimeout))
+	}
+}
+
+func (s *Sockt) writeDeadline() time.Time {
+	if s.options.WriteTimeout > 0 {
+		return time.Now().Add(s.options.WriteTimeout)
+	}
+	return time.Time{}
+}
+
+// Sends a close frame telling the client the server is going away, after
+// the responses already queued. The connection closes once the client
+// acknowledges it
+func (s *Sockt) Shutdown(reason string) error {
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, reason)
+	if !s.outbox.drain(frame{control: true, mtype: websocket.CloseMessage, data: message}) {
+		return io.ErrClosedPipe
+	}
+	return nil
+}
+
+// Writes a JSON encoded response using the socket's codec
 func (s *Sockt) Write(data []byte) (int, error) {
 	var response Response
 	if err := json.Unmarshal(data, &response); err != nil {
 		return 0, err
 	}
-	if err := s.conn.WriteJSON(response); err != nil {
+	if _, err := s.Send(response); err != nil {
 		return 0, err
 	}
 	return len(data), nil
 }
 
+// Reads the next message JSON encoded, regardless of the socket's codec
 func (s *Sockt) Read(data []byte) (int, error) {
-	var message Message
-	if err := s.conn.ReadJSON(&message); err != nil {
+	message, err := s.receive()
+	if err != nil {
 		return 0, err
 	}
 
@@ -86,16 +350,41 @@ func (s *Sockt) Read(data []byte) (int, error) {
 	return copy(data, encoding), io.EOF
 }
 
+var errDecode = errors.New("Could not decode message")
+
+func (s *Sockt) receive() (Message, error) {
+	var message Message
+
+	_, data, err := s.conn.ReadMessage()
+	if err != nil {
+		return message, err
+	}
+	s.extendDeadline()
+
+	if err := s.codec.Unmarshal(data, &message); err != nil {
+		s.logger.Info("Could not decode message", "error", err)
+		return message, errDecode
+	}
+
+	return message, nil
+}
+
 type TestSocket struct {
-	buf *RingBuffer[*bytes.Buffer]
+	buf     *RingBuffer[*bytes.Buffer]
+	session *Session
 }
 
 func NewTestSocket() *TestSocket {
 	return &TestSocket{
-		buf: NewRingBuffer[*bytes.Buffer](10),
+		buf:     NewRingBuffer[*bytes.Buffer](10),
+		session: NewSession(),
 	}
 }
 
+func (t *TestSocket) Session() *Session {
+	return t.session
+}
+
 func (t *TestSocket) Close() error {
 	return nil
 }
@@ -0,0 +1,260 @@
+package pkg_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"git.internal.com/wingspan/pkg"
+	"github.com/gorilla/websocket"
+)
+
+func TestSocket(t *testing.T) {
+	connect := func(t testing.TB, options pkg.SocketOptions) (*pkg.Sockt, *websocket.Conn) {
+		t.Helper()
+
+		sockets := make(chan *pkg.Sockt, 1)
+		upgrader := new(websocket.Upgrader)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			sockets <- pkg.NewSocketWithOptions(c, nil, options)
+		}))
+		t.Cleanup(server.Close)
+
+		url := strings.Replace(server.URL, "http", "ws", 1)
+		client, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("Could not connect: %v", err)
+		}
+		t.Cleanup(func() { client.Close() })
+
+		return <-sockets, client
+	}
+
+	t.Run("measures latency", func(t *testing.T) {
+		socket, client := connect(t, pkg.SocketOptions{
+			PingInterval: 10 * time.Millisecond,
+			ReadTimeout:  time.Second,
+		})
+
+		// the client answers pings while reading
+		go func() {
+			for {
+				if _, _, err := client.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		deadline := time.Now().Add(time.Second)
+		for socket.Latency() == 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if socket.Latency() == 0 {
+			t.Error("Expected latency to be measured")
+		}
+	})
+
+	t.Run("closes silent connections", func(t *testing.T) {
+		socket, _ := connect(t, pkg.SocketOptions{
+			PingInterval: 10 * time.Millisecond,
+			ReadTimeout:  50 * time.Millisecond,
+		})
+
+		select {
+		case _, ok := <-socket.Incoming:
+			if ok {
+				t.Error("Expected no messages")
+			}
+		case <-time.After(time.Second):
+			t.Error("Expected silent connection to be closed")
+		}
+	})
+
+	t.Run("keeps connections answering pings", func(t *testing.T) {
+		socket, client := connect(t, pkg.SocketOptions{
+			PingInterval: 10 * time.Millisecond,
+			ReadTimeout:  50 * time.Millisecond,
+		})
+
+		go func() {
+			for {
+				if _, _, err := client.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		select {
+		case <-socket.Incoming:
+			t.Error("Expected connection to stay open")
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+
+	t.Run("writes in order", func(t *testing.T) {
+		socket, client := connect(t, pkg.DefaultSocketOptions())
+
+		types := []string{pkg.MatchFound, pkg.WaitOtherPlayers, pkg.GameStarted}
+		for _, kind := range types {
+			go socket.Send(pkg.Response{Type: kind})
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		for _, expected := range types {
+			var response pkg.Response
+			if err := client.ReadJSON(&response); err != nil {
+				t.Fatalf("Could not read response: %v", err)
+			}
+			if response.Type != expected {
+				t.Errorf("Expected %v, got %v", expected, response.Type)
+			}
+		}
+	})
+
+	t.Run("shutdown flushes queued responses", func(t *testing.T) {
+		socket, client := connect(t, pkg.DefaultSocketOptions())
+
+		types := []string{pkg.MatchFound, pkg.WaitOtherPlayers, pkg.GameStarted}
+		for _, kind := range types {
+			socket.Send(pkg.Response{Type: kind})
+		}
+		if err := socket.Shutdown("Server shutting down"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := socket.Send(pkg.Response{Type: pkg.Ack}); err == nil {
+			t.Error("Expected responses after shutting down to be refused")
+		}
+
+		for _, expected := range types {
+			var response pkg.Response
+			if err := client.ReadJSON(&response); err != nil {
+				t.Fatalf("Could not read response: %v", err)
+			}
+			if response.Type != expected {
+				t.Errorf("Expected %v, got %v", expected, response.Type)
+			}
+		}
+
+		var response pkg.Response
+		if err := client.ReadJSON(&response); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Errorf("Expected going away close, got %v", err)
+		}
+	})
+
+	// the client never reads, so the writer blocks once the
+	// connection's buffers fill up and the queue backs up
+	flood := func(socket *pkg.Sockt) error {
+		payload := strings.Repeat("x", 1<<20)
+		for i := 0; i < 40; i++ {
+			if _, err := socket.Send(pkg.Response{Type: pkg.FoodUpdated, Payload: payload}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	slow := pkg.SocketOptions{QueueSize: 2, WriteTimeout: 5 * time.Second}
+
+	t.Run("drops for slow consumers", func(t *testing.T) {
+		slow.SlowConsumer = pkg.DropResponses
+		socket, _ := connect(t, slow)
+
+		if err := flood(socket); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		stats := socket.Stats()
+		if stats.Dropped == 0 {
+			t.Error("Expected responses to be dropped")
+		}
+		if stats.MaxQueued != 2 {
+			t.Errorf("Expected max queued %v, got %v", 2, stats.MaxQueued)
+		}
+	})
+
+	t.Run("coalesces for slow consumers", func(t *testing.T) {
+		slow.SlowConsumer = pkg.CoalesceResponses
+		socket, _ := connect(t, slow)
+
+		if err := flood(socket); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if socket.Stats().Coalesced == 0 {
+			t.Error("Expected responses to be coalesced")
+		}
+	})
+
+	t.Run("disconnects slow consumers", func(t *testing.T) {
+		slow.SlowConsumer = pkg.DisconnectSlowConsumers
+		socket, _ := connect(t, slow)
+
+		if err := flood(socket); err != pkg.ErrSlowConsumer {
+			t.Fatalf("Expected error %v, got %v", pkg.ErrSlowConsumer, err)
+		}
+
+		select {
+		case <-socket.Incoming:
+		case <-time.After(time.Second):
+			t.Error("Expected slow consumer to be disconnected")
+		}
+	})
+
+	t.Run("closes on oversized messages", func(t *testing.T) {
+		socket, client := connect(t, pkg.SocketOptions{MaxMessageSize: 16})
+
+		client.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 100)))
+
+		select {
+		case _, ok := <-socket.Incoming:
+			if ok {
+				t.Error("Expected no messages")
+			}
+		case <-time.After(time.Second):
+			t.Error("Expected connection to be closed")
+		}
+	})
+
+	t.Run("rejects invalid messages", func(t *testing.T) {
+		socket, client := connect(t, pkg.SocketOptions{MaxInvalid: 1})
+
+		client.WriteMessage(websocket.TextMessage, []byte("garbage"))
+
+		var response pkg.Response
+		if err := client.ReadJSON(&response); err != nil {
+			t.Fatalf("Could not read response: %v", err)
+		}
+		if response.Type != pkg.Error {
+			t.Errorf("Expected %v, got %v", pkg.Error, response.Type)
+		}
+
+		client.WriteMessage(websocket.TextMessage, []byte("garbage"))
+
+		if err := client.ReadJSON(&response); err != nil || response.Type != pkg.Error {
+			t.Errorf("Expected %v before close, got %v", pkg.Error, err)
+		}
+		_, _, err := client.ReadMessage()
+		if closeErr, ok := err.(*websocket.CloseError); !ok || closeErr.Code != websocket.ClosePolicyViolation {
+			t.Errorf("Expected policy violation close, got %v", err)
+		}
+
+		select {
+		case _, ok := <-socket.Incoming:
+			if ok {
+				t.Error("Expected no messages")
+			}
+		case <-time.After(time.Second):
+			t.Error("Expected connection to be closed")
+		}
+		if socket.Stats().Invalid != 2 {
+			t.Errorf("Expected %v invalid, got %v", 2, socket.Stats().Invalid)
+		}
+	})
+}
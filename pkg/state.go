@@ -11,7 +11,7 @@ type ChooseFoodState struct {
 }
 
 func (s *ChooseFoodState) Enter(player *Player) error {
-	player.socket.Send(Response{
+	player.Send(Response{
 		Type: ChooseFood,
 		Payload: GainFood{
 			Amount:    s.Qty,
@@ -53,7 +53,7 @@ func (s *DrawCardsState) Enter(player *Player) error {
 		birdIds = append(birdIds, bird.ID)
 	}
 
-	player.socket.Send(Response{
+	player.Send(Response{
 		Type: ChooseCards,
 		Payload: map[string]any{
 			"qty":   s.Qty,
@@ -87,7 +87,7 @@ type LayEggsState struct {
 }
 
 func (s *LayEggsState) Enter(player *Player) error {
-	player.socket.Send(Response{
+	player.Send(Response{
 		Type: ChooseBirds,
 		Payload: map[string]any{
 			"qty":   s.Qty,
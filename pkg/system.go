@@ -0,0 +1,172 @@
+package pkg
+
+import (
+	"reflect"
+	"sort"
+)
+
+// Implemented by services with methods that are only reachable
+// through follow up messages, never directly from a socket
+type InternalService interface {
+	InternalMethods() []string
+}
+
+type ServiceDescription struct {
+	Name    string
+	Methods []MethodDescription
+}
+
+type MethodDescription struct {
+	Name   string
+	Params *ParamShape `json:",omitempty"`
+}
+
+// Describes the JSON a method expects as params
+type ParamShape struct {
+	Kind   string
+	Type   string                 `json:",omitempty"`
+	Elem   *ParamShape            `json:",omitempty"`
+	Key    *ParamShape            `json:",omitempty"`
+	Fields map[string]*ParamShape `json:",omitempty"`
+}
+
+// Built in service registered on every server
+type System struct {
+	server *Server
+}
+
+func (s *System) Describe(socket Socket) (*Message, error) {
+	_, err := reply(socket, Response{
+		Type:    Description,
+		Payload: s.server.Describe(),
+	})
+	return nil, err
+}
+
+// Negotiates the protocol version and capabilities, clients
+// that never say hello are treated as legacy ones
+func (s *System) Hello(socket Socket, hello HelloPayload) (*Message, error) {
+	protocol, err := Negotiate(hello)
+	if err != nil {
+		reply(socket, Response{
+			Type: Unsupported,
+			Payload: UnsupportedVersionPayload{
+				MinVersion: MIN_PROTOCOL_VERSION,
+				MaxVersion: PROTOCOL_VERSION,
+				Reason:     err.Error(),
+			},
+		})
+		return nil, err
+	}
+
+	socket.Session().SetProtocol(protocol)
+
+	capabilities := make([]string, 0)
+	for _, capability := range ServerCapabilities {
+		if protocol.Has(capability) {
+			capabilities = append(capabilities, capability)
+		}
+	}
+
+	_, err = reply(socket, Response{
+		Type: Welcome,
+		Payload: WelcomePayload{
+			Version:      protocol.Version,
+			Capabilities: capabilities,
+		},
+	})
+	return nil, err
+}
+
+// Lists every registered service with its callable methods
+func (s *Server) Describe() []ServiceDescription {
+	services := make([]ServiceDescription, 0, len(s.services))
+
+	for name, service := range s.services {
+		description := ServiceDescription{
+			Name:    name,
+			Methods: make([]MethodDescription, 0),
+		}
+
+		for methodName, method := range service.methods {
+			if service.internal[methodName] {
+				continue
+			}
+
+			var params *ParamShape
+			if method.Type.NumIn() > 2 {
+				params = describeType(method.Type.In(2), make(map[reflect.Type]bool))
+			}
+
+			description.Methods = append(description.Methods, MethodDescription{
+				Name:   methodName,
+				Params: params,
+			})
+		}
+
+		sort.Slice(description.Methods, func(i, j int) bool {
+			return description.Methods[i].Name < description.Methods[j].Name
+		})
+
+		services = append(services, description)
+	}
+
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Name < services[j].Name
+	})
+
+	return services
+}
+
+var textMarshalerType = reflect.TypeOf((*interface{ MarshalText() ([]byte, error) })(nil)).Elem()
+
+func describeType(t reflect.Type, seen map[reflect.Type]bool) *ParamShape {
+	shape := &ParamShape{Type: t.Name()}
+
+	if t.Implements(textMarshalerType) {
+		shape.Kind = "string"
+		return shape
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		shape.Kind = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		shape.Kind = "integer"
+	case reflect.Float32, reflect.Float64:
+		shape.Kind = "number"
+	case reflect.String:
+		shape.Kind = "string"
+	case reflect.Pointer:
+		return describeType(t.Elem(), seen)
+	case reflect.Slice, reflect.Array:
+		shape.Kind = "array"
+		shape.Elem = describeType(t.Elem(), seen)
+	case reflect.Map:
+		shape.Kind = "map"
+		shape.Key = describeType(t.Key(), seen)
+		shape.Elem = describeType(t.Elem(), seen)
+	case reflect.Struct:
+		shape.Kind = "object"
+
+		// avoids looping forever on recursive types
+		if seen[t] {
+			return shape
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		shape.Fields = make(map[string]*ParamShape)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.IsExported() {
+				shape.Fields[field.Name] = describeType(field.Type, seen)
+			}
+		}
+	default:
+		shape.Kind = "any"
+	}
+
+	return shape
+}
@@ -0,0 +1,153 @@
+package pkg_test
+
+import (
+	"errors"
+	"testing"
+
+	"git.internal.com/wingspan/pkg"
+)
+
+func TestSystem(t *testing.T) {
+	findService := func(services []pkg.ServiceDescription, name string) *pkg.ServiceDescription {
+		for _, service := range services {
+			if service.Name == name {
+				return &service
+			}
+		}
+		return nil
+	}
+
+	findMethod := func(service *pkg.ServiceDescription, name string) *pkg.MethodDescription {
+		for _, method := range service.Methods {
+			if method.Name == name {
+				return &method
+			}
+		}
+		return nil
+	}
+
+	t.Run("describe", func(t *testing.T) {
+		server := pkg.NewServer()
+		server.Register("Game", pkg.NewGameManager())
+
+		socket := pkg.NewTestSocket()
+		if _, err := server.Dispatch(socket, pkg.Message{Method: "System.Describe"}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		response := assertResponse(t, socket, pkg.Description)
+
+		var services []pkg.ServiceDescription
+		if err := pkg.ParsePayload(response.Payload, &services); err != nil {
+			t.Fatalf("Could not parse payload: %v", err)
+		}
+
+		game := findService(services, "Game")
+		if game == nil {
+			t.Fatal("Expected Game to be described")
+		}
+		if findService(services, "System") == nil {
+			t.Error("Expected System to be described")
+		}
+
+		for _, name := range []string{"Create", "Disconnect", "GetSocketGame", "InternalMethods"} {
+			if findMethod(game, name) != nil {
+				t.Errorf("Expected %v not to be described", name)
+			}
+		}
+
+		method := findMethod(game, "PayBirdCost")
+		if method == nil {
+			t.Fatal("Expected PayBirdCost to be described")
+		}
+		if method.Params.Kind != "object" {
+			t.Errorf("Expected kind %v, got %v", "object", method.Params.Kind)
+		}
+
+		eggs := method.Params.Fields["Eggs"]
+		if eggs.Kind != "map" || eggs.Key.Type != "BirdID" || eggs.Elem.Kind != "integer" {
+			t.Errorf("Unexpected shape for Eggs: %+v", eggs)
+		}
+
+		player := findMethod(game, "PlayerInfo")
+		if player.Params.Kind != "string" {
+			t.Errorf("Expected kind %v, got %v", "string", player.Params.Kind)
+		}
+
+		endTurn := findMethod(game, "EndTurn")
+		if endTurn.Params != nil {
+			t.Errorf("Expected no params, got %v", endTurn.Params)
+		}
+	})
+
+	t.Run("internal methods", func(t *testing.T) {
+		server := pkg.NewServer()
+		server.Register("Game", pkg.NewGameManager())
+
+		_, err := server.Dispatch(pkg.NewTestSocket(), pkg.Message{
+			Method: "Game.Create",
+			Params: []pkg.Socket{pkg.NewTestSocket()},
+		})
+		if err != pkg.ErrMethodNotFound {
+			t.Errorf("Expected error %v, got %v", pkg.ErrMethodNotFound, err)
+		}
+
+		if _, err := server.Dispatch(nil, pkg.Message{Method: "Game.GetSocketGame"}); err != pkg.ErrMethodNotFound {
+			t.Errorf("Expected error %v, got %v", pkg.ErrMethodNotFound, err)
+		}
+	})
+
+	t.Run("hello", func(t *testing.T) {
+		server := pkg.NewServer()
+		socket := pkg.NewTestSocket()
+
+		if socket.Session().Protocol().Version != pkg.LEGACY_PROTOCOL_VERSION {
+			t.Errorf("Expected legacy protocol before hello, got %v", socket.Session().Protocol())
+		}
+
+		hello := pkg.HelloPayload{Version: pkg.PROTOCOL_VERSION, Capabilities: []string{pkg.CapabilitySeq}}
+		if _, err := server.Dispatch(socket, pkg.Message{ID: "7", Method: "System.Hello", Params: hello}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		response := assertResponse(t, socket, pkg.Welcome)
+		if response.ID != "7" {
+			t.Errorf("Expected id %v on the reply, got %v", "7", response.ID)
+		}
+		if request := socket.Session().Request(); request != "" {
+			t.Errorf("Expected no request once handled, got %v", request)
+		}
+
+		var welcome pkg.WelcomePayload
+		pkg.ParsePayload(response.Payload, &welcome)
+
+		if welcome.Version != pkg.PROTOCOL_VERSION {
+			t.Errorf("Expected version %v, got %v", pkg.PROTOCOL_VERSION, welcome.Version)
+		}
+		if len(welcome.Capabilities) != 1 || welcome.Capabilities[0] != pkg.CapabilitySeq {
+			t.Errorf("Expected %v, got %v", []string{pkg.CapabilitySeq}, welcome.Capabilities)
+		}
+		if !socket.Session().Protocol().Has(pkg.CapabilitySeq) {
+			t.Error("Expected protocol to be stored on the session")
+		}
+	})
+
+	t.Run("hello unsupported", func(t *testing.T) {
+		server := pkg.NewServer()
+		socket := pkg.NewTestSocket()
+
+		hello := pkg.HelloPayload{Version: pkg.PROTOCOL_VERSION + 1}
+		if _, err := server.Dispatch(socket, pkg.Message{Method: "System.Hello", Params: hello}); !errors.Is(err, pkg.ErrUnsupportedVersion) {
+			t.Errorf("Expected error %v, got %v", pkg.ErrUnsupportedVersion, err)
+		}
+
+		response := assertResponse(t, socket, pkg.Unsupported)
+
+		var payload pkg.UnsupportedVersionPayload
+		pkg.ParsePayload(response.Payload, &payload)
+
+		if payload.MaxVersion != pkg.PROTOCOL_VERSION {
+			t.Errorf("Expected max version %v, got %v", pkg.PROTOCOL_VERSION, payload.MaxVersion)
+		}
+	})
+}
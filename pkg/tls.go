@@ -0,0 +1,91 @@
+package pkg
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+)
+
+// Serves a certificate and key pair, reloading them
+// whenever either file changes on disk
+type CertReloader struct {
+	mutex    sync.Mutex
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	modTime  time.Time
+	checked  time.Time
+	interval time.Duration
+	logger   *Logger
+}
+
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	reloader := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: time.Second,
+		logger:   DiscardLogger(),
+	}
+
+	modTime, err := reloader.lastModified()
+	if err != nil {
+		return nil, err
+	}
+	if err := reloader.load(modTime); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+func (c *CertReloader) SetLogger(logger *Logger) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.logger = logger
+}
+
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// checks the files at most once per interval
+	if time.Since(c.checked) >= c.interval {
+		c.checked = time.Now()
+
+		modTime, err := c.lastModified()
+		if err == nil && modTime.After(c.modTime) {
+			if err := c.load(modTime); err != nil {
+				c.logger.Error("Could not reload certificate, keeping the current one", "error", err)
+			}
+		}
+	}
+
+	return c.cert, nil
+}
+
+func (c *CertReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.cert = &cert
+	c.modTime = modTime
+	return nil
+}
+
+func (c *CertReloader) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
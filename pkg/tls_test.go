@@ -0,0 +1,110 @@
+package pkg_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.internal.com/wingspan/pkg"
+)
+
+func writeCert(t testing.TB, dir, name string, modTime time.Time) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{name},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Could not create certificate: %v", err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Could not marshal key: %v", err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+
+	os.Chtimes(certFile, modTime, modTime)
+	os.Chtimes(keyFile, modTime, modTime)
+
+	return certFile, keyFile
+}
+
+func commonName(t testing.TB, reloader *pkg.CertReloader) string {
+	t.Helper()
+
+	cert, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("Could not get certificate: %v", err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Could not parse certificate: %v", err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	t.Run("missing files", func(t *testing.T) {
+		if _, err := pkg.NewCertReloader("missing.pem", "missing.key"); err == nil {
+			t.Error("Expected error, got nothing")
+		}
+	})
+
+	t.Run("reloads changed files", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeCert(t, dir, "first", time.Now().Add(-time.Minute))
+
+		reloader, err := pkg.NewCertReloader(certFile, keyFile)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		writeCert(t, dir, "second", time.Now())
+
+		if name := commonName(t, reloader); name != "second" {
+			t.Errorf("Expected %v, got %v", "second", name)
+		}
+	})
+
+	t.Run("keeps certificate on bad reload", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeCert(t, dir, "first", time.Now().Add(-time.Minute))
+
+		reloader, err := pkg.NewCertReloader(certFile, keyFile)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		os.WriteFile(certFile, []byte("garbage"), 0600)
+
+		if name := commonName(t, reloader); name != "first" {
+			t.Errorf("Expected %v, got %v", "first", name)
+		}
+	})
+}